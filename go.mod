@@ -4,6 +4,7 @@ go 1.16
 
 require (
 	github.com/DeOne4eg/eth-unit-converter v0.2.0
+	github.com/btcsuite/btcd v0.21.0-beta
 	github.com/cihub/seelog v0.0.0-20170130134532-f561c5e57575
 	github.com/elazarl/goproxy v0.0.0-20211114080932-d06c3be7c11b // indirect
 	github.com/gin-gonic/gin v1.7.7
@@ -11,14 +12,19 @@ require (
 	github.com/go-playground/validator/v10 v10.9.0
 	github.com/go-redis/redis/v8 v8.11.4
 	github.com/go-rod/rod v0.101.8
-	github.com/jedib0t/go-pretty v4.3.0+incompatible
+	github.com/gorilla/websocket v1.4.1
+	github.com/jedib0t/go-pretty/v6 v6.4.0
 	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/panyanyany/go-web3 v0.0.0-20211114102612-894f3f7cae23
 	github.com/parnurzeal/gorequest v0.2.16
 	github.com/sirupsen/logrus v1.8.1
 	github.com/smartystreets/goconvey v1.7.2 // indirect
+	github.com/tyler-smith/go-bip39 v1.1.0
+	github.com/umbracle/fastrlp v0.0.0-20210128110402-41364ca56ca8
+	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
+	gopkg.in/yaml.v2 v2.4.0
 	gorm.io/driver/mysql v1.2.0
-	gorm.io/driver/sqlite v1.2.6 // indirect
+	gorm.io/driver/sqlite v1.2.6
 	gorm.io/gorm v1.22.4
 	moul.io/http2curl v1.0.0 // indirect
 )
@@ -0,0 +1,114 @@
+package pancake_util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/panyanyany/go-web3"
+)
+
+// DefaultFeeBps is the swap fee of PancakeSwap v2, 0.25%, Uniswap v2 takes 30
+const DefaultFeeBps = 25
+
+const bps = 10000
+
+var (
+	ErrInsufficientAmount    = errors.New("insufficient amount")
+	ErrInsufficientLiquidity = errors.New("insufficient liquidity")
+)
+
+// GetAmountOut is the output of swapping amountIn against the reserves, like the router does
+func GetAmountOut(amountIn, reserveIn, reserveOut *big.Int, feeBps int64) (amountOut *big.Int, err error) {
+	if amountIn.Sign() <= 0 {
+		err = ErrInsufficientAmount
+		return
+	}
+	if reserveIn.Sign() <= 0 || reserveOut.Sign() <= 0 {
+		err = ErrInsufficientLiquidity
+		return
+	}
+	amountInWithFee := new(big.Int).Mul(amountIn, big.NewInt(bps-feeBps))
+	numerator := new(big.Int).Mul(amountInWithFee, reserveOut)
+	denominator := new(big.Int).Mul(reserveIn, big.NewInt(bps))
+	denominator.Add(denominator, amountInWithFee)
+	amountOut = numerator.Quo(numerator, denominator)
+	return
+}
+
+// GetAmountIn is the input needed to get amountOut from the reserves, like the router does
+func GetAmountIn(amountOut, reserveIn, reserveOut *big.Int, feeBps int64) (amountIn *big.Int, err error) {
+	if amountOut.Sign() <= 0 {
+		err = ErrInsufficientAmount
+		return
+	}
+	if reserveIn.Sign() <= 0 || reserveOut.Cmp(amountOut) <= 0 {
+		err = ErrInsufficientLiquidity
+		return
+	}
+	numerator := new(big.Int).Mul(reserveIn, amountOut)
+	numerator.Mul(numerator, big.NewInt(bps))
+	denominator := new(big.Int).Sub(reserveOut, amountOut)
+	denominator.Mul(denominator, big.NewInt(bps-feeBps))
+	amountIn = numerator.Quo(numerator, denominator)
+	amountIn.Add(amountIn, big.NewInt(1))
+	return
+}
+
+// PriceImpact is how much worse the price of a swap is than the mid price of the reserves,
+// 0.01 meaning 1%, the fee included
+func PriceImpact(amountIn, amountOut, reserveIn, reserveOut *big.Int) float64 {
+	return priceImpact(amountIn, amountOut, new(big.Rat).SetFrac(reserveOut, reserveIn))
+}
+
+// priceImpact compares amountOut/amountIn to mid, the price of the input in output
+func priceImpact(amountIn, amountOut *big.Int, mid *big.Rat) float64 {
+	if amountIn.Sign() <= 0 || mid.Sign() <= 0 {
+		return 0
+	}
+	execution := new(big.Rat).SetFrac(amountOut, amountIn)
+	ratio, _ := new(big.Rat).Quo(execution, mid).Float64()
+	return 1 - ratio
+}
+
+// SortTokens orders tokens like the factory does for token0 and token1
+func SortTokens(a, b web3.Address) (web3.Address, web3.Address) {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		return b, a
+	}
+	return a, b
+}
+
+// Reserves is the state of a pair, Token0 sorting before Token1
+type Reserves struct {
+	Pair     web3.Address
+	Token0   web3.Address
+	Token1   web3.Address
+	Reserve0 *big.Int
+	Reserve1 *big.Int
+	// BlockTimestampLast is when the reserves last changed
+	BlockTimestampLast uint32
+}
+
+// Other returns the token of the pair that is not token
+func (r *Reserves) Other(token web3.Address) (web3.Address, error) {
+	switch token {
+	case r.Token0:
+		return r.Token1, nil
+	case r.Token1:
+		return r.Token0, nil
+	}
+	return web3.Address{}, fmt.Errorf("token %s not in pair %s", token, r.Pair)
+}
+
+// Of returns the reserves of tokenIn and of the other token
+func (r *Reserves) Of(tokenIn web3.Address) (reserveIn, reserveOut *big.Int, err error) {
+	switch tokenIn {
+	case r.Token0:
+		return r.Reserve0, r.Reserve1, nil
+	case r.Token1:
+		return r.Reserve1, r.Reserve0, nil
+	}
+	return nil, nil, fmt.Errorf("token %s not in pair %s", tokenIn, r.Pair)
+}
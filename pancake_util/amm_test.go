@@ -0,0 +1,100 @@
+package pancake_util_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"goutil/pancake_util"
+)
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func bigString(t *testing.T, s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("bad number %s", s)
+	}
+	return n
+}
+
+func TestGetAmountOut(t *testing.T) {
+	for _, c := range []struct {
+		in, reserveIn, reserveOut *big.Int
+		fee                       int64
+		want                      string
+	}{
+		{ether(1), ether(100), ether(200), pancake_util.DefaultFeeBps, "1975296418228173964"},
+		{ether(1), ether(100), ether(200), 30, "1974316068794122597"},
+		{ether(1), ether(100), ether(200), 0, "1980198019801980198"},
+		{big.NewInt(1000), big.NewInt(5000), big.NewInt(10000), pancake_util.DefaultFeeBps, "1663"},
+	} {
+		got, err := pancake_util.GetAmountOut(c.in, c.reserveIn, c.reserveOut, c.fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(bigString(t, c.want)) != 0 {
+			t.Errorf("GetAmountOut(%s, %s, %s, %d) = %s, want %s", c.in, c.reserveIn, c.reserveOut, c.fee, got, c.want)
+		}
+	}
+}
+
+func TestGetAmountIn(t *testing.T) {
+	for _, c := range []struct {
+		out, reserveIn, reserveOut *big.Int
+		fee                        int64
+		want                       string
+	}{
+		{ether(1), ether(100), ether(200), pancake_util.DefaultFeeBps, "503771992796060504"},
+		{ether(1), ether(100), ether(200), 30, "504024636724243082"},
+		{big.NewInt(1000), big.NewInt(5000), big.NewInt(10000), pancake_util.DefaultFeeBps, "557"},
+	} {
+		got, err := pancake_util.GetAmountIn(c.out, c.reserveIn, c.reserveOut, c.fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(bigString(t, c.want)) != 0 {
+			t.Errorf("GetAmountIn(%s, %s, %s, %d) = %s, want %s", c.out, c.reserveIn, c.reserveOut, c.fee, got, c.want)
+		}
+		// the input found gets at least the output asked for
+		out, err := pancake_util.GetAmountOut(got, c.reserveIn, c.reserveOut, c.fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Cmp(c.out) < 0 {
+			t.Errorf("GetAmountOut(GetAmountIn(%s)) = %s", c.out, out)
+		}
+	}
+}
+
+func TestAmountErrors(t *testing.T) {
+	zero := big.NewInt(0)
+	for _, c := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"out of nothing", amountOutErr(zero, ether(1), ether(1)), pancake_util.ErrInsufficientAmount},
+		{"out of empty reserve in", amountOutErr(ether(1), zero, ether(1)), pancake_util.ErrInsufficientLiquidity},
+		{"out of empty reserve out", amountOutErr(ether(1), ether(1), zero), pancake_util.ErrInsufficientLiquidity},
+		{"in for nothing", amountInErr(zero, ether(1), ether(1)), pancake_util.ErrInsufficientAmount},
+		{"in for the whole reserve", amountInErr(ether(1), ether(1), ether(1)), pancake_util.ErrInsufficientLiquidity},
+		{"in of empty reserve in", amountInErr(ether(1), zero, ether(2)), pancake_util.ErrInsufficientLiquidity},
+	} {
+		if !errors.Is(c.err, c.want) {
+			t.Errorf("%s: %v, want %v", c.name, c.err, c.want)
+		}
+	}
+}
+
+func amountOutErr(in, reserveIn, reserveOut *big.Int) error {
+	_, err := pancake_util.GetAmountOut(in, reserveIn, reserveOut, pancake_util.DefaultFeeBps)
+	return err
+}
+
+func amountInErr(out, reserveIn, reserveOut *big.Int) error {
+	_, err := pancake_util.GetAmountIn(out, reserveIn, reserveOut, pancake_util.DefaultFeeBps)
+	return err
+}
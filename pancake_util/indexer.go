@@ -0,0 +1,562 @@
+package pancake_util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+
+	"goutil/file_util"
+	"goutil/web3_util/contract"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+const factoryAbiStr = `[{"inputs":[],"name":"allPairsLength","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"name":"","type":"uint256"}],"name":"allPairs","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[{"name":"","type":"address"},{"name":"","type":"address"}],"name":"getPair","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"}]`
+
+const decimalsAbiStr = `[{"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"stateMutability":"view","type":"function"}]`
+
+// FactoryAbi has the methods of a uniswap v2 factory used to find pairs
+var FactoryAbi = abi.MustNewABI(factoryAbiStr)
+
+var decimalsAbi = abi.MustNewABI(decimalsAbiStr)
+
+var ErrNoPair = errors.New("no pair")
+
+// PairInfo is the metadata of a pair, Index is its position in allPairs, -1 when found by getPair.
+// Decimals are 0 when the token has no decimals().
+type PairInfo struct {
+	Pair      web3.Address
+	Index     int64
+	Token0    web3.Address
+	Token1    web3.Address
+	Decimals0 int
+	Decimals1 int
+}
+
+// PairStore keeps the pairs of a PairIndexer.
+// Save is given the pairs added or changed since the last call, a pair saved again replaces the old one.
+type PairStore interface {
+	Load() ([]*PairInfo, error)
+	Save([]*PairInfo) error
+}
+
+// FilePairStore is a PairStore kept in a file of one json pair per line, Save appends to it.
+// A file holding a json array, as written by older versions, is read too and rewritten on the first Save.
+type FilePairStore struct {
+	Path string
+
+	lock     sync.Mutex
+	migrated bool
+}
+
+func (f *FilePairStore) Load() (pairs []*PairInfo, err error) {
+	bs, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	if bs = bytes.TrimSpace(bs); len(bs) > 0 && bs[0] == '[' {
+		if err = json.Unmarshal(bs, &pairs); err != nil {
+			err = fmt.Errorf("json.Unmarshal: %w", err)
+		}
+		return
+	}
+	// a pair saved again comes later and replaces the first one when added
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	for dec.More() {
+		info := new(PairInfo)
+		if err = dec.Decode(info); err != nil {
+			err = fmt.Errorf("json.Decode: %w", err)
+			return
+		}
+		pairs = append(pairs, info)
+	}
+	return
+}
+
+func (f *FilePairStore) Save(pairs []*PairInfo) (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.migrated {
+		if err = f.migrate(); err != nil {
+			return
+		}
+		f.migrated = true
+	}
+	bs, err := pairLines(pairs)
+	if err != nil {
+		return
+	}
+	return file_util.AppendFile(f.Path, bs, nil)
+}
+
+// migrate rewrites a json array file as lines
+func (f *FilePairStore) migrate() (err error) {
+	bs, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	if bs = bytes.TrimSpace(bs); len(bs) == 0 || bs[0] != '[' {
+		return
+	}
+	var pairs []*PairInfo
+	if err = json.Unmarshal(bs, &pairs); err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+	if bs, err = pairLines(pairs); err != nil {
+		return
+	}
+	tmp := f.Path + ".tmp"
+	if err = file_util.OutputFile(tmp, bs, nil); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, f.Path); err != nil {
+		err = fmt.Errorf("os.Rename: %w", err)
+		return
+	}
+	return
+}
+
+func pairLines(pairs []*PairInfo) (bs []byte, err error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, info := range pairs {
+		if err = enc.Encode(info); err != nil {
+			err = fmt.Errorf("json.Encode: %w", err)
+			return
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// PairIndexer finds the pairs of a factory and keeps their reserves up to date from Sync events
+type PairIndexer struct {
+	Factory   *contract.Contract
+	Multicall *contract.Multicall
+	// Store, when set, keeps the pairs found across runs
+	Store PairStore
+	// BatchSize is how many pairs SyncPairs reads before saving them
+	BatchSize int
+	// FollowChunk is how many pairs one eth_getLogs of Follow asks for
+	FollowChunk int
+
+	lock     sync.RWMutex
+	pairs    map[web3.Address]*PairInfo
+	byTokens map[[2]web3.Address]web3.Address
+	// indexed is how many of allPairs are known
+	indexed  int64
+	decimals map[web3.Address]int
+	reserves map[web3.Address]*Reserves
+	block    uint64
+}
+
+func NewPairIndexer(factory web3.Address, mc *contract.Multicall, store PairStore) (x *PairIndexer, err error) {
+	x = &PairIndexer{
+		Factory:     contract.NewContract(factory, FactoryAbi, mc.Contract.Provider),
+		Multicall:   mc,
+		Store:       store,
+		BatchSize:   500,
+		FollowChunk: 1000,
+		pairs:       map[web3.Address]*PairInfo{},
+		byTokens:    map[[2]web3.Address]web3.Address{},
+		decimals:    map[web3.Address]int{},
+		reserves:    map[web3.Address]*Reserves{},
+	}
+	if store == nil {
+		return
+	}
+	infos, err := store.Load()
+	if err != nil {
+		err = fmt.Errorf("store.Load: %w", err)
+		return
+	}
+	x.lock.Lock()
+	for _, info := range infos {
+		x.add(info)
+	}
+	x.lock.Unlock()
+	return
+}
+
+// add records info, x.lock must be held
+func (x *PairIndexer) add(info *PairInfo) {
+	x.pairs[info.Pair] = info
+	x.byTokens[[2]web3.Address{info.Token0, info.Token1}] = info.Pair
+	x.decimals[info.Token0] = info.Decimals0
+	x.decimals[info.Token1] = info.Decimals1
+	if info.Index >= x.indexed {
+		x.indexed = info.Index + 1
+	}
+}
+
+// save stores the pairs just added
+func (x *PairIndexer) save(infos []*PairInfo) error {
+	if x.Store == nil {
+		return nil
+	}
+	return x.Store.Save(infos)
+}
+
+// Pairs returns the known pairs
+func (x *PairIndexer) Pairs() (infos []*PairInfo) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	for _, info := range x.pairs {
+		infos = append(infos, info)
+	}
+	return
+}
+
+// SyncPairs reads the pairs of allPairs not known yet, at most max of them when max > 0
+func (x *PairIndexer) SyncPairs(ctx context.Context, max int64) (added int64, err error) {
+	resp, err := x.Factory.CallContext(ctx, "allPairsLength", web3.Latest)
+	if err != nil {
+		err = fmt.Errorf("allPairsLength: %w", err)
+		return
+	}
+	n, ok := resp["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("bad allPairsLength: %v", resp)
+		return
+	}
+	length := n.Int64()
+
+	x.lock.RLock()
+	start := x.indexed
+	x.lock.RUnlock()
+	if max > 0 && start+max < length {
+		length = start + max
+	}
+
+	for from := start; from < length; from += int64(x.BatchSize) {
+		to := from + int64(x.BatchSize)
+		if to > length {
+			to = length
+		}
+		var calls []*contract.Call3
+		for i := from; i < to; i++ {
+			call := contract.NewCall3(x.Factory, "allPairs", big.NewInt(i))
+			call.AllowFailure = false
+			calls = append(calls, call)
+		}
+		var results []*contract.Call3Result
+		results, err = x.Multicall.AggregateContext(ctx, calls, web3.Latest)
+		if err != nil {
+			err = fmt.Errorf("allPairs[%d:%d]: %w", from, to, err)
+			return
+		}
+		addrs := make([]web3.Address, len(results))
+		for i, res := range results {
+			addrs[i], _ = res.Resp["0"].(web3.Address)
+		}
+
+		var infos []*PairInfo
+		infos, err = x.loadInfos(ctx, addrs)
+		if err != nil {
+			return
+		}
+		x.lock.Lock()
+		for i, info := range infos {
+			info.Index = from + int64(i)
+			x.add(info)
+		}
+		x.lock.Unlock()
+		added += int64(len(infos))
+
+		if err = x.save(infos); err != nil {
+			err = fmt.Errorf("x.save: %w", err)
+			return
+		}
+	}
+	return
+}
+
+// GetPair returns the pair of tokenA and tokenB, asking the factory when it is not known
+func (x *PairIndexer) GetPair(ctx context.Context, tokenA, tokenB web3.Address) (info *PairInfo, err error) {
+	token0, token1 := SortTokens(tokenA, tokenB)
+	x.lock.RLock()
+	addr, ok := x.byTokens[[2]web3.Address{token0, token1}]
+	info = x.pairs[addr]
+	x.lock.RUnlock()
+	if ok {
+		return
+	}
+
+	resp, err := x.Factory.CallContext(ctx, "getPair", web3.Latest, token0, token1)
+	if err != nil {
+		err = fmt.Errorf("getPair: %w", err)
+		return
+	}
+	addr, _ = resp["0"].(web3.Address)
+	if addr == (web3.Address{}) {
+		err = fmt.Errorf("%s/%s: %w", token0, token1, ErrNoPair)
+		return
+	}
+	infos, err := x.loadInfos(ctx, []web3.Address{addr})
+	if err != nil {
+		return
+	}
+	info = infos[0]
+	info.Index = -1
+	x.lock.Lock()
+	x.add(info)
+	x.lock.Unlock()
+
+	if err = x.save(infos); err != nil {
+		err = fmt.Errorf("x.save: %w", err)
+		return
+	}
+	return
+}
+
+// loadInfos reads the tokens of pairs and the decimals of tokens not seen yet
+func (x *PairIndexer) loadInfos(ctx context.Context, addrs []web3.Address) (infos []*PairInfo, err error) {
+	var calls []*contract.Call3
+	for _, addr := range addrs {
+		c := contract.NewContract(addr, PairAbi, x.Multicall.Contract.Provider)
+		calls = append(calls, contract.NewCall3(c, "token0"), contract.NewCall3(c, "token1"))
+	}
+	results, err := x.Multicall.AggregateContext(ctx, calls, web3.Latest)
+	if err != nil {
+		err = fmt.Errorf("token0/token1: %w", err)
+		return
+	}
+
+	x.lock.RLock()
+	var tokens []web3.Address
+	unknown := map[web3.Address]bool{}
+	for i, addr := range addrs {
+		info := &PairInfo{Pair: addr}
+		for _, res := range results[2*i : 2*i+2] {
+			if res.Err != nil {
+				x.lock.RUnlock()
+				err = fmt.Errorf("pair %s %s: %w", addr, res.Call.Method, res.Err)
+				return
+			}
+		}
+		info.Token0, _ = results[2*i].Resp["0"].(web3.Address)
+		info.Token1, _ = results[2*i+1].Resp["0"].(web3.Address)
+		for _, token := range []web3.Address{info.Token0, info.Token1} {
+			if _, ok := x.decimals[token]; !ok && !unknown[token] {
+				unknown[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+		infos = append(infos, info)
+	}
+	x.lock.RUnlock()
+
+	decimals := map[web3.Address]int{}
+	if len(tokens) > 0 {
+		calls = calls[:0]
+		for _, token := range tokens {
+			calls = append(calls, contract.NewCall3(contract.NewContract(token, decimalsAbi, x.Multicall.Contract.Provider), "decimals"))
+		}
+		results, err = x.Multicall.AggregateContext(ctx, calls, web3.Latest)
+		if err != nil {
+			err = fmt.Errorf("decimals: %w", err)
+			return
+		}
+		for i, res := range results {
+			if res.Err != nil {
+				seelog.Warnf("token %s decimals: %v", tokens[i], res.Err)
+				continue
+			}
+			d, _ := res.Resp["0"].(uint8)
+			decimals[tokens[i]] = int(d)
+		}
+	}
+
+	x.lock.RLock()
+	for _, info := range infos {
+		info.Decimals0 = x.tokenDecimals(info.Token0, decimals)
+		info.Decimals1 = x.tokenDecimals(info.Token1, decimals)
+	}
+	x.lock.RUnlock()
+	return
+}
+
+func (x *PairIndexer) tokenDecimals(token web3.Address, fetched map[web3.Address]int) int {
+	if d, ok := fetched[token]; ok {
+		return d
+	}
+	return x.decimals[token]
+}
+
+// LoadReserves reads the reserves of all known pairs at block, a number
+func (x *PairIndexer) LoadReserves(ctx context.Context, block uint64) (err error) {
+	var pairs []web3.Address
+	for _, info := range x.Pairs() {
+		pairs = append(pairs, info.Pair)
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	reserves, err := LoadReserves(ctx, x.Multicall, pairs, web3.BlockNumber(block))
+	if err != nil {
+		return
+	}
+	x.lock.Lock()
+	for _, r := range reserves {
+		x.reserves[r.Pair] = r
+	}
+	x.block = block
+	x.lock.Unlock()
+	return
+}
+
+// Follow keeps the reserves up to date from the Sync events of the pairs known when it starts,
+// from block `from` or right after the checkpoint, until ctx is done.
+// Reserves should first be loaded at the block before.
+func (x *PairIndexer) Follow(ctx context.Context, from uint64, cp contract.Checkpoint) (err error) {
+	c := contract.NewContract(web3.Address{}, PairAbi, x.Multicall.Contract.Provider)
+	s, err := contract.NewLogScanner(c, "Sync")
+	if err != nil {
+		return
+	}
+	s.MaxAddresses = x.FollowChunk
+	for _, info := range x.Pairs() {
+		s.Addresses = append(s.Addresses, info.Pair)
+	}
+	if len(s.Addresses) == 0 {
+		err = fmt.Errorf("no pairs to follow")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan *contract.DecodedLog)
+	chErr := make(chan error, 1)
+	go func() {
+		chErr <- s.Follow(ctx, from, cp, ch)
+	}()
+	for {
+		select {
+		case d := <-ch:
+			if err = x.applySync(ctx, d); err != nil {
+				return
+			}
+		case err = <-chErr:
+			return
+		}
+	}
+}
+
+// applySync sets the reserves of a Sync event, a removed one makes the pair read again
+func (x *PairIndexer) applySync(ctx context.Context, d *contract.DecodedLog) (err error) {
+	addr := d.Log.Address
+	x.lock.RLock()
+	info, ok := x.pairs[addr]
+	x.lock.RUnlock()
+	if !ok {
+		return
+	}
+
+	if d.Log.Removed {
+		var reserves []*Reserves
+		reserves, err = LoadReserves(ctx, x.Multicall, []web3.Address{addr}, web3.Latest)
+		if err != nil {
+			err = fmt.Errorf("pair %s after reorg: %w", addr, err)
+			return
+		}
+		x.lock.Lock()
+		x.reserves[addr] = reserves[0]
+		x.lock.Unlock()
+		return
+	}
+
+	r := &Reserves{Pair: addr, Token0: info.Token0, Token1: info.Token1}
+	var ok0, ok1 bool
+	r.Reserve0, ok0 = d.Args["reserve0"].(*big.Int)
+	r.Reserve1, ok1 = d.Args["reserve1"].(*big.Int)
+	if !ok0 || !ok1 {
+		err = fmt.Errorf("bad Sync of %s: %v", addr, d.Args)
+		return
+	}
+	x.lock.Lock()
+	x.reserves[addr] = r
+	if d.Log.BlockNumber > x.block {
+		x.block = d.Log.BlockNumber
+	}
+	x.lock.Unlock()
+	return
+}
+
+// Snapshot is a copy of the pairs and reserves of an indexer,
+// Block is the last block the reserves reflect
+type Snapshot struct {
+	Block    uint64
+	Pairs    map[web3.Address]*PairInfo
+	Reserves map[web3.Address]*Reserves
+}
+
+func (x *PairIndexer) Snapshot() *Snapshot {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	s := &Snapshot{
+		Block:    x.block,
+		Pairs:    make(map[web3.Address]*PairInfo, len(x.pairs)),
+		Reserves: make(map[web3.Address]*Reserves, len(x.reserves)),
+	}
+	for addr, info := range x.pairs {
+		s.Pairs[addr] = info
+	}
+	for addr, r := range x.reserves {
+		s.Reserves[addr] = r
+	}
+	return s
+}
+
+// Quoter returns a quoter over the pairs with reserves
+func (s *Snapshot) Quoter(feeBps int64) *Quoter {
+	q := NewQuoter().SetFeeBps(feeBps)
+	for _, r := range s.Reserves {
+		q.AddPair(r)
+	}
+	return q
+}
+
+// Price returns the mid price of base in the other token of pair, decimals applied
+func (s *Snapshot) Price(pair web3.Address, base web3.Address) (price float64, err error) {
+	info, ok := s.Pairs[pair]
+	r, okReserves := s.Reserves[pair]
+	if !ok || !okReserves {
+		err = fmt.Errorf("pair %s: %w", pair, ErrNoPair)
+		return
+	}
+	reserveBase, reserveQuote, err := r.Of(base)
+	if err != nil {
+		return
+	}
+	if reserveBase.Sign() == 0 {
+		err = fmt.Errorf("pair %s: %w", pair, ErrInsufficientLiquidity)
+		return
+	}
+	decimalsBase, decimalsQuote := info.Decimals0, info.Decimals1
+	if base == info.Token1 {
+		decimalsBase, decimalsQuote = decimalsQuote, decimalsBase
+	}
+	p := new(big.Rat).SetFrac(reserveQuote, reserveBase)
+	p.Mul(p, new(big.Rat).SetFrac(pow10(decimalsBase), pow10(decimalsQuote)))
+	price, _ = p.Float64()
+	return
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
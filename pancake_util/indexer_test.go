@@ -0,0 +1,40 @@
+package pancake_util_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"goutil/pancake_util"
+
+	"github.com/panyanyany/go-web3"
+)
+
+func TestFilePairStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pairs.json")
+	legacy := `[{"Pair":"0x00000000000000000000000000000000000000a1","Index":0,"Decimals0":18}]`
+	if err := ioutil.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := &pancake_util.FilePairStore{Path: path}
+	pairs, err := store.Load()
+	if err != nil || len(pairs) != 1 || pairs[0].Decimals0 != 18 {
+		t.Fatalf("Load() = %v, %v", pairs, err)
+	}
+
+	a2 := &pancake_util.PairInfo{Pair: web3.HexToAddress("0xa2"), Index: 1}
+	if err = store.Save([]*pancake_util.PairInfo{a2}); err != nil {
+		t.Fatal(err)
+	}
+	a2.Decimals1 = 6
+	if err = store.Save([]*pancake_util.PairInfo{a2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if pairs, err = (&pancake_util.FilePairStore{Path: path}).Load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 3 || pairs[0].Index != 0 || pairs[2].Pair != a2.Pair || pairs[2].Decimals1 != 6 {
+		t.Fatalf("Load() after Save = %+v, want the legacy pair then a2 twice", pairs)
+	}
+}
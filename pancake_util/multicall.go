@@ -1,12 +1,15 @@
 package pancake_util
 
 import (
+	"context"
 	"fmt"
-	"math"
 	"math/big"
 
 	"goutil/struct_util"
+	"goutil/web3_util"
 	"goutil/web3_util/bsc"
+	"goutil/web3_util/chains"
+	web3contract "goutil/web3_util/contract"
 
 	"github.com/panyanyany/go-web3"
 	"github.com/panyanyany/go-web3/contract"
@@ -14,15 +17,53 @@ import (
 
 type MultiCallRepo struct {
 	Contract *contract.Contract
+	// PricePair is the wrapped native / usd pair the native price is read from
+	PricePair web3.Address
+	// Wrapped is the wrapped native token of PricePair
+	Wrapped web3.Address
+	// Snapshot, when set, gives the native price without a call if it has PricePair
+	Snapshot func() *Snapshot
 }
 
 func NewMultiCallContract(contract *contract.Contract) *MultiCallRepo {
-	mc := &MultiCallRepo{contract}
+	mc := &MultiCallRepo{Contract: contract, PricePair: bsc.WbnbBusdPair.Address, Wrapped: bsc.Wbnb.Address}
 	return mc
 }
 
+// SetSnapshot makes prices come from the snapshots of a PairIndexer when they can
+func (mc *MultiCallRepo) SetSnapshot(fn func() *Snapshot) *MultiCallRepo {
+	mc.Snapshot = fn
+	return mc
+}
+
+// SetChain reads prices from the NativeUsdPair contract of chain
+func (mc *MultiCallRepo) SetChain(chain *chains.Chain) (*MultiCallRepo, error) {
+	pair, err := chain.Contract("NativeUsdPair")
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := chain.WrappedNativeToken()
+	if err != nil {
+		return nil, err
+	}
+	mc.PricePair = pair
+	mc.Wrapped = wrapped.Address
+	return mc, nil
+}
+
+// call runs a method of the multicall contract, the request is aborted when ctx is done
+func (mc *MultiCallRepo) call(ctx context.Context, method string, args ...interface{}) (resp map[string]interface{}, err error) {
+	c := web3contract.NewContract(mc.Contract.Address, mc.Contract.Abi, mc.Contract.Provider)
+	c.From = mc.Contract.From
+	return c.CallContext(ctx, method, web3.Latest, args...)
+}
+
 func (mc *MultiCallRepo) GetTokenInfo(tokenAddress string) (*Token, error) {
-	resp, err := mc.Contract.Call("getTokenInfo", web3.Latest, web3.HexToAddress(tokenAddress))
+	return mc.GetTokenInfoContext(context.Background(), tokenAddress)
+}
+
+func (mc *MultiCallRepo) GetTokenInfoContext(ctx context.Context, tokenAddress string) (*Token, error) {
+	resp, err := mc.call(ctx, "getTokenInfo", web3.HexToAddress(tokenAddress))
 	if err != nil {
 		fmt.Println("getTokenInfo err:", err)
 		return nil, err
@@ -39,12 +80,16 @@ func (mc *MultiCallRepo) GetTokenInfo(tokenAddress string) (*Token, error) {
 }
 
 func (mc *MultiCallRepo) GetTokenInfos(tokenAddresslist []string) ([]*Token, error) {
+	return mc.GetTokenInfosContext(context.Background(), tokenAddresslist)
+}
+
+func (mc *MultiCallRepo) GetTokenInfosContext(ctx context.Context, tokenAddresslist []string) ([]*Token, error) {
 	addresslist := make([]web3.Address, 0)
 	for _, addr := range tokenAddresslist {
 		addresslist = append(addresslist, web3.HexToAddress(addr))
 	}
 
-	resp, err := mc.Contract.Call("getTokenInfos", web3.Latest, addresslist)
+	resp, err := mc.call(ctx, "getTokenInfos", addresslist)
 	if err != nil {
 		fmt.Println("getTokenInfos err:", err)
 		return nil, err
@@ -60,6 +105,10 @@ func (mc *MultiCallRepo) GetTokenInfos(tokenAddresslist []string) ([]*Token, err
 }
 
 func (mc *MultiCallRepo) GetBalances(tokenAddresslist []string, userAddresslist []string) ([]*big.Int, error) {
+	return mc.GetBalancesContext(context.Background(), tokenAddresslist, userAddresslist)
+}
+
+func (mc *MultiCallRepo) GetBalancesContext(ctx context.Context, tokenAddresslist []string, userAddresslist []string) ([]*big.Int, error) {
 	tokenAddrList := make([]web3.Address, 0)
 	for _, addr := range tokenAddresslist {
 		tokenAddrList = append(tokenAddrList, web3.HexToAddress(addr))
@@ -70,7 +119,7 @@ func (mc *MultiCallRepo) GetBalances(tokenAddresslist []string, userAddresslist
 		userAddrList = append(userAddrList, web3.HexToAddress(addr))
 	}
 
-	resp, err := mc.Contract.Call("getUserBalances", web3.Latest, tokenAddrList, userAddrList)
+	resp, err := mc.call(ctx, "getUserBalances", tokenAddrList, userAddrList)
 	if err != nil {
 		fmt.Println("getUserBalances err:", err)
 		return nil, err
@@ -81,10 +130,31 @@ func (mc *MultiCallRepo) GetBalances(tokenAddresslist []string, userAddresslist
 	return userBalances, err
 }
 
+// GetBalanceMatrixContext is GetBalancesContext as a matrix, balances[i][j] is token i of user j.
+// getUserBalances returns them token by token, each with all the users.
+func (mc *MultiCallRepo) GetBalanceMatrixContext(ctx context.Context, tokenAddresslist []string, userAddresslist []string) (balances [][]*big.Int, err error) {
+	flat, err := mc.GetBalancesContext(ctx, tokenAddresslist, userAddresslist)
+	if err != nil {
+		return
+	}
+	if len(flat) != len(tokenAddresslist)*len(userAddresslist) {
+		err = fmt.Errorf("getUserBalances: got %d balances for %d tokens and %d users", len(flat), len(tokenAddresslist), len(userAddresslist))
+		return
+	}
+	for i := range tokenAddresslist {
+		balances = append(balances, flat[i*len(userAddresslist):(i+1)*len(userAddresslist)])
+	}
+	return
+}
+
 func (mc *MultiCallRepo) BalanceOf(tokenAddress string, userAddress string) (*big.Int, error) {
+	return mc.BalanceOfContext(context.Background(), tokenAddress, userAddress)
+}
+
+func (mc *MultiCallRepo) BalanceOfContext(ctx context.Context, tokenAddress string, userAddress string) (*big.Int, error) {
 	tokenAddr := web3.HexToAddress(tokenAddress)
 	userAddr := web3.HexToAddress(userAddress)
-	resp, err := mc.Contract.Call("getUserBalance", web3.Latest, tokenAddr, userAddr)
+	resp, err := mc.call(ctx, "getUserBalance", tokenAddr, userAddr)
 	if err != nil {
 		fmt.Println("getUserBalance err:", err)
 		return nil, err
@@ -96,20 +166,35 @@ func (mc *MultiCallRepo) BalanceOf(tokenAddress string, userAddress string) (*bi
 }
 
 func (mc *MultiCallRepo) GetBnbPrice() (float64, error) {
-	resp, err := mc.Contract.Call("getBnbPrice", web3.Latest, bsc.WbnbBusdPair.Address)
+	return mc.GetBnbPriceContext(context.Background())
+}
+
+func (mc *MultiCallRepo) GetBnbPriceContext(ctx context.Context) (float64, error) {
+	if mc.Snapshot != nil {
+		if price, err := mc.Snapshot().Price(mc.PricePair, mc.Wrapped); err == nil {
+			return price, nil
+		}
+	}
+	resp, err := mc.call(ctx, "getBnbPrice", mc.PricePair)
 	if err != nil {
 		fmt.Println("getBnbPrice err:", err)
 		return 0, err
 	}
 
-	bnbPrice := resp["bnbPriceBusd"].(*big.Int).Int64()
-	floatPrice := float64(bnbPrice) / math.Pow(10, 12)
-	return floatPrice, err
+	bnbPrice, ok := resp["bnbPriceBusd"].(*big.Int)
+	if !ok {
+		return 0, fmt.Errorf("bad getBnbPrice: %v", resp)
+	}
+	return web3_util.FromWeiDecimal(bnbPrice, 12).Float64(), nil
 }
 
 func (mc *MultiCallRepo) GetPairTokenInfo(pairAddress string) ([]*Token, error) {
+	return mc.GetPairTokenInfoContext(context.Background(), pairAddress)
+}
+
+func (mc *MultiCallRepo) GetPairTokenInfoContext(ctx context.Context, pairAddress string) ([]*Token, error) {
 	addr := web3.HexToAddress(pairAddress)
-	resp, err := mc.Contract.Call("getPairTokenInfo", web3.Latest, addr)
+	resp, err := mc.call(ctx, "getPairTokenInfo", addr)
 	if err != nil {
 		fmt.Println("getPairTokenInfo err:", err)
 		return nil, err
@@ -121,8 +206,12 @@ func (mc *MultiCallRepo) GetPairTokenInfo(pairAddress string) ([]*Token, error)
 }
 
 func (mc *MultiCallRepo) GetPairInfoWithPrice(pairAddress string) (*Pair, error) {
+	return mc.GetPairInfoWithPriceContext(context.Background(), pairAddress)
+}
+
+func (mc *MultiCallRepo) GetPairInfoWithPriceContext(ctx context.Context, pairAddress string) (*Pair, error) {
 	pairAddr := web3.HexToAddress(pairAddress)
-	resp, err := mc.Contract.Call("getPairInfoWithPrice", web3.Latest, pairAddr, bsc.WbnbBusdPair.Address)
+	resp, err := mc.call(ctx, "getPairInfoWithPrice", pairAddr, mc.PricePair)
 	if err != nil {
 		err = fmt.Errorf("getPairInfoWithPrice: %w", err)
 		return nil, err
@@ -141,9 +230,13 @@ func (mc *MultiCallRepo) GetPairInfoWithPrice(pairAddress string) (*Pair, error)
 }
 
 func (mc *MultiCallRepo) GetPairInfoWithFarmTVL(pairAddress string, farmAddress string) (*Pair, error) {
+	return mc.GetPairInfoWithFarmTVLContext(context.Background(), pairAddress, farmAddress)
+}
+
+func (mc *MultiCallRepo) GetPairInfoWithFarmTVLContext(ctx context.Context, pairAddress string, farmAddress string) (*Pair, error) {
 	pairAddr := web3.HexToAddress(pairAddress)
 	farmAddr := web3.HexToAddress(farmAddress)
-	resp, err := mc.Contract.Call("getPairInfoWithFarmTVL", web3.Latest, pairAddr, farmAddr, bsc.WbnbBusdPair.Address)
+	resp, err := mc.call(ctx, "getPairInfoWithFarmTVL", pairAddr, farmAddr, mc.PricePair)
 	if err != nil {
 		return nil, err
 	}
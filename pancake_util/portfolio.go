@@ -0,0 +1,389 @@
+package pancake_util
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"goutil/timeseries"
+	"goutil/web3_util"
+	"goutil/web3_util/contract"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+// maxPriceHops bounds how many pairs are followed to price a token in usd
+const maxPriceHops = 3
+
+// PortfolioToken is a token followed by a Portfolio. Pair prices it in the other token
+// of the pair, stable coins and the wrapped native token need none.
+type PortfolioToken struct {
+	Address  web3.Address
+	Symbol   string
+	Decimals int
+	Pair     web3.Address
+}
+
+// Holding is what a wallet has of a token
+type Holding struct {
+	Wallet web3.Address
+	Token  *PortfolioToken
+	Raw    *big.Int
+	Amount web3_util.Decimal
+	// Value is in usd, 0 when the token has no price
+	Value float64
+}
+
+// Valuation is a portfolio at a time. Holdings[i][j] is token i of wallet j.
+type Valuation struct {
+	Time     time.Time
+	Wallets  []web3.Address
+	Tokens   []*PortfolioToken
+	Holdings [][]*Holding
+	// Prices are usd prices by token, missing when a token could not be priced
+	Prices       map[web3.Address]float64
+	WalletTotals []float64
+	TokenAmounts []web3_util.Decimal
+	TokenTotals  []float64
+	Total        float64
+}
+
+// Holding returns the holding of wallet in token, nil when neither is followed
+func (v *Valuation) Holding(wallet, token web3.Address) *Holding {
+	for i, t := range v.Tokens {
+		if t.Address != token {
+			continue
+		}
+		for j, w := range v.Wallets {
+			if w == wallet {
+				return v.Holdings[i][j]
+			}
+		}
+	}
+	return nil
+}
+
+// Portfolio values the tokens of a set of wallets in usd.
+// Balances come from Repo, prices from its snapshot or, for the pairs it lacks, from the reserves read with Multicall.
+type Portfolio struct {
+	Repo      *MultiCallRepo
+	Multicall *contract.Multicall
+	Provider  jsonrpc.IEth
+	Wallets   []web3.Address
+	Tokens    []*PortfolioToken
+	// Stables are worth 1 usd
+	Stables map[web3.Address]bool
+
+	lock     sync.Mutex
+	series   timeseries.TimeSeries
+	decimals map[web3.Address]int
+}
+
+func NewPortfolio(repo *MultiCallRepo, mc *contract.Multicall, provider jsonrpc.IEth) *Portfolio {
+	return &Portfolio{
+		Repo:      repo,
+		Multicall: mc,
+		Provider:  provider,
+		Stables:   map[web3.Address]bool{},
+		series:    timeseries.NewTimeSeries(),
+		decimals:  map[web3.Address]int{},
+	}
+}
+
+func (p *Portfolio) AddWallets(wallets ...web3.Address) *Portfolio {
+	p.Wallets = append(p.Wallets, wallets...)
+	return p
+}
+
+// AddToken follows token, use Native for the native coin
+func (p *Portfolio) AddToken(t *PortfolioToken) *Portfolio {
+	p.Tokens = append(p.Tokens, t)
+	p.decimals[t.Address] = t.Decimals
+	return p
+}
+
+func (p *Portfolio) AddStables(tokens ...web3.Address) *Portfolio {
+	for _, t := range tokens {
+		p.Stables[t] = true
+	}
+	return p
+}
+
+// balances reads the token balances with the repo and the native ones with the provider
+func (p *Portfolio) balances(ctx context.Context) (balances [][]*big.Int, err error) {
+	var users, tokens []string
+	for _, w := range p.Wallets {
+		users = append(users, w.String())
+	}
+	for _, t := range p.Tokens {
+		if t.Address != Native {
+			tokens = append(tokens, t.Address.String())
+		}
+	}
+	var matrix [][]*big.Int
+	if len(tokens) > 0 {
+		if matrix, err = p.Repo.GetBalanceMatrixContext(ctx, tokens, users); err != nil {
+			err = fmt.Errorf("GetBalanceMatrixContext: %w", err)
+			return
+		}
+	}
+
+	for _, t := range p.Tokens {
+		if t.Address != Native {
+			balances = append(balances, matrix[0])
+			matrix = matrix[1:]
+			continue
+		}
+		row := make([]*big.Int, len(p.Wallets))
+		for j, w := range p.Wallets {
+			err = contract.WithContext(ctx, func() (err error) {
+				row[j], err = p.Provider.GetBalance(w, web3.Latest)
+				return
+			})
+			if err != nil {
+				err = fmt.Errorf("GetBalance %s: %w", w, err)
+				return
+			}
+		}
+		balances = append(balances, row)
+	}
+	return
+}
+
+// Prices returns the usd price of every token that can be priced
+func (p *Portfolio) Prices(ctx context.Context) (prices map[web3.Address]float64, err error) {
+	prices = map[web3.Address]float64{}
+	native, err := p.Repo.GetBnbPriceContext(ctx)
+	if err != nil {
+		err = fmt.Errorf("GetBnbPriceContext: %w", err)
+		return
+	}
+	prices[p.Repo.Wrapped] = native
+	prices[Native] = native
+	for t := range p.Stables {
+		prices[t] = 1
+	}
+
+	var snapshot *Snapshot
+	if p.Repo.Snapshot != nil {
+		snapshot = p.Repo.Snapshot()
+	}
+	reserves, err := p.loadReserves(ctx, snapshot)
+	if err != nil {
+		return
+	}
+
+	// pairs priced in other followed tokens need a few passes
+	failed := map[web3.Address]error{}
+	for hop := 0; hop < maxPriceHops; hop++ {
+		for _, t := range p.Tokens {
+			if _, ok := prices[t.Address]; ok || t.Pair == (web3.Address{}) {
+				continue
+			}
+			quote, price, priceErr := p.pairPrice(ctx, snapshot, reserves, t)
+			if priceErr != nil {
+				failed[t.Address] = priceErr
+				continue
+			}
+			if quotePrice, ok := prices[quote]; ok {
+				prices[t.Address] = price * quotePrice
+			}
+		}
+	}
+	for _, t := range p.Tokens {
+		if _, ok := prices[t.Address]; !ok && failed[t.Address] != nil {
+			seelog.Warnf("portfolio: price of %s: %v", t.Symbol, failed[t.Address])
+		}
+	}
+	return
+}
+
+// inSnapshot tells if snapshot can price pair
+func inSnapshot(snapshot *Snapshot, pair web3.Address) bool {
+	if snapshot == nil {
+		return false
+	}
+	_, ok := snapshot.Pairs[pair]
+	_, okReserves := snapshot.Reserves[pair]
+	return ok && okReserves
+}
+
+// loadReserves reads the reserves of the pairs snapshot does not have
+func (p *Portfolio) loadReserves(ctx context.Context, snapshot *Snapshot) (reserves map[web3.Address]*Reserves, err error) {
+	var pairs []web3.Address
+	for _, t := range p.Tokens {
+		if t.Pair != (web3.Address{}) && !inSnapshot(snapshot, t.Pair) {
+			pairs = append(pairs, t.Pair)
+		}
+	}
+	reserves = map[web3.Address]*Reserves{}
+	if len(pairs) == 0 {
+		return
+	}
+	loaded, err := LoadReserves(ctx, p.Multicall, pairs, web3.Latest)
+	if err != nil {
+		return
+	}
+	for _, r := range loaded {
+		reserves[r.Pair] = r
+	}
+	return
+}
+
+// pairPrice is the mid price of t in the other token of its pair
+func (p *Portfolio) pairPrice(ctx context.Context, snapshot *Snapshot, reserves map[web3.Address]*Reserves, t *PortfolioToken) (quote web3.Address, price float64, err error) {
+	if inSnapshot(snapshot, t.Pair) {
+		info := snapshot.Pairs[t.Pair]
+		quote = info.Token0
+		if quote == t.Address {
+			quote = info.Token1
+		}
+		price, err = snapshot.Price(t.Pair, t.Address)
+		return
+	}
+
+	r, ok := reserves[t.Pair]
+	if !ok {
+		err = fmt.Errorf("pair %s: %w", t.Pair, ErrNoPair)
+		return
+	}
+	reserveBase, reserveQuote, err := r.Of(t.Address)
+	if err != nil {
+		return
+	}
+	if reserveBase.Sign() == 0 {
+		err = fmt.Errorf("pair %s: %w", t.Pair, ErrInsufficientLiquidity)
+		return
+	}
+	if quote, err = r.Other(t.Address); err != nil {
+		return
+	}
+	quoteDecimals, err := p.tokenDecimals(ctx, quote)
+	if err != nil {
+		return
+	}
+	ratio := new(big.Rat).SetFrac(reserveQuote, reserveBase)
+	ratio.Mul(ratio, new(big.Rat).SetFrac(pow10(t.Decimals), pow10(quoteDecimals)))
+	price, _ = ratio.Float64()
+	return
+}
+
+func (p *Portfolio) tokenDecimals(ctx context.Context, token web3.Address) (decimals int, err error) {
+	p.lock.Lock()
+	decimals, ok := p.decimals[token]
+	p.lock.Unlock()
+	if ok {
+		return
+	}
+	if decimals, err = contract.NewERC20(token, p.Provider).Decimals(ctx); err != nil {
+		return
+	}
+	p.lock.Lock()
+	p.decimals[token] = decimals
+	p.lock.Unlock()
+	return
+}
+
+// Value reads balances and prices and adds them up
+func (p *Portfolio) Value(ctx context.Context) (v *Valuation, err error) {
+	balances, err := p.balances(ctx)
+	if err != nil {
+		return
+	}
+	prices, err := p.Prices(ctx)
+	if err != nil {
+		return
+	}
+
+	v = &Valuation{
+		Time:         time.Now(),
+		Wallets:      p.Wallets,
+		Tokens:       p.Tokens,
+		Prices:       prices,
+		WalletTotals: make([]float64, len(p.Wallets)),
+	}
+	for i, t := range p.Tokens {
+		price, priced := prices[t.Address]
+		amount := web3_util.Decimal{}
+		value := 0.0
+		var row []*Holding
+		for j, w := range p.Wallets {
+			h := &Holding{Wallet: w, Token: t, Raw: balances[i][j], Amount: web3_util.FromWeiDecimal(balances[i][j], t.Decimals)}
+			if priced {
+				h.Value = h.Amount.Float64() * price
+			}
+			amount = amount.Add(h.Amount)
+			value += h.Value
+			v.WalletTotals[j] += h.Value
+			row = append(row, h)
+		}
+		v.Holdings = append(v.Holdings, row)
+		v.TokenAmounts = append(v.TokenAmounts, amount)
+		v.TokenTotals = append(v.TokenTotals, value)
+		v.Total += value
+	}
+	return
+}
+
+// DataPoint is v as a row of the series: total, one value per wallet and per token, and token prices
+func (v *Valuation) DataPoint() timeseries.DataPoint {
+	columns := map[string]float64{"total": v.Total}
+	for j, w := range v.Wallets {
+		columns["wallet_"+w.String()] = v.WalletTotals[j]
+	}
+	for i, t := range v.Tokens {
+		columns["value_"+t.Symbol] = v.TokenTotals[i]
+		columns["price_"+t.Symbol] = v.Prices[t.Address]
+	}
+	return timeseries.NewDataPointFromData(v.Time, columns)
+}
+
+// Snapshot values the portfolio and appends it to Series.
+// Wallets and tokens must not change once the series has rows.
+func (p *Portfolio) Snapshot(ctx context.Context) (v *Valuation, err error) {
+	if v, err = p.Value(ctx); err != nil {
+		return
+	}
+	dp := v.DataPoint()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.series.IsEmpty() {
+		p.series = timeseries.NewTimeSeries()
+		for col := range dp.Columns {
+			p.series.Columns[col] = []float64{}
+		}
+	}
+	if p.series, err = p.series.AppendDataPoint(dp); err != nil {
+		err = fmt.Errorf("AppendDataPoint: %w", err)
+		return
+	}
+	return
+}
+
+// Series returns the snapshots taken so far
+func (p *Portfolio) Series() timeseries.TimeSeries {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.series
+}
+
+// Run takes a snapshot every interval until ctx is done, failed ones are logged and skipped
+func (p *Portfolio) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := p.Snapshot(ctx); err != nil && ctx.Err() == nil {
+			seelog.Warnf("portfolio: snapshot: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package pancake_util_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"testing"
+
+	"goutil/pancake_util"
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	web3contract "github.com/panyanyany/go-web3/contract"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+var (
+	repoAddr  = web3.HexToAddress("0x00000000000000000000000000000000000000c1")
+	pricePair = web3.HexToAddress("0x00000000000000000000000000000000000000c2")
+	pairAB    = web3.HexToAddress("0x00000000000000000000000000000000000000c3")
+	pairBW    = web3.HexToAddress("0x00000000000000000000000000000000000000c4")
+	usd       = web3.HexToAddress("0x00000000000000000000000000000000000000d1")
+	wallet1   = web3.HexToAddress("0x00000000000000000000000000000000000000e1")
+	wallet2   = web3.HexToAddress("0x00000000000000000000000000000000000000e2")
+)
+
+var repoAbi = abi.MustNewABI(`[{"inputs":[{"name":"tokens","type":"address[]"},{"name":"users","type":"address[]"}],"name":"getUserBalances","outputs":[{"name":"userBalances","type":"uint256[]"}],"stateMutability":"view","type":"function"},{"inputs":[{"name":"pair","type":"address"}],"name":"getBnbPrice","outputs":[{"name":"bnbPriceBusd","type":"uint256"}],"stateMutability":"view","type":"function"}]`)
+
+var multicall3Abi = abi.MustNewABI(`[{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`)
+
+func wei(n int64, decimals int) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+}
+
+// reserves of the pairs on chain: A (6 decimals) is worth 0.5 B, B is worth 0.01 wrapped
+var chainReserves = map[web3.Address]*pancake_util.Reserves{
+	pairAB: {Pair: pairAB, Token0: tokenA, Token1: tokenB, Reserve0: wei(100, 6), Reserve1: wei(50, 18)},
+	pairBW: {Pair: pairBW, Token0: tokenB, Token1: wrapped, Reserve0: wei(1000, 18), Reserve1: wei(10, 18)},
+}
+
+// mockPairs answers the pair calls of aggregate3 from chainReserves, loaded gets the pairs read
+func mockPairs(node *rpctest.Server) (loaded func() []web3.Address) {
+	var lock sync.Mutex
+	var pairs []web3.Address
+	node.Mock(contract.Multicall3Address, multicall3Abi).On("aggregate3", func(call *rpctest.Call) ([]interface{}, error) {
+		var results []map[string]interface{}
+		for _, item := range call.Args["calls"].([]map[string]interface{}) {
+			target := item["target"].(web3.Address)
+			r, ok := chainReserves[target]
+			if !ok {
+				return nil, fmt.Errorf("no pair at %s", target)
+			}
+			method, _, err := contract.NewContract(target, pancake_util.PairAbi, nil).DecodeInput(item["callData"].([]byte))
+			if err != nil {
+				return nil, err
+			}
+			var outputs []interface{}
+			switch method {
+			case "token0":
+				outputs = []interface{}{r.Token0}
+			case "token1":
+				outputs = []interface{}{r.Token1}
+			case "getReserves":
+				lock.Lock()
+				pairs = append(pairs, target)
+				lock.Unlock()
+				outputs = []interface{}{r.Reserve0, r.Reserve1, uint32(0)}
+			}
+			data, err := abi.Encode(outputs, pancake_util.PairAbi.Methods[method].Outputs)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, map[string]interface{}{"success": true, "returnData": data})
+		}
+		return []interface{}{results}, nil
+	})
+	return func() []web3.Address {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]web3.Address{}, pairs...)
+	}
+}
+
+// newPortfolio follows A, B, the native coin and a stable in two wallets
+func newPortfolio(t *testing.T, node *rpctest.Server) *pancake_util.Portfolio {
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balances := map[web3.Address][]*big.Int{
+		tokenA: {wei(2, 6), big.NewInt(500000)},
+		tokenB: {wei(1, 18), big.NewInt(0)},
+		usd:    {big.NewInt(0), wei(10, 18)},
+	}
+	node.Mock(repoAddr, repoAbi).
+		Return("getBnbPrice", wei(300, 12)).
+		On("getUserBalances", func(call *rpctest.Call) ([]interface{}, error) {
+			var flat []*big.Int
+			for _, token := range call.Args["tokens"].([]web3.Address) {
+				row, ok := balances[token]
+				if !ok {
+					return nil, fmt.Errorf("balances of %s", token)
+				}
+				flat = append(flat, row[:len(call.Args["users"].([]web3.Address))]...)
+			}
+			return []interface{}{flat}, nil
+		})
+	// the decimals of wrapped, which is not followed, are read from the chain
+	node.Mock(wrapped, contract.Erc20Abi).Return("decimals", uint8(18))
+	node.SetBalance(wallet1, wei(1, 18))
+	node.SetBalance(wallet2, wei(2, 18))
+
+	repo := &pancake_util.MultiCallRepo{
+		Contract:  web3contract.NewContract(repoAddr, repoAbi, client.Eth()),
+		PricePair: pricePair,
+		Wrapped:   wrapped,
+	}
+	// A comes first: it is priced once B is
+	return pancake_util.NewPortfolio(repo, contract.NewMulticall(client.Eth()), client.Eth()).
+		AddWallets(wallet1, wallet2).
+		AddToken(&pancake_util.PortfolioToken{Address: tokenA, Symbol: "A", Decimals: 6, Pair: pairAB}).
+		AddToken(&pancake_util.PortfolioToken{Address: tokenB, Symbol: "B", Decimals: 18, Pair: pairBW}).
+		AddToken(&pancake_util.PortfolioToken{Address: pancake_util.Native, Symbol: "BNB", Decimals: 18}).
+		AddToken(&pancake_util.PortfolioToken{Address: usd, Symbol: "USD", Decimals: 18}).
+		AddStables(usd)
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestPortfolioValue(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	mockPairs(node)
+	p := newPortfolio(t, node)
+
+	v, err := p.Value(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for token, want := range map[web3.Address]float64{tokenA: 1.5, tokenB: 3, pancake_util.Native: 300, usd: 1} {
+		if price, ok := v.Prices[token]; !ok || !near(price, want) {
+			t.Errorf("price of %s = %v, want %v", token, price, want)
+		}
+	}
+
+	for _, c := range []struct {
+		token  web3.Address
+		wallet web3.Address
+		amount string
+		value  float64
+	}{
+		{tokenA, wallet1, "2", 3},
+		{tokenA, wallet2, "0.5", 0.75},
+		{tokenB, wallet1, "1", 3},
+		{tokenB, wallet2, "0", 0},
+		{pancake_util.Native, wallet1, "1", 300},
+		{pancake_util.Native, wallet2, "2", 600},
+		{usd, wallet1, "0", 0},
+		{usd, wallet2, "10", 10},
+	} {
+		h := v.Holding(c.wallet, c.token)
+		if h == nil || h.Amount.String() != c.amount || !near(h.Value, c.value) {
+			t.Errorf("holding of %s in %s: %+v, want %s worth %v", c.wallet, c.token, h, c.amount, c.value)
+		}
+	}
+
+	if !near(v.WalletTotals[0], 306) || !near(v.WalletTotals[1], 610.75) {
+		t.Errorf("wallet totals %v, want [306 610.75]", v.WalletTotals)
+	}
+	if v.TokenAmounts[0].String() != "2.5" || !near(v.TokenTotals[0], 3.75) || !near(v.TokenTotals[2], 900) {
+		t.Errorf("token amounts %v totals %v", v.TokenAmounts, v.TokenTotals)
+	}
+	if !near(v.Total, 916.75) {
+		t.Errorf("total %v, want 916.75", v.Total)
+	}
+}
+
+// the snapshot prices the pairs it has, the others are read from the chain
+func TestPortfolioPricesSnapshotFallback(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	loaded := mockPairs(node)
+	p := newPortfolio(t, node)
+	node.Mock(repoAddr, repoAbi).Revert("getBnbPrice", "not from the snapshot")
+	snapshot := &pancake_util.Snapshot{
+		Pairs: map[web3.Address]*pancake_util.PairInfo{
+			pricePair: {Pair: pricePair, Token0: wrapped, Token1: usd, Decimals0: 18, Decimals1: 18},
+			pairBW:    {Pair: pairBW, Token0: tokenB, Token1: wrapped, Decimals0: 18, Decimals1: 18},
+		},
+		Reserves: map[web3.Address]*pancake_util.Reserves{
+			pricePair: {Pair: pricePair, Token0: wrapped, Token1: usd, Reserve0: wei(10, 18), Reserve1: wei(3000, 18)},
+			pairBW:    {Pair: pairBW, Token0: tokenB, Token1: wrapped, Reserve0: wei(2000, 18), Reserve1: wei(10, 18)},
+		},
+	}
+	p.Repo.SetSnapshot(func() *pancake_util.Snapshot { return snapshot })
+
+	prices, err := p.Prices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for token, want := range map[web3.Address]float64{tokenA: 0.75, tokenB: 1.5, pancake_util.Native: 300} {
+		if price, ok := prices[token]; !ok || !near(price, want) {
+			t.Errorf("price of %s = %v, want %v", token, price, want)
+		}
+	}
+	if pairs := loaded(); len(pairs) != 1 || pairs[0] != pairAB {
+		t.Fatalf("reserves read of %v, want only %s", pairs, pairAB)
+	}
+}
+
+func TestPortfolioSnapshot(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	mockPairs(node)
+	p := newPortfolio(t, node)
+
+	if _, err := p.Snapshot(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	node.SetBalance(wallet1, wei(3, 18))
+	if _, err := p.Snapshot(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	series := p.Series()
+	if series.Length() != 2 {
+		t.Fatalf("%d rows, want 2", series.Length())
+	}
+	for col, want := range map[string][]float64{
+		"total":                      {916.75, 1516.75},
+		"wallet_" + wallet1.String(): {306, 906},
+		"wallet_" + wallet2.String(): {610.75, 610.75},
+		"value_A":                    {3.75, 3.75},
+		"value_BNB":                  {900, 1500},
+		"price_A":                    {1.5, 1.5},
+		"price_USD":                  {1, 1},
+	} {
+		got := series.Get(col)
+		if len(got) != 2 || !near(got[0], want[0]) || !near(got[1], want[1]) {
+			t.Errorf("column %s = %v, want %v", col, got, want)
+		}
+	}
+	if len(series.ListColumns()) != 1+2+2*4 {
+		t.Errorf("columns %v", series.ListColumns())
+	}
+}
@@ -0,0 +1,246 @@
+package pancake_util
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/panyanyany/go-web3"
+)
+
+var ErrNoRoute = errors.New("no route")
+
+// Quote is a swap along Path through Pairs, Amounts are like the router getAmountsOut,
+// from the input to the output
+type Quote struct {
+	Path        []web3.Address
+	Pairs       []web3.Address
+	Amounts     []*big.Int
+	PriceImpact float64
+}
+
+func (q *Quote) AmountIn() *big.Int {
+	return q.Amounts[0]
+}
+
+func (q *Quote) AmountOut() *big.Int {
+	return q.Amounts[len(q.Amounts)-1]
+}
+
+// Quoter quotes swaps off-chain over a graph of known pairs.
+// Reserves given to AddPair must not be modified afterwards, add new ones instead.
+type Quoter struct {
+	FeeBps int64
+
+	lock  sync.RWMutex
+	pairs map[[2]web3.Address]*Reserves
+	// tokens paired with a token
+	adj map[web3.Address][]web3.Address
+}
+
+func NewQuoter() *Quoter {
+	return &Quoter{
+		FeeBps: DefaultFeeBps,
+		pairs:  map[[2]web3.Address]*Reserves{},
+		adj:    map[web3.Address][]web3.Address{},
+	}
+}
+
+func (q *Quoter) SetFeeBps(feeBps int64) *Quoter {
+	q.FeeBps = feeBps
+	return q
+}
+
+// AddPair adds a pair or replaces its reserves
+func (q *Quoter) AddPair(r *Reserves) {
+	key := [2]web3.Address{r.Token0, r.Token1}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, ok := q.pairs[key]; !ok {
+		q.adj[r.Token0] = append(q.adj[r.Token0], r.Token1)
+		q.adj[r.Token1] = append(q.adj[r.Token1], r.Token0)
+	}
+	q.pairs[key] = r
+}
+
+// Pair returns the reserves of the pair of a and b
+func (q *Quoter) Pair(a, b web3.Address) (*Reserves, bool) {
+	token0, token1 := SortTokens(a, b)
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	r, ok := q.pairs[[2]web3.Address{token0, token1}]
+	return r, ok
+}
+
+func (q *Quoter) Pairs() (pairs []*Reserves) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	for _, r := range q.pairs {
+		pairs = append(pairs, r)
+	}
+	return
+}
+
+func (q *Quoter) hops(path []web3.Address) (pairs []*Reserves, err error) {
+	if len(path) < 2 {
+		err = fmt.Errorf("path of %d tokens", len(path))
+		return
+	}
+	for i := 0; i+1 < len(path); i++ {
+		r, ok := q.Pair(path[i], path[i+1])
+		if !ok {
+			err = fmt.Errorf("no pair %s/%s: %w", path[i], path[i+1], ErrNoRoute)
+			return
+		}
+		pairs = append(pairs, r)
+	}
+	return
+}
+
+// GetAmountsOut is the router getAmountsOut on the known reserves
+func (q *Quoter) GetAmountsOut(amountIn *big.Int, path []web3.Address) (amounts []*big.Int, err error) {
+	quote, err := q.QuoteExactIn(amountIn, path)
+	if err != nil {
+		return
+	}
+	return quote.Amounts, nil
+}
+
+// GetAmountsIn is the router getAmountsIn on the known reserves
+func (q *Quoter) GetAmountsIn(amountOut *big.Int, path []web3.Address) (amounts []*big.Int, err error) {
+	quote, err := q.QuoteExactOut(amountOut, path)
+	if err != nil {
+		return
+	}
+	return quote.Amounts, nil
+}
+
+// QuoteExactIn quotes swapping amountIn along path
+func (q *Quoter) QuoteExactIn(amountIn *big.Int, path []web3.Address) (quote *Quote, err error) {
+	pairs, err := q.hops(path)
+	if err != nil {
+		return
+	}
+	quote = &Quote{Path: path, Amounts: make([]*big.Int, len(path))}
+	quote.Amounts[0] = new(big.Int).Set(amountIn)
+	for i, r := range pairs {
+		var reserveIn, reserveOut *big.Int
+		reserveIn, reserveOut, err = r.Of(path[i])
+		if err != nil {
+			return
+		}
+		quote.Amounts[i+1], err = GetAmountOut(quote.Amounts[i], reserveIn, reserveOut, q.FeeBps)
+		if err != nil {
+			err = fmt.Errorf("pair %s: %w", r.Pair, err)
+			return
+		}
+		quote.Pairs = append(quote.Pairs, r.Pair)
+	}
+	quote.PriceImpact = priceImpact(quote.AmountIn(), quote.AmountOut(), midPrice(pairs, path))
+	return
+}
+
+// QuoteExactOut quotes the input needed to get amountOut along path
+func (q *Quoter) QuoteExactOut(amountOut *big.Int, path []web3.Address) (quote *Quote, err error) {
+	pairs, err := q.hops(path)
+	if err != nil {
+		return
+	}
+	quote = &Quote{Path: path, Amounts: make([]*big.Int, len(path))}
+	quote.Amounts[len(path)-1] = new(big.Int).Set(amountOut)
+	for i := len(pairs) - 1; i >= 0; i-- {
+		var reserveIn, reserveOut *big.Int
+		reserveIn, reserveOut, err = pairs[i].Of(path[i])
+		if err != nil {
+			return
+		}
+		quote.Amounts[i], err = GetAmountIn(quote.Amounts[i+1], reserveIn, reserveOut, q.FeeBps)
+		if err != nil {
+			err = fmt.Errorf("pair %s: %w", pairs[i].Pair, err)
+			return
+		}
+	}
+	for _, r := range pairs {
+		quote.Pairs = append(quote.Pairs, r.Pair)
+	}
+	quote.PriceImpact = priceImpact(quote.AmountIn(), quote.AmountOut(), midPrice(pairs, path))
+	return
+}
+
+// midPrice is the price of the first token of path in the last one
+func midPrice(pairs []*Reserves, path []web3.Address) *big.Rat {
+	price := big.NewRat(1, 1)
+	for i, r := range pairs {
+		reserveIn, reserveOut, err := r.Of(path[i])
+		if err != nil || reserveIn.Sign() == 0 {
+			return new(big.Rat)
+		}
+		price.Mul(price, new(big.Rat).SetFrac(reserveOut, reserveIn))
+	}
+	return price
+}
+
+// BestRouteExactIn returns the path of at most maxHops pairs giving the most for amountIn
+func (q *Quoter) BestRouteExactIn(amountIn *big.Int, tokenIn, tokenOut web3.Address, maxHops int) (best *Quote, err error) {
+	for _, path := range q.paths(tokenIn, tokenOut, maxHops) {
+		quote, quoteErr := q.QuoteExactIn(amountIn, path)
+		if quoteErr != nil {
+			continue
+		}
+		if best == nil || quote.AmountOut().Cmp(best.AmountOut()) > 0 {
+			best = quote
+		}
+	}
+	if best == nil {
+		err = fmt.Errorf("%s to %s in %d hops: %w", tokenIn, tokenOut, maxHops, ErrNoRoute)
+	}
+	return
+}
+
+// BestRouteExactOut returns the path of at most maxHops pairs needing the least to get amountOut
+func (q *Quoter) BestRouteExactOut(amountOut *big.Int, tokenIn, tokenOut web3.Address, maxHops int) (best *Quote, err error) {
+	for _, path := range q.paths(tokenIn, tokenOut, maxHops) {
+		quote, quoteErr := q.QuoteExactOut(amountOut, path)
+		if quoteErr != nil {
+			continue
+		}
+		if best == nil || quote.AmountIn().Cmp(best.AmountIn()) < 0 {
+			best = quote
+		}
+	}
+	if best == nil {
+		err = fmt.Errorf("%s to %s in %d hops: %w", tokenIn, tokenOut, maxHops, ErrNoRoute)
+	}
+	return
+}
+
+// paths returns the paths from tokenIn to tokenOut of at most maxHops pairs, without a token twice
+func (q *Quoter) paths(tokenIn, tokenOut web3.Address, maxHops int) (paths [][]web3.Address) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	visited := map[web3.Address]bool{tokenIn: true}
+	path := []web3.Address{tokenIn}
+	var walk func(token web3.Address)
+	walk = func(token web3.Address) {
+		for _, next := range q.adj[token] {
+			if next == tokenOut {
+				paths = append(paths, append(append([]web3.Address{}, path...), next))
+				continue
+			}
+			if visited[next] || len(path) >= maxHops {
+				continue
+			}
+			visited[next] = true
+			path = append(path, next)
+			walk(next)
+			path = path[:len(path)-1]
+			visited[next] = false
+		}
+	}
+	if tokenIn != tokenOut {
+		walk(tokenIn)
+	}
+	return
+}
@@ -0,0 +1,120 @@
+package pancake_util
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"goutil/web3_util/contract"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+const pairAbiStr = `[{"inputs":[],"name":"token0","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"token1","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"getReserves","outputs":[{"name":"_reserve0","type":"uint112"},{"name":"_reserve1","type":"uint112"},{"name":"_blockTimestampLast","type":"uint32"}],"stateMutability":"view","type":"function"},{"anonymous":false,"inputs":[{"indexed":false,"name":"reserve0","type":"uint112"},{"indexed":false,"name":"reserve1","type":"uint112"}],"name":"Sync","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"sender","type":"address"},{"indexed":false,"name":"amount0In","type":"uint256"},{"indexed":false,"name":"amount1In","type":"uint256"},{"indexed":false,"name":"amount0Out","type":"uint256"},{"indexed":false,"name":"amount1Out","type":"uint256"},{"indexed":true,"name":"to","type":"address"}],"name":"Swap","type":"event"}]`
+
+// PairAbi has the methods and events of a uniswap v2 pair used for quoting
+var PairAbi = abi.MustNewABI(pairAbiStr)
+
+// LoadReserves reads the tokens and reserves of pairs through Multicall3, in order
+func LoadReserves(ctx context.Context, mc *contract.Multicall, pairs []web3.Address, block web3.BlockNumber) (reserves []*Reserves, err error) {
+	var calls []*contract.Call3
+	for _, addr := range pairs {
+		c := contract.NewContract(addr, PairAbi, mc.Contract.Provider)
+		calls = append(calls,
+			contract.NewCall3(c, "token0"),
+			contract.NewCall3(c, "token1"),
+			contract.NewCall3(c, "getReserves"),
+		)
+	}
+	results, err := mc.AggregateContext(ctx, calls, block)
+	if err != nil {
+		err = fmt.Errorf("mc.AggregateContext: %w", err)
+		return
+	}
+
+	for i, addr := range pairs {
+		r := &Reserves{Pair: addr}
+		token0, token1, state := results[3*i], results[3*i+1], results[3*i+2]
+		for _, res := range []*contract.Call3Result{token0, token1, state} {
+			if res.Err != nil {
+				err = fmt.Errorf("pair %s %s: %w", addr, res.Call.Method, res.Err)
+				return
+			}
+		}
+		r.Token0, _ = token0.Resp["0"].(web3.Address)
+		r.Token1, _ = token1.Resp["0"].(web3.Address)
+		if err = setReserves(r, state.Resp); err != nil {
+			err = fmt.Errorf("pair %s: %w", addr, err)
+			return
+		}
+		reserves = append(reserves, r)
+	}
+	return
+}
+
+// RefreshReserves reads the reserves of known pairs again, returning new Reserves in order
+func RefreshReserves(ctx context.Context, mc *contract.Multicall, pairs []*Reserves, block web3.BlockNumber) (reserves []*Reserves, err error) {
+	var calls []*contract.Call3
+	for _, p := range pairs {
+		calls = append(calls, contract.NewCall3(contract.NewContract(p.Pair, PairAbi, mc.Contract.Provider), "getReserves"))
+	}
+	results, err := mc.AggregateContext(ctx, calls, block)
+	if err != nil {
+		err = fmt.Errorf("mc.AggregateContext: %w", err)
+		return
+	}
+	for i, p := range pairs {
+		if results[i].Err != nil {
+			err = fmt.Errorf("pair %s getReserves: %w", p.Pair, results[i].Err)
+			return
+		}
+		r := &Reserves{Pair: p.Pair, Token0: p.Token0, Token1: p.Token1}
+		if err = setReserves(r, results[i].Resp); err != nil {
+			err = fmt.Errorf("pair %s: %w", p.Pair, err)
+			return
+		}
+		reserves = append(reserves, r)
+	}
+	return
+}
+
+func setReserves(r *Reserves, resp map[string]interface{}) error {
+	var ok0, ok1 bool
+	r.Reserve0, ok0 = resp["_reserve0"].(*big.Int)
+	r.Reserve1, ok1 = resp["_reserve1"].(*big.Int)
+	if !ok0 || !ok1 {
+		return fmt.Errorf("bad getReserves: %v", resp)
+	}
+	ts, _ := resp["_blockTimestampLast"].(uint32)
+	r.BlockTimestampLast = ts
+	return nil
+}
+
+// LoadPairs loads pairs into the quoter
+func (q *Quoter) LoadPairs(ctx context.Context, mc *contract.Multicall, pairs []web3.Address, block web3.BlockNumber) (err error) {
+	reserves, err := LoadReserves(ctx, mc, pairs, block)
+	if err != nil {
+		return
+	}
+	for _, r := range reserves {
+		q.AddPair(r)
+	}
+	return
+}
+
+// Refresh reads the reserves of all the pairs of the quoter again
+func (q *Quoter) Refresh(ctx context.Context, mc *contract.Multicall, block web3.BlockNumber) (err error) {
+	pairs := q.Pairs()
+	if len(pairs) == 0 {
+		return
+	}
+	reserves, err := RefreshReserves(ctx, mc, pairs, block)
+	if err != nil {
+		return
+	}
+	for _, r := range reserves {
+		q.AddPair(r)
+	}
+	return
+}
@@ -0,0 +1,517 @@
+package pancake_util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"goutil/web3_util/abis"
+	bscContract "goutil/web3_util/bsc/contract"
+	"goutil/web3_util/contract"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
+	"golang.org/x/crypto/sha3"
+)
+
+const erc20CheckAbiStr = `[{"inputs":[{"name":"account","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"owner","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"}]`
+
+var erc20CheckAbi = abi.MustNewABI(erc20CheckAbiStr)
+
+// Risk categories of owner-only functions
+const (
+	RiskMint      = "mint"
+	RiskFee       = "fee"
+	RiskBlacklist = "blacklist"
+	RiskTrading   = "trading"
+	RiskLimit     = "limit"
+	RiskUpgrade   = "upgrade"
+)
+
+// riskySignatures are common owner-only functions of scam or taxed tokens
+var riskySignatures = map[string]string{
+	"mint(uint256)":                             RiskMint,
+	"mint(address,uint256)":                     RiskMint,
+	"setTaxFeePercent(uint256)":                 RiskFee,
+	"setTaxFee(uint256)":                        RiskFee,
+	"setLiquidityFeePercent(uint256)":           RiskFee,
+	"setFee(uint256)":                           RiskFee,
+	"setFees(uint256,uint256)":                  RiskFee,
+	"setBuyFee(uint256)":                        RiskFee,
+	"setSellFee(uint256)":                       RiskFee,
+	"setTaxes(uint256,uint256)":                 RiskFee,
+	"updateFees(uint256,uint256,uint256)":       RiskFee,
+	"excludeFromFee(address)":                   RiskFee,
+	"blacklist(address)":                        RiskBlacklist,
+	"addToBlacklist(address)":                   RiskBlacklist,
+	"setBlacklist(address,bool)":                RiskBlacklist,
+	"blacklistAddress(address,bool)":            RiskBlacklist,
+	"addBot(address)":                           RiskBlacklist,
+	"setBots(address[])":                        RiskBlacklist,
+	"pause()":                                   RiskTrading,
+	"setTradingEnabled(bool)":                   RiskTrading,
+	"enableTrading()":                           RiskTrading,
+	"openTrading()":                             RiskTrading,
+	"setSwapEnabled(bool)":                      RiskTrading,
+	"setMaxTxAmount(uint256)":                   RiskLimit,
+	"setMaxTxPercent(uint256)":                  RiskLimit,
+	"setMaxWalletSize(uint256)":                 RiskLimit,
+	"setCooldownEnabled(bool)":                  RiskLimit,
+	"upgradeTo(address)":                        RiskUpgrade,
+	"upgradeToAndCall(address,bytes)":           RiskUpgrade,
+	"setImplementation(address)":                RiskUpgrade,
+	"setRouterAddress(address)":                 RiskTrading,
+	"setSwapAndLiquifyEnabled(bool)":            RiskTrading,
+	"setMarketingWallet(address)":               RiskFee,
+	"withdrawStuckTokens(address,uint256)":      RiskMint,
+	"setAutomatedMarketMakerPair(address,bool)": RiskTrading,
+}
+
+// riskyNames flag functions of an ABI by name when their signature is not known
+var riskyNames = map[string]string{
+	"mint":      RiskMint,
+	"fee":       RiskFee,
+	"tax":       RiskFee,
+	"blacklist": RiskBlacklist,
+	"bot":       RiskBlacklist,
+	"pause":     RiskTrading,
+	"trading":   RiskTrading,
+	"maxtx":     RiskLimit,
+	"maxwallet": RiskLimit,
+	"upgrade":   RiskUpgrade,
+}
+
+var riskySelectors = map[[4]byte]string{}
+
+func init() {
+	for sig := range riskySignatures {
+		riskySelectors[selector(sig)] = sig
+	}
+}
+
+func selector(sig string) (id [4]byte) {
+	k := sha3.NewLegacyKeccak256()
+	k.Write([]byte(sig))
+	copy(id[:], k.Sum(nil))
+	return
+}
+
+// RiskFunction is an owner-only looking function of a token, Source is "abi" or "bytecode"
+type RiskFunction struct {
+	Signature string
+	Category  string
+	Source    string
+}
+
+// RiskReport is what TokenChecker found about a token. Taxes go from 0 to 1, -1 when
+// they could not be measured.
+type RiskReport struct {
+	Token   web3.Address
+	BuyTax  float64
+	SellTax float64
+	// BuyReverts and SellReverts tell a swap fails whatever the minimum output
+	BuyReverts  bool
+	SellReverts bool
+	BuyError    string
+	SellError   string
+	// BalanceSlot is the storage slot of the balances mapping, nil when not found
+	BalanceSlot *big.Int
+	Owner       web3.Address
+	Renounced   bool
+	IsProxy     bool
+	Functions   []*RiskFunction
+	// Honeypot is set when buying works and selling does not
+	Honeypot bool
+	// Risks are short human readable findings
+	Risks []string
+}
+
+// TokenChecker simulates a buy and a sell of a token against native through the router
+type TokenChecker struct {
+	Router  *bscContract.PancakeRouter
+	Wrapped web3.Address
+	// Holder is the simulated buyer, its balance is overridden.
+	// A random address is used for each check when it is not set,
+	// so that no real balance or blacklist of a known address gets in the way.
+	Holder web3.Address
+	// BuyAmount is the native amount bought with
+	BuyAmount *big.Int
+	// MaxSlot is how many storage slots are probed for the balances mapping
+	MaxSlot int64
+	// HighTax flags taxes above it
+	HighTax float64
+	// Abis and Chain, when set, find the ABI of the token for function names
+	Abis  *abis.Resolver
+	Chain string
+}
+
+func NewTokenChecker(router *bscContract.PancakeRouter, wrapped web3.Address) *TokenChecker {
+	return &TokenChecker{
+		Router:    router,
+		Wrapped:   wrapped,
+		BuyAmount: big.NewInt(1e17),
+		MaxSlot:   100,
+		HighTax:   0.1,
+	}
+}
+
+func (c *TokenChecker) SetAbis(r *abis.Resolver, chain string) *TokenChecker {
+	c.Abis, c.Chain = r, chain
+	return c
+}
+
+// Check simulates the swaps and inspects the code of token
+func (c *TokenChecker) Check(ctx context.Context, token web3.Address) (report *RiskReport, err error) {
+	report = &RiskReport{Token: token, BuyTax: -1, SellTax: -1}
+	if c.Holder == (web3.Address{}) {
+		check := *c
+		if _, err = rand.Read(check.Holder[:]); err != nil {
+			err = fmt.Errorf("rand.Read: %w", err)
+			return
+		}
+		c = &check
+	}
+	tokenC := contract.NewContract(token, erc20CheckAbi, c.Router.Provider)
+
+	bought, err := c.checkBuy(ctx, token, report)
+	if err != nil {
+		return
+	}
+	if err = c.checkSell(ctx, tokenC, bought, report); err != nil {
+		return
+	}
+	if err = c.checkCode(ctx, tokenC, report); err != nil {
+		return
+	}
+	report.assess(c.HighTax)
+	return
+}
+
+// simulate runs tx from the holder with override, reverted is set when the call reverts
+// and err is left for failures of the node
+func (c *TokenChecker) simulate(ctx context.Context, tx *contract.Tx, override contract.StateOverride) (resp map[string]interface{}, reverted *contract.RevertError, err error) {
+	tx.From = c.Holder
+	tx.SetStateOverride(override)
+	resp, err = tx.SimulateContext(ctx, web3.Latest)
+	if errors.As(err, &reverted) {
+		return nil, reverted, nil
+	}
+	return
+}
+
+// maxBps finds the highest bps in [0, 10000] of expected that try accepts as minimum output,
+// -1 with the revert of try(0) when even no minimum passes
+func maxBps(expected *big.Int, try func(min *big.Int) (*contract.RevertError, error)) (best int64, reverted *contract.RevertError, err error) {
+	if reverted, err = try(new(big.Int)); err != nil || reverted != nil {
+		return -1, reverted, err
+	}
+	lo, hi := int64(0), int64(bps)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		r, tryErr := try(applyBps(expected, mid))
+		if tryErr != nil {
+			return -1, nil, tryErr
+		}
+		if r == nil {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo, nil, nil
+}
+
+func (c *TokenChecker) checkBuy(ctx context.Context, token web3.Address, report *RiskReport) (bought *big.Int, err error) {
+	path := []web3.Address{c.Wrapped, token}
+	resp, err := c.Router.CallContext(ctx, "getAmountsOut", web3.Latest, c.BuyAmount, path)
+	if err != nil {
+		err = fmt.Errorf("getAmountsOut: %w", err)
+		return
+	}
+	amounts, _ := resp["amounts"].([]*big.Int)
+	if len(amounts) != 2 {
+		err = fmt.Errorf("getAmountsOut: bad amounts %v", resp["amounts"])
+		return
+	}
+	expected := amounts[1]
+
+	override := contract.StateOverride{}.SetBalance(c.Holder, new(big.Int).Mul(c.BuyAmount, big.NewInt(10)))
+	deadline := big.NewInt(1 << 40)
+	buyBps, reverted, err := maxBps(expected, func(min *big.Int) (*contract.RevertError, error) {
+		tx := c.Router.SwapExactETHForTokensSupportingFeeOnTransferTokens(min, path, c.Holder, deadline).SetValue(c.BuyAmount)
+		_, reverted, err := c.simulate(ctx, tx, override)
+		return reverted, err
+	})
+	if err != nil {
+		err = fmt.Errorf("simulate buy: %w", err)
+		return
+	}
+	if reverted != nil {
+		report.BuyReverts = true
+		report.BuyError = reverted.Error()
+		// sell what the buy should have given
+		return expected, nil
+	}
+	report.BuyTax = 1 - float64(buyBps)/bps
+	return applyBps(expected, buyBps), nil
+}
+
+// mappingSlot is the slot of key in a mapping at slot, solidity or vyper layout
+func mappingSlot(key web3.Hash, slot web3.Hash, vyper bool) (h web3.Hash) {
+	k := sha3.NewLegacyKeccak256()
+	if vyper {
+		k.Write(slot[:])
+		k.Write(key[:])
+	} else {
+		k.Write(key[:])
+		k.Write(slot[:])
+	}
+	copy(h[:], k.Sum(nil))
+	return
+}
+
+func addressWord(addr web3.Address) (h web3.Hash) {
+	copy(h[12:], addr[:])
+	return
+}
+
+func uintWord(n *big.Int) (h web3.Hash) {
+	n.FillBytes(h[:])
+	return
+}
+
+// findBalanceSlot probes the slots of the balances mapping by overriding them for the holder
+func (c *TokenChecker) findBalanceSlot(ctx context.Context, tokenC *contract.Contract) (slot *big.Int, vyper bool, err error) {
+	marker := new(big.Int).Lsh(big.NewInt(0x5eed), 100)
+	for i := int64(0); i < c.MaxSlot; i++ {
+		for _, v := range []bool{false, true} {
+			s := mappingSlot(addressWord(c.Holder), uintWord(big.NewInt(i)), v)
+			override := contract.StateOverride{}.SetStorage(tokenC.Address, s, uintWord(marker))
+			tx := contract.NewTx().SetMethod("balanceOf").AddArgs(c.Holder).SetContract(tokenC)
+			resp, reverted, simErr := c.simulate(ctx, tx, override)
+			if simErr != nil {
+				err = fmt.Errorf("simulate balanceOf: %w", simErr)
+				return
+			}
+			if reverted != nil {
+				continue
+			}
+			if balance, _ := resp["0"].(*big.Int); balance != nil && balance.Cmp(marker) == 0 {
+				return big.NewInt(i), v, nil
+			}
+		}
+	}
+	return
+}
+
+// findAllowanceSlot probes the slots of the allowances mapping for the holder and the router
+func (c *TokenChecker) findAllowanceSlot(ctx context.Context, tokenC *contract.Contract) (slot web3.Hash, found bool, err error) {
+	marker := new(big.Int).Lsh(big.NewInt(0xa110), 100)
+	for i := int64(0); i < c.MaxSlot; i++ {
+		for _, v := range []bool{false, true} {
+			s := mappingSlot(addressWord(c.Router.Address), mappingSlot(addressWord(c.Holder), uintWord(big.NewInt(i)), v), v)
+			override := contract.StateOverride{}.SetStorage(tokenC.Address, s, uintWord(marker))
+			tx := contract.NewTx().SetMethod("allowance").AddArgs(c.Holder, c.Router.Address).SetContract(tokenC)
+			resp, reverted, simErr := c.simulate(ctx, tx, override)
+			if simErr != nil {
+				err = fmt.Errorf("simulate allowance: %w", simErr)
+				return
+			}
+			if reverted != nil {
+				continue
+			}
+			if allowance, _ := resp["0"].(*big.Int); allowance != nil && allowance.Cmp(marker) == 0 {
+				return s, true, nil
+			}
+		}
+	}
+	return
+}
+
+func (c *TokenChecker) checkSell(ctx context.Context, tokenC *contract.Contract, amount *big.Int, report *RiskReport) (err error) {
+	slot, vyper, err := c.findBalanceSlot(ctx, tokenC)
+	if err != nil {
+		return
+	}
+	if slot == nil {
+		report.SellError = "balance slot not found, sell not simulated"
+		return
+	}
+	report.BalanceSlot = slot
+	allowanceSlot, found, err := c.findAllowanceSlot(ctx, tokenC)
+	if err != nil {
+		return
+	}
+	if !found {
+		report.SellError = "allowance slot not found, sell not simulated"
+		return
+	}
+
+	path := []web3.Address{tokenC.Address, c.Wrapped}
+	resp, err := c.Router.CallContext(ctx, "getAmountsOut", web3.Latest, amount, path)
+	if err != nil {
+		err = fmt.Errorf("getAmountsOut: %w", err)
+		return
+	}
+	amounts, _ := resp["amounts"].([]*big.Int)
+	if len(amounts) != 2 {
+		err = fmt.Errorf("getAmountsOut: bad amounts %v", resp["amounts"])
+		return
+	}
+
+	override := contract.StateOverride{}.
+		SetBalance(c.Holder, big.NewInt(1e18)).
+		SetStorage(tokenC.Address, mappingSlot(addressWord(c.Holder), uintWord(slot), vyper), uintWord(amount)).
+		SetStorage(tokenC.Address, allowanceSlot, uintWord(MaxUint256))
+	deadline := big.NewInt(1 << 40)
+	sellBps, reverted, err := maxBps(amounts[1], func(min *big.Int) (*contract.RevertError, error) {
+		tx := c.Router.SwapExactTokensForETHSupportingFeeOnTransferTokens(amount, min, path, c.Holder, deadline)
+		_, reverted, err := c.simulate(ctx, tx, override)
+		return reverted, err
+	})
+	if err != nil {
+		err = fmt.Errorf("simulate sell: %w", err)
+		return
+	}
+	if reverted != nil {
+		report.SellReverts = true
+		report.SellError = reverted.Error()
+		return
+	}
+	report.SellTax = 1 - float64(sellBps)/bps
+	return
+}
+
+func (c *TokenChecker) checkCode(ctx context.Context, tokenC *contract.Contract, report *RiskReport) (err error) {
+	resp, callErr := tokenC.CallContext(ctx, "owner", web3.Latest)
+	if callErr == nil {
+		report.Owner, _ = resp["0"].(web3.Address)
+		report.Renounced = report.Owner == web3.Address{} || report.Owner == web3.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	}
+
+	found := map[string]bool{}
+	if eth, ok := c.Router.Provider.(*jsonrpc.Eth); ok {
+		impl, implErr := abis.Implementation(ctx, eth.Client, tokenC.Address)
+		report.IsProxy = implErr == nil && impl != (web3.Address{})
+
+		var code string
+		err = contract.WithContext(ctx, func() (err error) {
+			code, err = eth.GetCode(tokenC.Address, web3.Latest)
+			return
+		})
+		if err != nil {
+			err = fmt.Errorf("eth.GetCode: %w", err)
+			return
+		}
+		bs, _ := hex.DecodeString(strings.TrimPrefix(code, "0x"))
+		for _, sel := range Push4Selectors(bs) {
+			if sig, ok := riskySelectors[sel]; ok && !found[sig] {
+				found[sig] = true
+				report.Functions = append(report.Functions, &RiskFunction{Signature: sig, Category: riskySignatures[sig], Source: "bytecode"})
+			}
+		}
+	}
+
+	if c.Abis != nil {
+		a, abiErr := c.Abis.Resolve(ctx, abis.Key{Chain: c.Chain, Address: tokenC.Address}, nil)
+		if abiErr == nil {
+			for _, m := range a.Methods {
+				sig := m.Sig()
+				if found[sig] || m.Const {
+					continue
+				}
+				category, ok := riskySignatures[sig]
+				if !ok {
+					category, ok = riskyName(m.Name)
+				}
+				if ok {
+					found[sig] = true
+					report.Functions = append(report.Functions, &RiskFunction{Signature: sig, Category: category, Source: "abi"})
+				}
+			}
+		}
+	}
+	sort.Slice(report.Functions, func(i, j int) bool {
+		return report.Functions[i].Signature < report.Functions[j].Signature
+	})
+	return
+}
+
+func riskyName(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	if !strings.HasPrefix(lower, "set") && !strings.HasPrefix(lower, "add") && !strings.HasPrefix(lower, "update") &&
+		!strings.HasPrefix(lower, "enable") && !strings.HasPrefix(lower, "mint") && !strings.HasPrefix(lower, "pause") &&
+		!strings.HasPrefix(lower, "upgrade") && !strings.HasPrefix(lower, "blacklist") {
+		return "", false
+	}
+	for key, category := range riskyNames {
+		if strings.Contains(lower, key) {
+			return category, true
+		}
+	}
+	return "", false
+}
+
+// Push4Selectors returns the 4 byte values pushed by PUSH4 in code, where dispatchers keep selectors
+func Push4Selectors(code []byte) (selectors [][4]byte) {
+	seen := map[[4]byte]bool{}
+	for i := 0; i < len(code); i++ {
+		op := code[i]
+		if op == 0x63 && i+4 < len(code) {
+			var sel [4]byte
+			copy(sel[:], code[i+1:i+5])
+			if !seen[sel] {
+				seen[sel] = true
+				selectors = append(selectors, sel)
+			}
+		}
+		// skip the data of PUSH1 to PUSH32
+		if op >= 0x60 && op <= 0x7f {
+			i += int(op - 0x5f)
+		}
+	}
+	return
+}
+
+func (r *RiskReport) assess(highTax float64) {
+	if !r.BuyReverts && r.SellReverts {
+		r.Honeypot = true
+		r.Risks = append(r.Risks, "sell reverts: "+r.SellError)
+	}
+	if r.BuyReverts {
+		r.Risks = append(r.Risks, "buy reverts: "+r.BuyError)
+	}
+	if r.BuyTax > highTax {
+		r.Risks = append(r.Risks, fmt.Sprintf("buy tax %.2f%%", r.BuyTax*100))
+	}
+	if r.SellTax > highTax {
+		r.Risks = append(r.Risks, fmt.Sprintf("sell tax %.2f%%", r.SellTax*100))
+	}
+	if r.SellTax < 0 && !r.SellReverts {
+		r.Risks = append(r.Risks, r.SellError)
+	}
+	if r.IsProxy {
+		r.Risks = append(r.Risks, "upgradeable proxy")
+	}
+	if r.Renounced {
+		return
+	}
+	categories := map[string]bool{}
+	for _, f := range r.Functions {
+		categories[f.Category] = true
+	}
+	var names []string
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+	for _, category := range names {
+		r.Risks = append(r.Risks, "owner can "+category+" functions")
+	}
+}
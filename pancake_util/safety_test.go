@@ -0,0 +1,67 @@
+package pancake_util_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"goutil/pancake_util"
+	bscContract "goutil/web3_util/bsc/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+// buyers runs Check twice and returns who the buys of each check were simulated from
+func buyers(t *testing.T, holder web3.Address) (from [2][]web3.Address) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	i := 0
+	node.Mock(routerAddr, bscContract.PancakeRouterAbi).
+		Return("getAmountsOut", []*big.Int{big.NewInt(1e17), big.NewInt(1000)}).
+		On("swapExactETHForTokensSupportingFeeOnTransferTokens", func(call *rpctest.Call) ([]interface{}, error) {
+			from[i] = append(from[i], call.From)
+			return nil, rpctest.Revert("TRANSFER_FAILED")
+		})
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := pancake_util.NewTokenChecker(bscContract.NewPancakeRouter(routerAddr, client.Eth()), wrapped)
+	c.Holder = holder
+	for i = range from {
+		// the token is not mocked, only the buy matters
+		c.Check(context.Background(), tokenA)
+		if len(from[i]) == 0 {
+			t.Fatal("no buy simulated")
+		}
+	}
+	if c.Holder != holder {
+		t.Fatalf("Holder changed to %s", c.Holder)
+	}
+	return
+}
+
+func TestCheckRandomHolder(t *testing.T) {
+	from := buyers(t, web3.Address{})
+	for _, check := range from {
+		for _, addr := range check {
+			if addr != check[0] || addr == (web3.Address{}) {
+				t.Fatalf("buys of one check from %v", check)
+			}
+		}
+	}
+	if from[0][0] == from[1][0] {
+		t.Fatalf("both checks bought from %s", from[0][0])
+	}
+
+	holder := web3.HexToAddress("0x00000000000000000000000000000000000000d1")
+	for _, check := range buyers(t, holder) {
+		for _, addr := range check {
+			if addr != holder {
+				t.Fatalf("bought from %s, want the Holder set", addr)
+			}
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package pancake_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	bscContract "goutil/web3_util/bsc/contract"
+	"goutil/web3_util/contract"
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+const erc20SwapAbiStr = `[{"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"name":"approve","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"}]`
+
+var erc20SwapAbi = abi.MustNewABI(erc20SwapAbiStr)
+
+// Native stands for the native coin, BNB or ETH, in a SwapRequest
+var Native = web3.HexToAddress("0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE")
+
+var MaxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+var (
+	ErrNoSwap   = errors.New("no Swap log in receipt")
+	ErrTxFailed = errors.New("transaction failed")
+)
+
+// SwapRequest swaps exactly AmountIn, or for exactly AmountOut when AmountIn is nil.
+// TokenIn or TokenOut may be Native.
+type SwapRequest struct {
+	TokenIn   web3.Address
+	TokenOut  web3.Address
+	AmountIn  *big.Int
+	AmountOut *big.Int
+	// Path, when set, is used instead of a route found by the Swapper
+	Path []web3.Address
+	// To receives the output, the sender when zero
+	To web3.Address
+	// SlippageBps and Deadline override those of the Swapper when set
+	SlippageBps int64
+	Deadline    time.Duration
+	// FeeOnTransfer uses the SupportingFeeOnTransferTokens methods, exact input only.
+	// Swap lowers the minimum output by the taxes it measures simulating the swap.
+	FeeOnTransfer bool
+}
+
+// SwapQuote is what a swap is expected to do, AmountIn and AmountOut being the limits given to the router
+type SwapQuote struct {
+	Method    string
+	Path      []web3.Address
+	Amounts   []*big.Int
+	AmountIn  *big.Int
+	AmountOut *big.Int
+	ExactIn   bool
+	Deadline  *big.Int
+}
+
+// SwapResult is an executed swap, the amounts coming from the receipt
+type SwapResult struct {
+	Quote     *SwapQuote
+	Tx        *contract.Tx
+	Approve   *contract.Tx
+	AmountIn  *big.Int
+	AmountOut *big.Int
+	Swaps     []*SwapLog
+}
+
+// SwapLog is a Swap event of a pair
+type SwapLog struct {
+	Pair       web3.Address
+	Sender     web3.Address
+	To         web3.Address
+	Amount0In  *big.Int
+	Amount1In  *big.Int
+	Amount0Out *big.Int
+	Amount1Out *big.Int
+}
+
+// Swapper quotes and sends swaps through a uniswap v2 router
+type Swapper struct {
+	Router *bscContract.PancakeRouter
+	// Wrapped is the WETH of the router, standing for Native in paths
+	Wrapped web3.Address
+	// Signer signs the approve and swap transactions, and receives the output by default
+	Signer  signer.Signer
+	ChainID uint64
+	// Quoter, when set, finds the route of requests without Path
+	Quoter      *Quoter
+	MaxHops     int
+	SlippageBps int64
+	Deadline    time.Duration
+	// ApproveMax approves MaxUint256 rather than the amount needed
+	ApproveMax bool
+}
+
+func NewSwapper(router *bscContract.PancakeRouter, wrapped web3.Address, s signer.Signer) *Swapper {
+	return &Swapper{
+		Router:      router,
+		Wrapped:     wrapped,
+		Signer:      s,
+		MaxHops:     3,
+		SlippageBps: 50,
+		Deadline:    20 * time.Minute,
+		ApproveMax:  true,
+	}
+}
+
+func (s *Swapper) SetQuoter(q *Quoter) *Swapper {
+	s.Quoter = q
+	return s
+}
+
+func (s *Swapper) SetChainID(id uint64) *Swapper {
+	s.ChainID = id
+	return s
+}
+
+func (s *Swapper) SetSlippageBps(bps int64) *Swapper {
+	s.SlippageBps = bps
+	return s
+}
+
+func (s *Swapper) token(addr web3.Address) web3.Address {
+	if addr == Native {
+		return s.Wrapped
+	}
+	return addr
+}
+
+func (s *Swapper) path(req *SwapRequest) (path []web3.Address, err error) {
+	if len(req.Path) > 0 {
+		for _, token := range req.Path {
+			path = append(path, s.token(token))
+		}
+		return
+	}
+	tokenIn, tokenOut := s.token(req.TokenIn), s.token(req.TokenOut)
+	if s.Quoter == nil {
+		return []web3.Address{tokenIn, tokenOut}, nil
+	}
+	var quote *Quote
+	if req.AmountIn != nil {
+		quote, err = s.Quoter.BestRouteExactIn(req.AmountIn, tokenIn, tokenOut, s.MaxHops)
+	} else {
+		quote, err = s.Quoter.BestRouteExactOut(req.AmountOut, tokenIn, tokenOut, s.MaxHops)
+	}
+	if err != nil {
+		return
+	}
+	return quote.Path, nil
+}
+
+// Quote asks the router what req would give, and applies slippage and deadline
+func (s *Swapper) Quote(ctx context.Context, req *SwapRequest) (quote *SwapQuote, err error) {
+	if (req.AmountIn == nil) == (req.AmountOut == nil) {
+		err = fmt.Errorf("exactly one of AmountIn and AmountOut must be set")
+		return
+	}
+	if req.FeeOnTransfer && req.AmountIn == nil {
+		err = fmt.Errorf("fee on transfer tokens can only be swapped for an exact input")
+		return
+	}
+	if req.TokenIn == Native && req.TokenOut == Native {
+		err = fmt.Errorf("native to native swap")
+		return
+	}
+	path, err := s.path(req)
+	if err != nil {
+		err = fmt.Errorf("s.path: %w", err)
+		return
+	}
+
+	slippage := s.SlippageBps
+	if req.SlippageBps > 0 {
+		slippage = req.SlippageBps
+	}
+	deadline := s.Deadline
+	if req.Deadline > 0 {
+		deadline = req.Deadline
+	}
+	quote = &SwapQuote{Path: path, ExactIn: req.AmountIn != nil, Deadline: big.NewInt(time.Now().Add(deadline).Unix())}
+
+	method, amount := "getAmountsIn", req.AmountOut
+	if quote.ExactIn {
+		method, amount = "getAmountsOut", req.AmountIn
+	}
+	resp, err := s.Router.CallContext(ctx, method, web3.Latest, amount, path)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", method, err)
+		return
+	}
+	quote.Amounts, _ = resp["amounts"].([]*big.Int)
+	if len(quote.Amounts) != len(path) {
+		err = fmt.Errorf("%s: bad amounts %v", method, resp["amounts"])
+		return
+	}
+
+	if quote.ExactIn {
+		quote.AmountIn = req.AmountIn
+		quote.AmountOut = applyBps(quote.Amounts[len(path)-1], bps-slippage)
+	} else {
+		quote.AmountIn = applyBps(quote.Amounts[0], bps+slippage)
+		quote.AmountOut = req.AmountOut
+	}
+	quote.Method = swapMethod(req.TokenIn == Native, req.TokenOut == Native, quote.ExactIn, req.FeeOnTransfer)
+	return
+}
+
+// applyBps returns n * bps / 10000
+func applyBps(n *big.Int, b int64) *big.Int {
+	out := new(big.Int).Mul(n, big.NewInt(b))
+	return out.Quo(out, big.NewInt(bps))
+}
+
+func swapMethod(nativeIn, nativeOut, exactIn, feeOnTransfer bool) string {
+	var method string
+	switch {
+	case nativeIn && exactIn:
+		method = "swapExactETHForTokens"
+	case nativeIn:
+		method = "swapETHForExactTokens"
+	case nativeOut && exactIn:
+		method = "swapExactTokensForETH"
+	case nativeOut:
+		method = "swapTokensForExactETH"
+	case exactIn:
+		method = "swapExactTokensForTokens"
+	default:
+		method = "swapTokensForExactTokens"
+	}
+	if feeOnTransfer {
+		method += "SupportingFeeOnTransferTokens"
+	}
+	return method
+}
+
+func (s *Swapper) tx(quote *SwapQuote, to web3.Address) *contract.Tx {
+	r := s.Router
+	var tx *contract.Tx
+	switch quote.Method {
+	case "swapExactETHForTokens":
+		tx = r.SwapExactETHForTokens(quote.AmountOut, quote.Path, to, quote.Deadline).SetValue(quote.AmountIn)
+	case "swapExactETHForTokensSupportingFeeOnTransferTokens":
+		tx = r.SwapExactETHForTokensSupportingFeeOnTransferTokens(quote.AmountOut, quote.Path, to, quote.Deadline).SetValue(quote.AmountIn)
+	case "swapETHForExactTokens":
+		tx = r.SwapETHForExactTokens(quote.AmountOut, quote.Path, to, quote.Deadline).SetValue(quote.AmountIn)
+	case "swapExactTokensForETH":
+		tx = r.SwapExactTokensForETH(quote.AmountIn, quote.AmountOut, quote.Path, to, quote.Deadline)
+	case "swapExactTokensForETHSupportingFeeOnTransferTokens":
+		tx = r.SwapExactTokensForETHSupportingFeeOnTransferTokens(quote.AmountIn, quote.AmountOut, quote.Path, to, quote.Deadline)
+	case "swapTokensForExactETH":
+		tx = r.SwapTokensForExactETH(quote.AmountOut, quote.AmountIn, quote.Path, to, quote.Deadline)
+	case "swapExactTokensForTokens":
+		tx = r.SwapExactTokensForTokens(quote.AmountIn, quote.AmountOut, quote.Path, to, quote.Deadline)
+	case "swapExactTokensForTokensSupportingFeeOnTransferTokens":
+		tx = r.SwapExactTokensForTokensSupportingFeeOnTransferTokens(quote.AmountIn, quote.AmountOut, quote.Path, to, quote.Deadline)
+	default:
+		tx = r.SwapTokensForExactTokens(quote.AmountOut, quote.AmountIn, quote.Path, to, quote.Deadline)
+	}
+	return tx.SetSigner(s.Signer).SetChainID(s.ChainID)
+}
+
+// Approve lets the router spend amount of token when its allowance is lower,
+// the approve transaction is returned once mined, nil when none was needed.
+// A non-zero allowance is first reset to 0, as tokens like USDT require.
+func (s *Swapper) Approve(ctx context.Context, token web3.Address, amount *big.Int) (tx *contract.Tx, err error) {
+	c := contract.NewContract(token, erc20SwapAbi, s.Router.Provider)
+	resp, err := c.CallContext(ctx, "allowance", web3.Latest, s.Signer.Address(), s.Router.Address)
+	if err != nil {
+		err = fmt.Errorf("allowance: %w", err)
+		return
+	}
+	allowance, _ := resp["0"].(*big.Int)
+	if allowance != nil && allowance.Cmp(amount) >= 0 {
+		return
+	}
+	if allowance != nil && allowance.Sign() > 0 {
+		if _, err = s.approve(ctx, c, new(big.Int)); err != nil {
+			err = fmt.Errorf("reset allowance: %w", err)
+			return
+		}
+	}
+	if s.ApproveMax {
+		amount = MaxUint256
+	}
+	return s.approve(ctx, c, amount)
+}
+
+func (s *Swapper) approve(ctx context.Context, c *contract.Contract, amount *big.Int) (tx *contract.Tx, err error) {
+	tx = contract.NewTx().
+		SetMethod("approve").
+		AddArgs(s.Router.Address, amount).
+		SetContract(c).
+		SetSigner(s.Signer).
+		SetChainID(s.ChainID)
+	if err = tx.DoAndWaitContext(ctx); err != nil {
+		err = fmt.Errorf("approve: %w", err)
+		return
+	}
+	if tx.Status != 1 {
+		err = fmt.Errorf("approve %s: %w", tx.Hash, ErrTxFailed)
+		return
+	}
+	return
+}
+
+// applyTax lowers the minimum output of a fee on transfer swap by the taxes of the tokens,
+// which getAmountsOut does not know of. They are measured by simulating the swap with
+// higher and higher minimum outputs, the allowance must already be there.
+func (s *Swapper) applyTax(ctx context.Context, quote *SwapQuote, to web3.Address) (err error) {
+	expected := quote.Amounts[len(quote.Amounts)-1]
+	kept, reverted, err := maxBps(expected, func(min *big.Int) (*contract.RevertError, error) {
+		try := *quote
+		try.AmountOut = min
+		_, simErr := s.tx(&try, to).SimulateContext(ctx, web3.Latest)
+		var reverted *contract.RevertError
+		if errors.As(simErr, &reverted) {
+			return reverted, nil
+		}
+		return nil, simErr
+	})
+	if err != nil {
+		err = fmt.Errorf("simulate %s: %w", quote.Method, err)
+		return
+	}
+	if reverted != nil {
+		err = fmt.Errorf("simulate %s: %w", quote.Method, reverted)
+		return
+	}
+	quote.AmountOut = applyBps(quote.AmountOut, kept)
+	return
+}
+
+// Swap quotes req, approves the router when needed, sends the swap and waits for it
+func (s *Swapper) Swap(ctx context.Context, req *SwapRequest) (res *SwapResult, err error) {
+	quote, err := s.Quote(ctx, req)
+	if err != nil {
+		err = fmt.Errorf("s.Quote: %w", err)
+		return
+	}
+	res = &SwapResult{Quote: quote}
+
+	if req.TokenIn != Native {
+		res.Approve, err = s.Approve(ctx, quote.Path[0], quote.AmountIn)
+		if err != nil {
+			err = fmt.Errorf("s.Approve: %w", err)
+			return
+		}
+	}
+
+	to := req.To
+	if to == (web3.Address{}) {
+		to = s.Signer.Address()
+	}
+	if req.FeeOnTransfer {
+		if err = s.applyTax(ctx, quote, to); err != nil {
+			err = fmt.Errorf("s.applyTax: %w", err)
+			return
+		}
+	}
+	res.Tx = s.tx(quote, to)
+	if err = res.Tx.DoAndWaitContext(ctx); err != nil {
+		err = fmt.Errorf("%s: %w", quote.Method, err)
+		return
+	}
+	if res.Tx.Status != 1 {
+		err = fmt.Errorf("%s %s: %w", quote.Method, res.Tx.Hash, ErrTxFailed)
+		return
+	}
+
+	err = res.parse(s.Signer.Address(), to, req.TokenIn == Native, req.TokenOut == Native)
+	if err != nil {
+		err = fmt.Errorf("tx %s: %w", res.Tx.Hash, err)
+		return
+	}
+	return
+}
+
+// parse reads the executed amounts from the Transfer logs of the tokens in and out,
+// and from the Swap logs for the native coin
+func (res *SwapResult) parse(from, to web3.Address, nativeIn, nativeOut bool) (err error) {
+	path := res.Quote.Path
+	swapEvent := PairAbi.Events["Swap"]
+	transferEvent := erc20SwapAbi.Events["Transfer"]
+	var sent, received *big.Int
+	for _, log := range res.Tx.Receipt.Logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		switch log.Topics[0] {
+		case swapEvent.ID():
+			var args map[string]interface{}
+			args, err = abi.ParseLog(swapEvent.Inputs, log)
+			if err != nil {
+				err = fmt.Errorf("abi.ParseLog(Swap): %w", err)
+				return
+			}
+			swap := &SwapLog{Pair: log.Address}
+			swap.Sender, _ = args["sender"].(web3.Address)
+			swap.To, _ = args["to"].(web3.Address)
+			swap.Amount0In, _ = args["amount0In"].(*big.Int)
+			swap.Amount1In, _ = args["amount1In"].(*big.Int)
+			swap.Amount0Out, _ = args["amount0Out"].(*big.Int)
+			swap.Amount1Out, _ = args["amount1Out"].(*big.Int)
+			res.Swaps = append(res.Swaps, swap)
+		case transferEvent.ID():
+			var args map[string]interface{}
+			args, err = abi.ParseLog(transferEvent.Inputs, log)
+			if err != nil {
+				continue
+			}
+			value, _ := args["value"].(*big.Int)
+			if value == nil {
+				continue
+			}
+			if !nativeIn && log.Address == path[0] && args["from"] == from {
+				sent = add(sent, value)
+			}
+			if !nativeOut && log.Address == path[len(path)-1] && args["to"] == to {
+				received = add(received, value)
+			}
+		}
+	}
+	if len(res.Swaps) == 0 {
+		err = ErrNoSwap
+		return
+	}
+
+	first, last := res.Swaps[0], res.Swaps[len(res.Swaps)-1]
+	res.AmountIn = sent
+	if res.AmountIn == nil {
+		res.AmountIn = new(big.Int).Add(first.Amount0In, first.Amount1In)
+	}
+	res.AmountOut = received
+	if res.AmountOut == nil {
+		res.AmountOut = new(big.Int).Add(last.Amount0Out, last.Amount1Out)
+	}
+	return
+}
+
+func add(sum, n *big.Int) *big.Int {
+	if sum == nil {
+		return new(big.Int).Set(n)
+	}
+	return sum.Add(sum, n)
+}
@@ -0,0 +1,135 @@
+package pancake_util_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"goutil/pancake_util"
+	bscContract "goutil/web3_util/bsc/contract"
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+var (
+	routerAddr = web3.HexToAddress("0x00000000000000000000000000000000000000f1")
+	wrapped    = web3.HexToAddress("0x00000000000000000000000000000000000000f2")
+	pairAddr   = web3.HexToAddress("0x00000000000000000000000000000000000000f3")
+	tokenA     = web3.HexToAddress("0x00000000000000000000000000000000000000a1")
+	tokenB     = web3.HexToAddress("0x00000000000000000000000000000000000000b1")
+)
+
+func newSwapper(t *testing.T, node *rpctest.Server) *pancake_util.Swapper {
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := bscContract.NewPancakeRouter(routerAddr, client.Eth())
+	return pancake_util.NewSwapper(router, wrapped, signer.NewLocal(key)).SetChainID(node.ChainID)
+}
+
+// sentArgs decodes the arguments of the sent transaction i
+func sentArgs(t *testing.T, node *rpctest.Server, i int, method *abi.Method) map[string]interface{} {
+	args, err := abi.Decode(method.Inputs, node.Sent()[i].Tx.Input[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return args.(map[string]interface{})
+}
+
+func TestApproveResetsAllowance(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	node.Mock(tokenA, contract.Erc20Abi).Return("allowance", big.NewInt(5)).Return("approve", true)
+	sw := newSwapper(t, node)
+
+	if _, err := sw.Approve(context.Background(), tokenA, big.NewInt(10)); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Sent()) != 2 {
+		t.Fatalf("sent %d transactions, want 2", len(node.Sent()))
+	}
+	for _, sent := range node.Sent() {
+		if sent.Tx.From != sw.Signer.Address() {
+			t.Fatalf("approve signed by %s, want the swapper signer %s", sent.Tx.From, sw.Signer.Address())
+		}
+	}
+	approve := contract.Erc20Abi.Methods["approve"]
+	if amount := sentArgs(t, node, 0, approve)["amount"].(*big.Int); amount.Sign() != 0 {
+		t.Fatalf("first approve of %s, want 0", amount)
+	}
+	if amount := sentArgs(t, node, 1, approve)["amount"].(*big.Int); amount.Cmp(pancake_util.MaxUint256) != 0 {
+		t.Fatalf("second approve of %s, want MaxUint256", amount)
+	}
+}
+
+func TestApproveReverted(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	node.Mock(tokenA, contract.Erc20Abi).Return("allowance", big.NewInt(0)).Return("approve", true)
+	node.SetReverts(func(sent *rpctest.SentTx) bool { return true })
+
+	_, err := newSwapper(t, node).Approve(context.Background(), tokenA, big.NewInt(10))
+	if !errors.Is(err, pancake_util.ErrTxFailed) {
+		t.Fatalf("Approve() = %v, want ErrTxFailed", err)
+	}
+}
+
+// the token takes 10% of the output, which getAmountsOut does not show
+func TestSwapFeeOnTransfer(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	node.Mock(tokenA, contract.Erc20Abi).Return("allowance", pancake_util.MaxUint256)
+	node.Mock(routerAddr, bscContract.PancakeRouterAbi).
+		Return("getAmountsOut", []*big.Int{big.NewInt(1000), big.NewInt(1000)}).
+		On("swapExactTokensForTokensSupportingFeeOnTransferTokens", func(call *rpctest.Call) ([]interface{}, error) {
+			if call.Args["amountOutMin"].(*big.Int).Int64() > 900 {
+				return nil, rpctest.Revert("Pancake: INSUFFICIENT_OUTPUT_AMOUNT")
+			}
+			return nil, nil
+		})
+	sw := newSwapper(t, node)
+	node.SetReceiptLogs(func(sent *rpctest.SentTx) []*web3.Log {
+		swap := pancake_util.PairAbi.Events["Swap"]
+		data, err := abi.Encode([]interface{}{big.NewInt(1000), big.NewInt(0), big.NewInt(0), big.NewInt(900)},
+			abi.MustNewType("tuple(uint256 a,uint256 b,uint256 c,uint256 d)"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		to := sw.Signer.Address()
+		return []*web3.Log{{
+			Address: pairAddr,
+			Topics:  []web3.Hash{swap.ID(), web3.BytesToHash(routerAddr[:]), web3.BytesToHash(to[:])},
+			Data:    data,
+		}}
+	})
+
+	res, err := sw.Swap(context.Background(), &pancake_util.SwapRequest{
+		TokenIn: tokenA, TokenOut: tokenB, AmountIn: big.NewInt(1000), FeeOnTransfer: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 995 after the 0.5% slippage, kept at the 9009 bps that still gets 900
+	if res.Quote.AmountOut.Int64() != 896 {
+		t.Fatalf("amountOutMin %s, want 896", res.Quote.AmountOut)
+	}
+	args := sentArgs(t, node, 0, bscContract.PancakeRouterAbi.Methods["swapExactTokensForTokensSupportingFeeOnTransferTokens"])
+	if args["amountOutMin"].(*big.Int).Int64() != 896 {
+		t.Fatalf("sent amountOutMin %s, want 896", args["amountOutMin"])
+	}
+	if res.AmountOut.Int64() != 900 {
+		t.Fatalf("AmountOut %s, want 900", res.AmountOut)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/panyanyany/go-web3/abi"
+)
+
+type config struct {
+	Dir         string
+	Chain       string
+	Name        string
+	Package     string
+	Output      string
+	ContractPkg string
+}
+
+type param struct {
+	Name   string // go identifier
+	Key    string // key in the decoded map
+	GoType string
+}
+
+type method struct {
+	GoName  string
+	AbiName string
+	Inputs  []*param
+	Outputs []*param
+}
+
+type event struct {
+	GoName  string
+	AbiName string
+	Fields  []*param
+	// Unnamed events have inputs without a name, ParseLog would decode them all under ""
+	Unnamed bool
+}
+
+// reserved are the identifiers used inside the generated function bodies
+var reserved = map[string]bool{
+	"r": true, "block": true, "resp": true, "ok": true, "err": true, "log": true, "ev": true, "event": true,
+}
+
+func goType(t *abi.Type) string {
+	switch t.Kind() {
+	case abi.KindAddress:
+		return "web3.Address"
+	case abi.KindString:
+		return "string"
+	case abi.KindBool:
+		return "bool"
+	case abi.KindInt, abi.KindUInt:
+		return t.GoType().String()
+	case abi.KindFixedBytes:
+		return fmt.Sprintf("[%d]byte", t.Size())
+	case abi.KindBytes:
+		return "[]byte"
+	case abi.KindSlice:
+		return "[]" + goType(t.Elem())
+	case abi.KindArray:
+		return fmt.Sprintf("[%d]%s", t.Size(), goType(t.Elem()))
+	case abi.KindTuple:
+		return "map[string]interface{}"
+	default:
+		return "interface{}"
+	}
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// camel turns snake_case and _prefixed names into camelCase
+func camel(s string) string {
+	parts := strings.Split(strings.Trim(s, "_"), "_")
+	res := ""
+	for i, p := range parts {
+		if i != 0 {
+			p = upperFirst(p)
+		}
+		res += p
+	}
+	return res
+}
+
+func paramName(name string, fallback string, used map[string]bool) string {
+	n := lowerFirst(camel(name))
+	if n == "" || used[n] || reserved[n] {
+		n = fallback
+	}
+	if token.IsKeyword(n) {
+		n += "_"
+	}
+	used[n] = true
+	return n
+}
+
+func buildMethod(name string, m *abi.Method) *method {
+	res := &method{GoName: upperFirst(camel(name)), AbiName: name}
+	used := map[string]bool{}
+	for i, elem := range m.Inputs.TupleElems() {
+		res.Inputs = append(res.Inputs, &param{
+			Name:   paramName(elem.Name, fmt.Sprintf("arg%d", i), used),
+			GoType: goType(elem.Elem),
+		})
+	}
+	if m.Outputs == nil {
+		return res
+	}
+	for i, elem := range m.Outputs.TupleElems() {
+		key := elem.Name
+		if key == "" {
+			key = fmt.Sprint(i)
+		}
+		res.Outputs = append(res.Outputs, &param{
+			Name:   paramName(elem.Name, fmt.Sprintf("out%d", i), used),
+			Key:    key,
+			GoType: goType(elem.Elem),
+		})
+	}
+	return res
+}
+
+func buildEvent(name string, e *abi.Event) *event {
+	res := &event{GoName: upperFirst(camel(name)), AbiName: name}
+	used := map[string]bool{"Raw": true}
+	for i, elem := range e.Inputs.TupleElems() {
+		n := upperFirst(camel(elem.Name))
+		if n == "" || used[n] {
+			n = fmt.Sprintf("Arg%d", i)
+		}
+		used[n] = true
+		key := elem.Name
+		if key == "" {
+			key = fmt.Sprintf("arg%d", i)
+			res.Unnamed = true
+		}
+		res.Fields = append(res.Fields, &param{
+			Name:   n,
+			Key:    key,
+			GoType: goType(elem.Elem),
+		})
+	}
+	return res
+}
+
+func gen(cfg *config, abiStr string) (src []byte, err error) {
+	abiObj, err := abi.NewABI(abiStr)
+	if err != nil {
+		err = fmt.Errorf("abi.NewABI: %w", err)
+		return
+	}
+
+	var calls, txs []*method
+	for _, name := range sortedKeys(abiObj.Methods) {
+		m := abiObj.Methods[name]
+		if m.Const {
+			calls = append(calls, buildMethod(name, m))
+		} else {
+			txs = append(txs, buildMethod(name, m))
+		}
+	}
+	var events []*event
+	for _, name := range sortedEventKeys(abiObj.Events) {
+		events = append(events, buildEvent(name, abiObj.Events[name]))
+	}
+
+	input := map[string]interface{}{
+		"Config": cfg,
+		"Calls":  calls,
+		"Txs":    txs,
+		"Events": events,
+	}
+
+	var b bytes.Buffer
+	if err = tmpl.Execute(&b, input); err != nil {
+		err = fmt.Errorf("tmpl.Execute: %w", err)
+		return
+	}
+	src, err = format.Source(b.Bytes())
+	if err != nil {
+		err = fmt.Errorf("format.Source: %w", err)
+		return
+	}
+	return
+}
+
+func sortedKeys(m map[string]*abi.Method) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func sortedEventKeys(m map[string]*abi.Event) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+var tmpl = template.Must(template.New("abigen").Parse(`// Code generated by goutil/web3_util/abigen. DO NOT EDIT.
+// Source: {{.Config.Dir}}/{{.Config.Chain}}/{{.Config.Name}}/abi.json
+
+package {{.Config.Package}}
+
+import (
+	"fmt"
+	"math/big"
+
+	"{{.Config.ContractPkg}}"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+var (
+	_ = big.NewInt
+	_ = fmt.Errorf
+	_ = abi.NewTupleType
+)
+
+// {{.Config.Name}} wraps contract.Contract with typed methods
+type {{.Config.Name}} struct {
+	*contract.Contract
+}
+
+// New{{.Config.Name}} wraps c, the abi is loaded from resources when c has none
+func New{{.Config.Name}}(c *contract.Contract) (*{{.Config.Name}}, error) {
+	if c.Abi == nil {
+		if err := c.LoadAbi(); err != nil {
+			return nil, fmt.Errorf("c.LoadAbi: %w", err)
+		}
+	}
+	return &{{.Config.Name}}{c}, nil
+}
+
+// calls
+{{range .Calls}}
+// {{.GoName}} calls {{.AbiName}}
+func (r *{{$.Config.Name}}) {{.GoName}}(block web3.BlockNumber{{range .Inputs}}, {{.Name}} {{.GoType}}{{end}}) ({{range .Outputs}}{{.Name}} {{.GoType}}, {{end}}err error) {
+	resp, err := r.Contract.Call("{{.AbiName}}", block{{range .Inputs}}, {{.Name}}{{end}})
+	if err != nil {
+		err = fmt.Errorf("r.Contract.Call({{.AbiName}}): %w", err)
+		return
+	}
+{{- $m := .}}{{if .Outputs}}
+	var ok bool{{end}}
+{{- range .Outputs}}
+	{{.Name}}, ok = resp["{{.Key}}"].({{.GoType}})
+	if !ok {
+		err = fmt.Errorf("{{$m.AbiName}}: bad output {{.Key}}: %T", resp["{{.Key}}"])
+		return
+	}
+{{- end}}
+	return
+}
+{{end}}
+// txs
+{{range .Txs}}
+// {{.GoName}} builds a {{.AbiName}} transaction
+func (r *{{$.Config.Name}}) {{.GoName}}({{range $i, $p := .Inputs}}{{if $i}}, {{end}}{{$p.Name}} {{$p.GoType}}{{end}}) *contract.Tx {
+	return contract.NewTx().
+		SetMethod("{{.AbiName}}").
+		AddArgs({{range $i, $p := .Inputs}}{{if $i}}, {{end}}{{$p.Name}}{{end}}).
+		SetContract(r.Contract)
+}
+{{end}}
+// events
+{{range .Events}}
+// {{$.Config.Name}}{{.GoName}}Event is the {{.AbiName}} event of {{$.Config.Name}}
+type {{$.Config.Name}}{{.GoName}}Event struct {
+{{- range .Fields}}
+	{{.Name}} {{.GoType}}
+{{- end}}
+	Raw *web3.Log
+}
+
+// {{.GoName}}EventID returns topic[0] of {{.AbiName}}
+func (r *{{$.Config.Name}}) {{.GoName}}EventID() web3.Hash {
+	return r.Contract.Abi.Events["{{.AbiName}}"].ID()
+}
+
+// Parse{{.GoName}}Event decodes a {{.AbiName}} log
+func (r *{{$.Config.Name}}) Parse{{.GoName}}Event(log *web3.Log) (ev *{{$.Config.Name}}{{.GoName}}Event, err error) {
+{{- if .Unnamed}}
+	abiEvent, ok := r.Contract.Abi.Events["{{.AbiName}}"]
+	if !ok {
+		err = fmt.Errorf("event {{.AbiName}} not found")
+		return
+	}
+	// unnamed inputs are decoded as arg0, arg1...
+	var inputs []*abi.TupleElem
+	for i, elem := range abiEvent.Inputs.TupleElems() {
+		name := elem.Name
+		if name == "" {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		inputs = append(inputs, &abi.TupleElem{Name: name, Elem: elem.Elem, Indexed: elem.Indexed})
+	}
+	event := abi.NewEventFromType(abiEvent.Name, abi.NewTupleType(inputs))
+{{- else}}
+	event, ok := r.Contract.Event("{{.AbiName}}")
+	if !ok {
+		err = fmt.Errorf("event {{.AbiName}} not found")
+		return
+	}
+{{- end}}
+	resp, err := event.ParseLog(log)
+	if err != nil {
+		err = fmt.Errorf("event.ParseLog({{.AbiName}}): %w", err)
+		return
+	}
+{{- $e := .}}
+	ev = &{{$.Config.Name}}{{.GoName}}Event{Raw: log}
+{{- range .Fields}}
+	ev.{{.Name}}, ok = resp["{{.Key}}"].({{.GoType}})
+	if !ok {
+		err = fmt.Errorf("{{$e.AbiName}}: bad field {{.Key}}: %T", resp["{{.Key}}"])
+		return
+	}
+{{- end}}
+	return
+}
+{{end}}`))
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func testConfig() *config {
+	return &config{Dir: "resources", Chain: "bsc", Name: "Sample", Package: "sample", ContractPkg: "goutil/web3_util/contract"}
+}
+
+// TestGen compares the wrapper of testdata/Sample.json, which has go keywords, unnamed event
+// inputs and tuple[] outputs, to testdata/Sample.golden. go test -update rewrites it.
+func TestGen(t *testing.T) {
+	abiStr, err := ioutil.ReadFile(filepath.Join("testdata", "Sample.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := gen(testConfig(), string(abiStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "Sample.golden")
+	if *update {
+		if err = ioutil.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Fatalf("gen() differs from %s, run go test -update and review the diff:\n%s", golden, src)
+	}
+}
+
+// TestGenCompiles builds the golden file as a package of this module
+func TestGenCompiles(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "Sample.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// inside the module so that the generated imports resolve
+	dir, err := ioutil.TempDir(".", "gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "sample_gen.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(goBin, "vet", "./"+filepath.Base(dir)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go vet: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,63 @@
+// Command abigen generates typed wrappers on top of contract.Contract and contract.Tx
+// from resources/<chain>/<name>/abi.json.
+//
+// Usage in a package:
+//
+//	//go:generate go run goutil/web3_util/abigen -chain bsc -name PancakeRouter -pkg contract
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	cfg := &config{}
+	flag.StringVar(&cfg.Dir, "dir", "resources", "directory holding <chain>/<name>/abi.json")
+	flag.StringVar(&cfg.Chain, "chain", "bsc", "chain name")
+	flag.StringVar(&cfg.Name, "name", "", "contract name, also the name of the generated type")
+	flag.StringVar(&cfg.Package, "pkg", "contract", "package of the generated file")
+	flag.StringVar(&cfg.Output, "out", "", "output file, default to <name>_gen.go")
+	flag.StringVar(&cfg.ContractPkg, "contract-pkg", "goutil/web3_util/contract", "import path of the contract package")
+	flag.Parse()
+
+	if cfg.Name == "" {
+		fmt.Fprintln(os.Stderr, "abigen: -name is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if cfg.Output == "" {
+		cfg.Output = strings.ToLower(cfg.Name) + "_gen.go"
+	}
+
+	if err := run(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "abigen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg *config) (err error) {
+	abiPath := filepath.Join(cfg.Dir, cfg.Chain, cfg.Name, "abi.json")
+	bs, err := ioutil.ReadFile(abiPath)
+	if err != nil {
+		err = fmt.Errorf("ioutil.ReadFile: %w", err)
+		return
+	}
+
+	src, err := gen(cfg, string(bs))
+	if err != nil {
+		err = fmt.Errorf("gen(%v): %w", abiPath, err)
+		return
+	}
+
+	err = ioutil.WriteFile(cfg.Output, src, 0644)
+	if err != nil {
+		err = fmt.Errorf("ioutil.WriteFile: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package abis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+// ImplementationSlot is the EIP-1967 slot, bytes32(uint256(keccak256('eip1967.proxy.implementation')) - 1)
+const ImplementationSlot = "0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"
+
+type contextCaller interface {
+	CallContext(ctx context.Context, method string, out interface{}, params ...interface{}) error
+}
+
+func callContext(ctx context.Context, client jsonrpc.IClient, method string, out interface{}, params ...interface{}) error {
+	if c, ok := client.(contextCaller); ok {
+		return c.CallContext(ctx, method, out, params...)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Call(method, out, params...)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Implementation returns the address in the EIP-1967 implementation slot of addr, zero when it is not a proxy
+func Implementation(ctx context.Context, client jsonrpc.IClient, addr web3.Address) (impl web3.Address, err error) {
+	var out string
+	err = callContext(ctx, client, "eth_getStorageAt", &out, addr, ImplementationSlot, "latest")
+	if err != nil {
+		err = fmt.Errorf("eth_getStorageAt: %w", err)
+		return
+	}
+	out = strings.TrimPrefix(out, "0x")
+	if len(out) < 40 {
+		out = strings.Repeat("0", 40-len(out)) + out
+	}
+	impl = web3.HexToAddress("0x" + out[len(out)-40:])
+	return
+}
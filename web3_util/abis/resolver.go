@@ -0,0 +1,247 @@
+package abis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+// ErrNotFound is returned by a Source that has no ABI for a key
+var ErrNotFound = errors.New("abi not found")
+
+// Key identifies the ABI of a contract, Name is optional
+type Key struct {
+	Chain   string
+	Name    string
+	Address web3.Address
+}
+
+func (k Key) String() string {
+	if k.Name != "" {
+		return fmt.Sprintf("%s/%s(%s)", k.Chain, k.Name, k.Address)
+	}
+	return fmt.Sprintf("%s/%s", k.Chain, k.Address)
+}
+
+// Source gives the json ABI of a contract, or ErrNotFound
+type Source interface {
+	Abi(ctx context.Context, key Key) ([]byte, error)
+}
+
+// Resolver finds ABIs in local Sources, then in Cache, then through Fetchers whose
+// answers are kept in Cache. With a client, a EIP-1967 proxy gets the ABI of its
+// implementation merged in.
+type Resolver struct {
+	Sources  []Source
+	Cache    *Dir
+	Fetchers []Source
+	// Explorer, when set, is also used as the last of Fetchers
+	Explorer *Explorer
+	// Remote lets Load and Resolve ask Fetchers and Explorer, Download always does
+	Remote bool
+
+	lock   sync.Mutex
+	loaded map[loadedKey][]byte
+}
+
+// loadedKey tells apart the ABIs of a proxy before and after an upgrade
+type loadedKey struct {
+	Key
+	proxy bool
+	impl  web3.Address
+}
+
+func NewResolver(sources ...Source) *Resolver {
+	return &Resolver{Sources: sources}
+}
+
+// Default reads resources/<chain>/<name>/abi.json, set Default.Remote to also ask
+// the explorers registered by the chains package
+var Default = &Resolver{
+	Sources:  []Source{NewDir("resources")},
+	Explorer: NewExplorer(),
+}
+
+func (r *Resolver) fetchers() []Source {
+	if r.Explorer == nil {
+		return r.Fetchers
+	}
+	return append(append([]Source{}, r.Fetchers...), r.Explorer)
+}
+
+// Resolve returns the parsed ABI of key, client may be nil to skip proxy detection
+func (r *Resolver) Resolve(ctx context.Context, key Key, client jsonrpc.IClient) (a *abi.ABI, err error) {
+	bs, err := r.Load(ctx, key, client)
+	if err != nil {
+		return
+	}
+	a, err = abi.NewABI(string(bs))
+	if err != nil {
+		err = fmt.Errorf("abi.NewABI(%v): %w", key, err)
+		return
+	}
+	return
+}
+
+// Load returns the json ABI of key, see Resolve.
+// With a client the implementation is read on every call, an upgraded proxy gets the new ABI.
+func (r *Resolver) Load(ctx context.Context, key Key, client jsonrpc.IClient) (bs []byte, err error) {
+	lk := loadedKey{Key: key, proxy: client != nil}
+	if client != nil {
+		lk.impl, err = Implementation(ctx, client, key.Address)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// a node without eth_getStorageAt still gets the ABI of the proxy, it is not kept
+			seelog.Warnf("Implementation(%v): %v", key, err)
+			return r.find(ctx, key, true)
+		}
+	}
+	r.lock.Lock()
+	bs, ok := r.loaded[lk]
+	r.lock.Unlock()
+	if ok {
+		return
+	}
+
+	bs, err = r.find(ctx, key, true)
+	if err != nil {
+		return
+	}
+	if client != nil {
+		bs, err = r.withImplementation(ctx, key, lk.impl, bs)
+		if err != nil {
+			return
+		}
+	}
+
+	r.lock.Lock()
+	if r.loaded == nil {
+		r.loaded = map[loadedKey][]byte{}
+	}
+	r.loaded[lk] = bs
+	r.lock.Unlock()
+	return
+}
+
+// Download fetches the json ABI of key through the Fetchers only and keeps it in Cache
+func (r *Resolver) Download(ctx context.Context, key Key) (bs []byte, err error) {
+	return r.find(ctx, key, false)
+}
+
+func (r *Resolver) find(ctx context.Context, key Key, local bool) (bs []byte, err error) {
+	var sources []Source
+	if local {
+		sources = append(sources, r.Sources...)
+		if r.Cache != nil {
+			sources = append(sources, r.Cache)
+		}
+	}
+	for _, src := range sources {
+		bs, err = src.Abi(ctx, key)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, ErrNotFound) {
+			err = fmt.Errorf("%T.Abi(%v): %w", src, key, err)
+			return
+		}
+	}
+
+	if local && !r.Remote {
+		err = fmt.Errorf("%v: %w", key, ErrNotFound)
+		return
+	}
+	for _, src := range r.fetchers() {
+		bs, err = src.Abi(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("%T.Abi(%v): %w", src, key, err)
+			return
+		}
+		if r.Cache != nil {
+			if putErr := r.Cache.Put(key, bs); putErr != nil {
+				seelog.Warnf("abi cache %v: %v", key, putErr)
+			}
+		}
+		return
+	}
+	err = fmt.Errorf("%v: %w", key, ErrNotFound)
+	return
+}
+
+// withImplementation merges the ABI of impl, read from the EIP-1967 slot of key
+func (r *Resolver) withImplementation(ctx context.Context, key Key, impl web3.Address, bs []byte) (out []byte, err error) {
+	if impl == (web3.Address{}) || impl == key.Address {
+		return bs, nil
+	}
+	implBs, err := r.find(ctx, Key{Chain: key.Chain, Address: impl}, true)
+	if err != nil {
+		err = fmt.Errorf("implementation of %v: %w", key, err)
+		return
+	}
+	out, err = Merge(bs, implBs)
+	if err != nil {
+		err = fmt.Errorf("Merge(%v, %v): %w", key, impl, err)
+		return
+	}
+	return
+}
+
+// Merge appends the entries of others that base does not have, entries being
+// told apart by type, name and input types. The constructor of others is dropped.
+func Merge(base []byte, others ...[]byte) (out []byte, err error) {
+	var entries []map[string]interface{}
+	if err = json.Unmarshal(base, &entries); err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		seen[entryID(entry)] = true
+	}
+	for _, other := range others {
+		var more []map[string]interface{}
+		if err = json.Unmarshal(other, &more); err != nil {
+			err = fmt.Errorf("json.Unmarshal: %w", err)
+			return
+		}
+		for _, entry := range more {
+			id := entryID(entry)
+			if seen[id] || entry["type"] == "constructor" {
+				continue
+			}
+			seen[id] = true
+			entries = append(entries, entry)
+		}
+	}
+	return json.Marshal(entries)
+}
+
+func entryID(entry map[string]interface{}) string {
+	typ, _ := entry["type"].(string)
+	if typ == "" {
+		typ = "function"
+	}
+	name, _ := entry["name"].(string)
+	var types []string
+	inputs, _ := entry["inputs"].([]interface{})
+	for _, input := range inputs {
+		if m, ok := input.(map[string]interface{}); ok {
+			t, _ := m["type"].(string)
+			types = append(types, t)
+		}
+	}
+	return fmt.Sprintf("%s %s(%s)", typ, name, strings.Join(types, ","))
+}
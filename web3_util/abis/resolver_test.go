@@ -0,0 +1,131 @@
+package abis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"goutil/web3_util/abis"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+const (
+	proxyAbi = `[{"inputs":[],"name":"upgradeTo","outputs":[],"stateMutability":"nonpayable","type":"function"}]`
+	implAbi  = `[{"inputs":[],"name":"upgradeTo","outputs":[],"stateMutability":"nonpayable","type":"function"},` +
+		`{"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"}]`
+)
+
+var (
+	proxy = web3.HexToAddress("0x00000000000000000000000000000000000000aa")
+	impl  = web3.HexToAddress("0x00000000000000000000000000000000000000bb")
+)
+
+func newResolver(explorer *rpctest.Explorer) *abis.Resolver {
+	r := abis.NewResolver(abis.NewFS(fstest.MapFS{
+		"bsc/proxy/abi.json": {Data: []byte(proxyAbi)},
+	}))
+	r.Explorer = abis.NewExplorer()
+	r.Explorer.SetApi("bsc", explorer.URL, "")
+	r.Remote = true
+	return r
+}
+
+func TestResolveProxy(t *testing.T) {
+	node, explorer := rpctest.NewServer(), rpctest.NewExplorer()
+	defer node.Close()
+	defer explorer.Close()
+	node.SetStorage(proxy, web3.HexToHash(abis.ImplementationSlot), web3.BytesToHash(impl[:]))
+	explorer.SetAbi(impl, implAbi)
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newResolver(explorer)
+	key := abis.Key{Chain: "bsc", Name: "proxy", Address: proxy}
+	a, err := r.Resolve(context.Background(), key, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.Methods["totalSupply"]; !ok {
+		t.Fatal("the implementation ABI is not merged")
+	}
+	if _, err = r.Resolve(context.Background(), key, client); err != nil {
+		t.Fatal(err)
+	}
+	if explorer.Count() != 1 {
+		t.Fatalf("%d explorer requests, want 1", explorer.Count())
+	}
+
+	// without a client the proxy is taken as is
+	if a, err = r.Resolve(context.Background(), key, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.Methods["totalSupply"]; ok {
+		t.Fatal("merged without a client")
+	}
+}
+
+func TestResolveUpgradedProxy(t *testing.T) {
+	node, explorer := rpctest.NewServer(), rpctest.NewExplorer()
+	defer node.Close()
+	defer explorer.Close()
+	upgraded := web3.HexToAddress("0x00000000000000000000000000000000000000cc")
+	node.SetStorage(proxy, web3.HexToHash(abis.ImplementationSlot), web3.BytesToHash(impl[:]))
+	explorer.SetAbi(impl, implAbi)
+	explorer.SetAbi(upgraded, `[{"inputs":[],"name":"pause","outputs":[],"stateMutability":"nonpayable","type":"function"}]`)
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newResolver(explorer)
+	key := abis.Key{Chain: "bsc", Name: "proxy", Address: proxy}
+	if _, err = r.Resolve(context.Background(), key, client); err != nil {
+		t.Fatal(err)
+	}
+	node.SetStorage(proxy, web3.HexToHash(abis.ImplementationSlot), web3.BytesToHash(upgraded[:]))
+	a, err := r.Resolve(context.Background(), key, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.Methods["pause"]; !ok {
+		t.Fatal("the ABI of the new implementation is not merged")
+	}
+	if _, ok := a.Methods["totalSupply"]; ok {
+		t.Fatal("the ABI of the old implementation is still merged")
+	}
+}
+
+func TestResolveRemoteOptIn(t *testing.T) {
+	explorer := rpctest.NewExplorer()
+	defer explorer.Close()
+	explorer.SetAbi(impl, implAbi)
+
+	r := newResolver(explorer)
+	r.Remote = false
+	key := abis.Key{Chain: "bsc", Address: impl}
+	if _, err := r.Resolve(context.Background(), key, nil); !errors.Is(err, abis.ErrNotFound) {
+		t.Fatalf("Resolve() = %v, want ErrNotFound", err)
+	}
+	if explorer.Count() != 0 {
+		t.Fatalf("%d explorer requests without Remote, want 0", explorer.Count())
+	}
+	if _, err := r.Download(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveNotVerified(t *testing.T) {
+	explorer := rpctest.NewExplorer()
+	defer explorer.Close()
+
+	_, err := newResolver(explorer).Resolve(context.Background(), abis.Key{Chain: "bsc", Address: impl}, nil)
+	if !errors.Is(err, abis.ErrNotFound) {
+		t.Fatalf("Resolve() = %v, want ErrNotFound", err)
+	}
+}
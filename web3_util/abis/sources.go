@@ -0,0 +1,178 @@
+package abis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panyanyany/go-web3"
+)
+
+// FS reads <chain>/<name>/abi.json, or <chain>/<address>/abi.json, from a file system such as an embed.FS
+type FS struct {
+	FS fs.FS
+}
+
+func NewFS(fsys fs.FS) *FS {
+	return &FS{FS: fsys}
+}
+
+func (s *FS) Abi(ctx context.Context, key Key) (bs []byte, err error) {
+	for _, name := range []string{key.Name, addressDir(key.Address)} {
+		if name == "" {
+			continue
+		}
+		bs, err = fs.ReadFile(s.FS, path.Join(key.Chain, name, "abi.json"))
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			err = fmt.Errorf("fs.ReadFile: %w", err)
+			return
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func addressDir(addr web3.Address) string {
+	if addr == (web3.Address{}) {
+		return ""
+	}
+	return strings.ToLower(addr.String())
+}
+
+// Dir is a directory laid out like FS, Put stores ABIs by address so it serves as cache
+type Dir struct {
+	FS
+	Path string
+}
+
+func NewDir(dir string) *Dir {
+	return &Dir{FS: FS{FS: os.DirFS(dir)}, Path: dir}
+}
+
+func (d *Dir) Put(key Key, bs []byte) (err error) {
+	name := addressDir(key.Address)
+	if name == "" {
+		return
+	}
+	dir := filepath.Join(d.Path, key.Chain, name)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		err = fmt.Errorf("os.MkdirAll: %w", err)
+		return
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "abi.json"), bs, 0644); err != nil {
+		err = fmt.Errorf("ioutil.WriteFile: %w", err)
+		return
+	}
+	return
+}
+
+// Explorer fetches verified ABIs by address from Etherscan compatible apis, one per chain
+type Explorer struct {
+	Client *http.Client
+
+	lock sync.RWMutex
+	apis map[string]*explorerApi
+}
+
+type explorerApi struct {
+	url    string
+	apiKey string
+}
+
+func NewExplorer() *Explorer {
+	return &Explorer{Client: &http.Client{Timeout: 30 * time.Second}, apis: map[string]*explorerApi{}}
+}
+
+// SetApi sets the api url of chain, like https://api.bscscan.com/api, an empty url removes it
+func (e *Explorer) SetApi(chain string, apiUrl string, apiKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if apiUrl == "" {
+		delete(e.apis, chain)
+		return
+	}
+	e.apis[chain] = &explorerApi{url: apiUrl, apiKey: apiKey}
+}
+
+// SetApiKey sets the api key of a chain whose api is set
+func (e *Explorer) SetApiKey(chain string, apiKey string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if api, ok := e.apis[chain]; ok {
+		e.apis[chain] = &explorerApi{url: api.url, apiKey: apiKey}
+	}
+}
+
+type explorerResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Result  string `json:"result"`
+}
+
+func (e *Explorer) Abi(ctx context.Context, key Key) (bs []byte, err error) {
+	e.lock.RLock()
+	api, ok := e.apis[key.Chain]
+	e.lock.RUnlock()
+	if !ok || key.Address == (web3.Address{}) {
+		return nil, ErrNotFound
+	}
+
+	q := url.Values{}
+	q.Set("module", "contract")
+	q.Set("action", "getabi")
+	q.Set("address", key.Address.String())
+	if api.apiKey != "" {
+		q.Set("apikey", api.apiKey)
+	}
+	sep := "?"
+	if strings.Contains(api.url, "?") {
+		sep = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api.url+sep+q.Encode(), nil)
+	if err != nil {
+		err = fmt.Errorf("http.NewRequestWithContext: %w", err)
+		return
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("e.Client.Do: %w", err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("ioutil.ReadAll: %w", err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http status %d: %s", resp.StatusCode, body)
+		return
+	}
+
+	var res explorerResponse
+	if err = json.Unmarshal(body, &res); err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+	if res.Status != "1" {
+		if strings.Contains(strings.ToLower(res.Result), "not verified") {
+			return nil, ErrNotFound
+		}
+		err = fmt.Errorf("%s: %s", res.Message, res.Result)
+		return
+	}
+	return []byte(res.Result), nil
+}
@@ -1,10 +1,12 @@
 package web3_util
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"strings"
 
+	"goutil/web3_util/abis"
+
 	"github.com/panyanyany/go-web3"
 	"github.com/panyanyany/go-web3/abi"
 	"github.com/panyanyany/go-web3/contract"
@@ -34,35 +36,38 @@ func (r *Asset) Init() *Asset {
 	r.Address = strings.ToLower(r.Address)
 	return r
 }
-func (r *Asset) DownloadAbi() (body string, err error) {
-	return
+func (r *Asset) key() abis.Key {
+	return abis.Key{Chain: r.ChainName, Name: r.Name, Address: web3.HexToAddress(r.Address)}
 }
 
-func (r *Asset) LoadAbi() (body string, err error) {
-	var bs []byte
-	bs, err = ioutil.ReadFile(fmt.Sprintf("resources/%s/%s/abi.json",
-		r.ChainName,
-		r.Name,
-	))
+// DownloadAbi fetches the ABI from the explorer of the chain, it is kept in the cache of abis.Default if any
+func (r *Asset) DownloadAbi() (body string, err error) {
+	bs, err := abis.Default.Download(context.Background(), r.key())
 	if err != nil {
+		err = fmt.Errorf("abis.Default.Download: %w", err)
 		return
 	}
 	body = string(bs)
 	return
 }
 
-func (r *Asset) ToContract(client jsonrpc.IClient) (c *contract.Contract, err error) {
-	var abiStr string
-	abiStr, err = r.LoadAbi()
+// LoadAbi resolves the ABI through abis.Default
+func (r *Asset) LoadAbi() (body string, err error) {
+	bs, err := abis.Default.Load(context.Background(), r.key(), nil)
 	if err != nil {
-		err = fmt.Errorf("r.LoadAbi(): %w", err)
+		err = fmt.Errorf("abis.Default.Load: %w", err)
 		return
 	}
+	body = string(bs)
+	return
+}
 
+func (r *Asset) ToContract(client jsonrpc.IClient) (c *contract.Contract, err error) {
+	// with the client a proxy gets the methods of its implementation
 	var abiObj *abi.ABI
-	abiObj, err = abi.NewABI(abiStr)
+	abiObj, err = abis.Default.Resolve(context.Background(), r.key(), client)
 	if err != nil {
-		err = fmt.Errorf("abi.NewABI: %w", err)
+		err = fmt.Errorf("abis.Default.Resolve: %w", err)
 		return
 	}
 
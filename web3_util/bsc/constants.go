@@ -1,21 +1,27 @@
 package bsc
 
 import (
+	"goutil/web3_util/chains"
 	"goutil/web3_util/contract"
 
 	"github.com/panyanyany/go-web3"
 )
 
+// Chain is the bsc entry of the chain registry, captured with the contracts below at init:
+// overrides loaded later with chains.LoadFile do not reach them, call chains.Get("bsc") after loading
+var Chain = chains.MustGet("bsc")
+
 var (
-	Usdt = &contract.Contract{Name: "USDT", Symbol: "USDT", Address: web3.HexToAddress("0xc2132d05d31c914a87c6611c10748aeb04b58e8f"), Decimals: 18, ChainName: "bsc"}
-	Usdc           = &contract.Contract{Name: "USDC", Symbol: "USDC", Address: web3.HexToAddress("0x2791bca1f2de4661ed88a30c99a7a9449aa84174"), Decimals: 18, ChainName: "bsc"}
-	PancakeFactory = &contract.Contract{Name: "PancakeFactory", Symbol: "PancakeFactory", Address: web3.HexToAddress("0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73"), Decimals: 18, ChainName: "bsc"}
-	MultiCall      = &contract.Contract{Name: "MultiCall", Symbol: "MultiCall", Address: web3.HexToAddress("0x5dc53ed77bbc84f39c76fb4c84ac9f28384a4b55"), Decimals: 18, ChainName: "bsc"}
-	PancakeRouter  = &contract.Contract{Name: "PancakeRouter", Symbol: "PancakeRouter", Address: web3.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E"), Decimals: 18, ChainName: "bsc"}
-	Wbnb           = &contract.Contract{Name: "WBNB", Symbol: "WBNB", Address: web3.HexToAddress("0xbb4cdb9cbd36b01bd1cbaebf2de08d9173bc095c"), Decimals: 18, ChainName: "bsc"}
-	Busd           = &contract.Contract{Name: "BUSD", Symbol: "BUSD", Address: web3.HexToAddress("0xe9e7cea3dedca5984780bafc599bd69add087d56"), Decimals: 18, ChainName: "bsc"}
-	BscUsd         = &contract.Contract{Name: "BUSD", Symbol: "BUSD", Address: web3.HexToAddress("0x55d398326f99059fF775485246999027B3197955"), Decimals: 18, ChainName: "bsc"}
-	WbnbBusdPair   = &contract.Contract{Name: "WbnbBusdPair", Symbol: "WBPair", Address: web3.HexToAddress("0x58F876857a02D6762E0101bb5C46A8c1ED44Dc16"), Decimals: 18, ChainName: "bsc"}
+	Usdt           = mustToken("USDT")
+	Usdc           = mustToken("USDC")
+	PancakeFactory = Chain.NewContract("PancakeFactory", "PancakeFactory", Chain.Factory, 18)
+	MultiCall      = Chain.NewContract("MultiCall", "MultiCall", mustAddress("MultiCall"), 18)
+	PancakeRouter  = Chain.NewContract("PancakeRouter", "PancakeRouter", Chain.Router, 18)
+	Wbnb           = mustToken("WBNB")
+	Busd           = mustToken("BUSD")
+	// BscUsd is BSC-USD, the binance-peg USDT of bsc, named BUSD as its ABI is resources/bsc/BUSD
+	BscUsd       = Chain.NewContract("BUSD", "BSC-USD", mustTokenAddress("USDT"), 18)
+	WbnbBusdPair = Chain.NewContract("WbnbBusdPair", "WBPair", mustAddress("NativeUsdPair"), 18)
 
 	//Usdc           = (&web3_util.Asset{Name: "USDC", Symbol: "USDC", Address: "0x2791bca1f2de4661ed88a30c99a7a9449aa84174", Decimals: 18, ChainName: "bsc"}).Init()
 	//PancakeFactory = (&web3_util.Asset{Name: "PancakeFactory", Symbol: "PancakeFactory", Address: "0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73", Decimals: 18, ChainName: "bsc"}).Init()
@@ -26,3 +32,27 @@ var (
 	//BscUsd         = (&web3_util.Asset{Name: "BUSD", Symbol: "BUSD", Address: "0x55d398326f99059fF775485246999027B3197955", Decimals: 18, ChainName: "bsc"}).Init()
 	//WbnbBusdPair   = (&web3_util.Asset{Name: "WbnbBusdPair", Symbol: "WBPair", Address: "0x58F876857a02D6762E0101bb5C46A8c1ED44Dc16", Decimals: 18, ChainName: "bsc"}).Init()
 )
+
+func mustToken(symbol string) *contract.Contract {
+	c, err := Chain.TokenContract(symbol)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func mustTokenAddress(symbol string) web3.Address {
+	token, err := Chain.Token(symbol)
+	if err != nil {
+		panic(err)
+	}
+	return token.Address
+}
+
+func mustAddress(name string) web3.Address {
+	addr, err := Chain.Contract(name)
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
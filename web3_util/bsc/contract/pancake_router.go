@@ -6,12 +6,47 @@ import (
 	"goutil/web3_util/contract"
 
 	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
 )
 
+const pancakeRouterAbiStr = `[
+{"inputs":[],"name":"WETH","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"factory","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"path","type":"address[]"}],"name":"getAmountsOut","outputs":[{"name":"amounts","type":"uint256[]"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"amountOut","type":"uint256"},{"name":"path","type":"address[]"}],"name":"getAmountsIn","outputs":[{"name":"amounts","type":"uint256[]"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForTokens","outputs":[{"name":"amounts","type":"uint256[]"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"amountOut","type":"uint256"},{"name":"amountInMax","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapTokensForExactTokens","outputs":[{"name":"amounts","type":"uint256[]"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactETHForTokens","outputs":[{"name":"amounts","type":"uint256[]"}],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"amountOut","type":"uint256"},{"name":"amountInMax","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapTokensForExactETH","outputs":[{"name":"amounts","type":"uint256[]"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForETH","outputs":[{"name":"amounts","type":"uint256[]"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"amountOut","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapETHForExactTokens","outputs":[{"name":"amounts","type":"uint256[]"}],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForTokensSupportingFeeOnTransferTokens","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactETHForTokensSupportingFeeOnTransferTokens","outputs":[],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForETHSupportingFeeOnTransferTokens","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+// PancakeRouterAbi has the quoting and swap methods of a uniswap v2 router
+var PancakeRouterAbi = abi.MustNewABI(pancakeRouterAbiStr)
+
+// PancakeRouter builds the swap transactions of the router, the ETH methods
+// need the amount sent set with Tx.SetValue
 type PancakeRouter struct {
 	*contract.Contract
 }
 
+// NewPancakeRouter returns the router at addr with PancakeRouterAbi
+func NewPancakeRouter(addr web3.Address, provider jsonrpc.IEth) *PancakeRouter {
+	return &PancakeRouter{contract.NewContract(addr, PancakeRouterAbi, provider)}
+}
+
+func (r *PancakeRouter) tx(method string, args ...interface{}) *contract.Tx {
+	return contract.NewTx().
+		SetMethod(method).
+		AddArgs(args...).
+		SetContract(r.Contract)
+}
+
 func (r *PancakeRouter) SwapExactETHForTokensSupportingFeeOnTransferTokens(amountOutMin *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
 	methodName := "swapExactETHForTokensSupportingFeeOnTransferTokens"
 
@@ -22,3 +57,35 @@ func (r *PancakeRouter) SwapExactETHForTokensSupportingFeeOnTransferTokens(amoun
 		//SetGasPrice(unit.NewGWei(big.NewFloat(20)).Wei().Uint64()).
 		SetContract(r.Contract)
 }
+
+func (r *PancakeRouter) SwapExactTokensForTokensSupportingFeeOnTransferTokens(amountIn *big.Int, amountOutMin *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
+	return r.tx("swapExactTokensForTokensSupportingFeeOnTransferTokens", amountIn, amountOutMin, path, to, deadline)
+}
+
+func (r *PancakeRouter) SwapExactTokensForETHSupportingFeeOnTransferTokens(amountIn *big.Int, amountOutMin *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
+	return r.tx("swapExactTokensForETHSupportingFeeOnTransferTokens", amountIn, amountOutMin, path, to, deadline)
+}
+
+func (r *PancakeRouter) SwapExactTokensForTokens(amountIn *big.Int, amountOutMin *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
+	return r.tx("swapExactTokensForTokens", amountIn, amountOutMin, path, to, deadline)
+}
+
+func (r *PancakeRouter) SwapTokensForExactTokens(amountOut *big.Int, amountInMax *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
+	return r.tx("swapTokensForExactTokens", amountOut, amountInMax, path, to, deadline)
+}
+
+func (r *PancakeRouter) SwapExactETHForTokens(amountOutMin *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
+	return r.tx("swapExactETHForTokens", amountOutMin, path, to, deadline)
+}
+
+func (r *PancakeRouter) SwapTokensForExactETH(amountOut *big.Int, amountInMax *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
+	return r.tx("swapTokensForExactETH", amountOut, amountInMax, path, to, deadline)
+}
+
+func (r *PancakeRouter) SwapExactTokensForETH(amountIn *big.Int, amountOutMin *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
+	return r.tx("swapExactTokensForETH", amountIn, amountOutMin, path, to, deadline)
+}
+
+func (r *PancakeRouter) SwapETHForExactTokens(amountOut *big.Int, path []web3.Address, to web3.Address, deadline *big.Int) *contract.Tx {
+	return r.tx("swapETHForExactTokens", amountOut, path, to, deadline)
+}
@@ -0,0 +1,241 @@
+package cclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+)
+
+// Request is one call of a json-rpc batch, Err is set per request
+type Request struct {
+	Method string
+	Params []interface{}
+	Out    interface{}
+	Err    error
+}
+
+// rawCall is a call whose result is kept as raw json
+type rawCall struct {
+	Method string
+	Params []interface{}
+	Result json.RawMessage
+	Err    error
+	done   chan struct{}
+}
+
+type rpcRequest struct {
+	JsonRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// CallBatch sends all requests as one json-rpc array in a single round-trip
+func (r *CClient) CallBatch(reqs []*Request) (err error) {
+	return r.CallBatchContext(context.Background(), reqs)
+}
+
+func (r *CClient) CallBatchContext(ctx context.Context, reqs []*Request) (err error) {
+	if len(reqs) == 0 {
+		return
+	}
+	calls := make([]*rawCall, len(reqs))
+	for i, req := range reqs {
+		calls[i] = &rawCall{Method: req.Method, Params: req.Params}
+	}
+
+	err = r.postBatchRetry(ctx, calls)
+	if err != nil {
+		err = fmt.Errorf("r.postBatch: %w", err)
+		return
+	}
+
+	for i, req := range reqs {
+		req.Err = calls[i].Err
+		if req.Err == nil && req.Out != nil {
+			req.Err = json.Unmarshal(calls[i].Result, req.Out)
+		}
+	}
+	return
+}
+
+// postBatch posts calls to url as a json-rpc array and fills their Result or Err
+func (r *CClient) postBatch(ctx context.Context, url string, calls []*rawCall) (err error) {
+	transport, ok := r.transports[url]
+	if !ok {
+		err = fmt.Errorf("unknown endpoint: %v", url)
+		return
+	}
+	return transport.batch(ctx, calls)
+}
+
+// postBatchRetry posts a batch, moving to another endpoint on failure when every call is idempotent
+func (r *CClient) postBatchRetry(ctx context.Context, calls []*rawCall) error {
+	idempotent := true
+	for _, call := range calls {
+		idempotent = idempotent && isIdempotent(call.Method)
+	}
+	apiList := r.QueryApiList
+	if !idempotent {
+		apiList = r.PostApiList
+	}
+	return r.withEndpoint(ctx, apiList, "batch", idempotent, func(url string) ([]byte, error) {
+		seelog.Debugf("using url: %v, batch of %v", url, len(calls))
+		return nil, r.postBatch(ctx, url, calls)
+	})
+}
+
+// EnableCoalesce makes concurrent Calls issued within window go out as one batch
+// of at most maxBatch requests, a zero window turns it off
+func (r *CClient) EnableCoalesce(window time.Duration, maxBatch int) *CClient {
+	r.coalesceLock.Lock()
+	r.CoalesceWindow = window
+	r.CoalesceMax = maxBatch
+	r.coalesceLock.Unlock()
+	return r
+}
+
+// coalesce queues call for the next batch and waits for its result,
+// the batch is sent anyway when ctx is done as other calls share it
+func (r *CClient) coalesce(ctx context.Context, call *rawCall) {
+	queued := &rawCall{Method: call.Method, Params: call.Params, done: make(chan struct{})}
+
+	r.coalesceLock.Lock()
+	r.coalesceQueue = append(r.coalesceQueue, queued)
+	var full []*rawCall
+	if len(r.coalesceQueue) >= r.CoalesceMax && r.CoalesceMax > 0 {
+		full = r.coalesceQueue
+		r.coalesceQueue = nil
+	} else if len(r.coalesceQueue) == 1 {
+		time.AfterFunc(r.CoalesceWindow, r.flushCoalesced)
+	}
+	r.coalesceLock.Unlock()
+
+	if full != nil {
+		go r.sendCoalesced(full)
+	}
+	select {
+	case <-queued.done:
+		call.Result, call.Err = queued.Result, queued.Err
+	case <-ctx.Done():
+		call.Err = ctx.Err()
+	}
+}
+
+func (r *CClient) flushCoalesced() {
+	r.coalesceLock.Lock()
+	calls := r.coalesceQueue
+	r.coalesceQueue = nil
+	r.coalesceLock.Unlock()
+
+	if len(calls) > 0 {
+		r.sendCoalesced(calls)
+	}
+}
+
+func (r *CClient) sendCoalesced(calls []*rawCall) {
+	err := r.postBatchRetry(context.Background(), calls)
+
+	for _, call := range calls {
+		if err != nil {
+			call.Err = err
+		}
+		close(call.done)
+	}
+}
+
+// requestKey identifies identical requests
+func requestKey(method string, params []interface{}) (string, error) {
+	bs, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return method + ":" + string(bs), nil
+}
+
+// inflightCalls lets identical concurrent requests share one response
+type inflightCalls struct {
+	lock  sync.Mutex
+	calls map[string]*rawCall
+}
+
+// callRaw runs a call and returns its raw result,
+// identical requests already in flight are waited for instead of being sent again
+func (r *CClient) callRaw(ctx context.Context, method string, params []interface{}) (json.RawMessage, error) {
+	key, err := requestKey(method, params)
+	if err != nil {
+		call := &rawCall{Method: method, Params: params}
+		r.doRaw(ctx, call)
+		return call.Result, call.Err
+	}
+
+	ttl, cacheable := r.cacheTTL(ctx, method, params)
+	var cacheKey string
+	if cacheable {
+		cacheKey, cacheable = r.cacheKey(ctx, key)
+	}
+	if cacheable {
+		if raw, ok := r.cacheGet(ctx, cacheKey); ok {
+			return raw, nil
+		}
+	}
+
+	for {
+		r.inflight.lock.Lock()
+		if r.inflight.calls == nil {
+			r.inflight.calls = map[string]*rawCall{}
+		}
+		call, ok := r.inflight.calls[key]
+		if !ok {
+			break
+		}
+		r.inflight.lock.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// the request we waited for was cancelled by its own caller, not by us
+		if errors.Is(call.Err, context.Canceled) || errors.Is(call.Err, context.DeadlineExceeded) {
+			continue
+		}
+		return call.Result, call.Err
+	}
+	call := &rawCall{Method: method, Params: params, done: make(chan struct{})}
+	r.inflight.calls[key] = call
+	r.inflight.lock.Unlock()
+
+	shared := &rawCall{Method: method, Params: params}
+	r.doRaw(ctx, shared)
+	call.Result, call.Err = shared.Result, shared.Err
+	if cacheable && call.Err == nil {
+		r.cacheSet(ctx, cacheKey, method, call.Result, ttl)
+	}
+
+	r.inflight.lock.Lock()
+	delete(r.inflight.calls, key)
+	r.inflight.lock.Unlock()
+	close(call.done)
+	return call.Result, call.Err
+}
+
+// doRaw sends one call, through the coalescing batch when enabled
+func (r *CClient) doRaw(ctx context.Context, call *rawCall) {
+	// only plain reads are batched, writes and archive reads keep their own endpoints
+	if r.CoalesceWindow > 0 && isIdempotent(call.Method) && !r.isHistorical(call.Method, call.Params) {
+		r.coalesce(ctx, call)
+		return
+	}
+
+	call.Err = r.withEndpoint(ctx, r.pool(call.Method, call.Params), call.Method, isIdempotent(call.Method), func(url string) ([]byte, error) {
+		seelog.Debugf("using url: %v", url)
+		call.Result = nil
+		err := r.transports[url].CallContext(ctx, call.Method, &call.Result, call.Params...)
+		return call.Result, err
+	})
+}
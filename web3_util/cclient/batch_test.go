@@ -0,0 +1,123 @@
+package cclient_test
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"goutil/web3_util/cclient"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+)
+
+func newClient(t *testing.T, node *rpctest.Server) *cclient.CClient {
+	c := node.CClient()
+	c.EnableCache = false
+	return c
+}
+
+func account(i int) web3.Address {
+	return web3.BytesToAddress([]byte{byte(i + 1)})
+}
+
+// balances calls eth_getBalance of account(i) for each i concurrently and checks the results
+func balances(t *testing.T, c *cclient.CClient, accounts []int) {
+	var wg sync.WaitGroup
+	errs := make([]error, len(accounts))
+	outs := make([]string, len(accounts))
+	for i, a := range accounts {
+		wg.Add(1)
+		go func(i int, a int) {
+			defer wg.Done()
+			errs[i] = c.Call("eth_getBalance", &outs[i], account(a), "latest")
+		}(i, a)
+	}
+	wg.Wait()
+	for i, a := range accounts {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if want := web3.BlockNumber(a + 1).String(); outs[i] != want {
+			t.Fatalf("balance of account %d = %s, want %s", a, outs[i], want)
+		}
+	}
+}
+
+func setBalances(node *rpctest.Server, n int) {
+	for i := 0; i < n; i++ {
+		node.SetBalance(account(i), big.NewInt(int64(i+1)))
+	}
+}
+
+func TestCallBatch(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	node.SetBlockNumber(100)
+	setBalances(node, 1)
+	node.RespondError("eth_call", -32000, "boom")
+	c := newClient(t, node)
+
+	var balance, head, call string
+	reqs := []*cclient.Request{
+		{Method: "eth_getBalance", Params: []interface{}{account(0), "latest"}, Out: &balance},
+		{Method: "eth_blockNumber", Out: &head},
+		{Method: "eth_call", Params: []interface{}{map[string]interface{}{"to": account(0)}, "latest"}, Out: &call},
+	}
+	if err := c.CallBatch(reqs); err != nil {
+		t.Fatal(err)
+	}
+	if node.Posts() != 1 {
+		t.Fatalf("%d http requests, want one batch", node.Posts())
+	}
+	if reqs[0].Err != nil || balance != "0x1" || reqs[1].Err != nil || head != "0x64" {
+		t.Fatalf("balance %s %v, head %s %v", balance, reqs[0].Err, head, reqs[1].Err)
+	}
+	if reqs[2].Err == nil {
+		t.Fatal("the failed request of the batch has no error")
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	setBalances(node, 5)
+	c := newClient(t, node).EnableCoalesce(50*time.Millisecond, 10)
+
+	balances(t, c, []int{0, 1, 2, 3, 4})
+	if node.Posts() != 1 || node.Count("eth_getBalance") != 5 {
+		t.Fatalf("%d http requests of %d calls, want one batch of 5", node.Posts(), node.Count("eth_getBalance"))
+	}
+
+	// a full batch goes out without waiting for the window
+	node.Reset()
+	c.EnableCoalesce(time.Hour, 2)
+	balances(t, c, []int{0, 1, 2, 3})
+	if node.Posts() != 2 {
+		t.Fatalf("%d http requests, want 2 full batches", node.Posts())
+	}
+}
+
+// identical concurrent calls share the request in flight
+func TestInflightDedupe(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	setBalances(node, 2)
+	node.SetLatency("eth_getBalance", 50*time.Millisecond)
+	c := newClient(t, node)
+
+	balances(t, c, []int{0, 0, 0, 0, 0, 1, 1, 1})
+	if n := node.Count("eth_getBalance"); n != 2 {
+		t.Fatalf("%d requests, want one per account", n)
+	}
+
+	// with coalescing on top, the two remaining calls share one batch
+	node.Reset()
+	node.SetLatency("eth_getBalance", 50*time.Millisecond)
+	c.EnableCoalesce(20*time.Millisecond, 10)
+	balances(t, c, []int{0, 0, 0, 1, 1, 1})
+	if node.Posts() != 1 || node.Count("eth_getBalance") != 2 {
+		t.Fatalf("%d http requests of %d calls, want one batch of 2", node.Posts(), node.Count("eth_getBalance"))
+	}
+}
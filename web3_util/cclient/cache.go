@@ -0,0 +1,333 @@
+package cclient
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultCacheTTL is used when neither CacheTTL nor RedisTimeout gives a ttl
+const DefaultCacheTTL = time.Hour
+
+// DefaultCacheConfirmations is how deep below the head a block must be for results
+// pinned to it to be cached, shallower blocks may still be reorged
+const DefaultCacheConfirmations = 15
+
+// Cache keeps raw json-rpc results
+type Cache interface {
+	Get(ctx context.Context, key string) (val []byte, ok bool, err error)
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration) error
+}
+
+// RedisCache is a Cache kept in redis
+type RedisCache struct {
+	Rdb    *redis.Client
+	Prefix string
+}
+
+func NewRedisCache(rdb *redis.Client) *RedisCache {
+	return &RedisCache{Rdb: rdb, Prefix: "cclient:"}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (val []byte, ok bool, err error) {
+	val, err = c.Rdb.Get(ctx, c.Prefix+key).Bytes()
+	if err == redis.Nil {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	return c.Rdb.Set(ctx, c.Prefix+key, val, ttl).Err()
+}
+
+// LruCache is an in-memory Cache holding at most Size entries
+type LruCache struct {
+	Size  int
+	lock  sync.Mutex
+	list  *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	val      []byte
+	expireAt time.Time
+}
+
+func NewLruCache(size int) *LruCache {
+	return &LruCache{Size: size, list: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *LruCache) Get(ctx context.Context, key string) (val []byte, ok bool, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	el, found := c.items[key]
+	if !found {
+		return
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		c.list.Remove(el)
+		delete(c.items, key)
+		return
+	}
+	c.list.MoveToFront(el)
+	return entry.val, true, nil
+}
+
+func (c *LruCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry := &lruEntry{key: key, val: val, expireAt: time.Now().Add(ttl)}
+	if el, found := c.items[key]; found {
+		el.Value = entry
+		c.list.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.list.PushFront(entry)
+	for c.Size > 0 && c.list.Len() > c.Size {
+		oldest := c.list.Back()
+		c.list.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// CacheStats counts cache lookups of a CClient
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Errors uint64
+}
+
+type cacheCounters struct {
+	hits, misses, errors uint64
+}
+
+// CacheStats returns a snapshot of the cache counters
+func (r *CClient) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&r.cacheCounters.hits),
+		Misses: atomic.LoadUint64(&r.cacheCounters.misses),
+		Errors: atomic.LoadUint64(&r.cacheCounters.errors),
+	}
+}
+
+// SetCacheTTL sets the ttl of one method, a negative ttl disables caching it
+func (r *CClient) SetCacheTTL(method string, ttl time.Duration) *CClient {
+	r.CacheTTL[method] = ttl
+	return r
+}
+
+// cacheTTL tells whether a request can be cached and for how long.
+// Only queries whose answer cannot change are cached: anything pinned to a block hash or to
+// a block at least CacheConfirmations below the head, never latest or pending.
+func (r *CClient) cacheTTL(ctx context.Context, method string, params []interface{}) (ttl time.Duration, ok bool) {
+	if !r.EnableCache || r.Cache == nil {
+		return
+	}
+
+	switch method {
+	case "eth_getBlockByHash", "eth_getTransactionReceipt", "eth_getTransactionByHash":
+		// receipts and transactions are checked on the result, see cacheStorable
+		ok = true
+	case "eth_getBlockByNumber", "eth_call", "eth_getBalance", "eth_getCode", "eth_getStorageAt", "eth_getTransactionCount":
+		block, found := blockParam(method, params)
+		ok = found && r.isConfirmed(ctx, block)
+	case "eth_getLogs":
+		ok = len(params) == 1 && r.isConfirmedFilter(ctx, params[0])
+	}
+	if !ok {
+		return
+	}
+
+	ttl = r.RedisTimeout
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if methodTTL, found := r.CacheTTL[method]; found {
+		ttl = methodTTL
+	}
+	ok = ttl > 0
+	return
+}
+
+// parseBlock reads a block parameter: a number, or a 32 bytes hash, or neither for tags like latest
+func parseBlock(block string) (number uint64, isNumber bool, isHash bool) {
+	if !strings.HasPrefix(block, "0x") {
+		return
+	}
+	if len(block) == 66 {
+		return 0, false, true
+	}
+	number, err := strconv.ParseUint(block[2:], 16, 64)
+	return number, err == nil, false
+}
+
+// isConfirmed tells whether block is a hash, or a number at least CacheConfirmations below the head
+func (r *CClient) isConfirmed(ctx context.Context, block string) bool {
+	number, isNumber, isHash := parseBlock(block)
+	if isHash {
+		return true
+	}
+	if !isNumber {
+		return false
+	}
+	head := r.cacheHead(ctx)
+	return head >= r.CacheConfirmations && number <= head-r.CacheConfirmations
+}
+
+// isConfirmedFilter tells whether an eth_getLogs filter only covers confirmed blocks,
+// a range reaching past the head would get a partial answer
+func (r *CClient) isConfirmedFilter(ctx context.Context, param interface{}) bool {
+	bs, err := json.Marshal(param)
+	if err != nil {
+		return false
+	}
+	var filter struct {
+		BlockHash *string `json:"blockHash"`
+		FromBlock string  `json:"fromBlock"`
+		ToBlock   string  `json:"toBlock"`
+	}
+	if json.Unmarshal(bs, &filter) != nil {
+		return false
+	}
+	if filter.BlockHash != nil {
+		return true
+	}
+	from, fromOk, _ := parseBlock(filter.FromBlock)
+	to, toOk, _ := parseBlock(filter.ToBlock)
+	return fromOk && toOk && from <= to && r.isConfirmed(ctx, filter.ToBlock)
+}
+
+// cacheHead is the highest block known, read with eth_blockNumber when none was seen in
+// the last minute. A stale head only makes less results cacheable.
+// cacheLock is not held during the request, concurrent callers may each send one.
+func (r *CClient) cacheHead(ctx context.Context) uint64 {
+	r.healthLock.Lock()
+	head := r.maxHeight()
+	r.healthLock.Unlock()
+
+	r.cacheLock.Lock()
+	if r.cacheHeadN > head {
+		head = r.cacheHeadN
+	}
+	fresh := head > 0 && time.Since(r.cacheHeadAt) < time.Minute
+	r.cacheLock.Unlock()
+	if fresh {
+		return head
+	}
+
+	call := &rawCall{Method: "eth_blockNumber"}
+	r.doRaw(ctx, call)
+	if n, err := parseQuantity(call.Result, call.Err); err == nil && n > head {
+		head = n
+	}
+
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+	// another caller may have stored a higher head meanwhile
+	if r.cacheHeadN > head {
+		head = r.cacheHeadN
+	}
+	r.cacheHeadN, r.cacheHeadAt = head, time.Now()
+	return head
+}
+
+// chainID is ChainID, read with eth_chainId when not set
+func (r *CClient) chainID(ctx context.Context) (id uint64, err error) {
+	r.cacheLock.Lock()
+	id = r.ChainID
+	r.cacheLock.Unlock()
+	if id != 0 {
+		return
+	}
+
+	call := &rawCall{Method: "eth_chainId"}
+	r.doRaw(ctx, call)
+	if id, err = parseQuantity(call.Result, call.Err); err != nil {
+		return
+	}
+	r.cacheLock.Lock()
+	r.ChainID = id
+	r.cacheLock.Unlock()
+	return
+}
+
+func parseQuantity(raw json.RawMessage, err error) (n uint64, _ error) {
+	if err != nil {
+		return 0, err
+	}
+	var s string
+	if err = json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+// cacheKey puts the chain id in key, chains sharing a cache must not read each other's results
+func (r *CClient) cacheKey(ctx context.Context, key string) (string, bool) {
+	id, err := r.chainID(ctx)
+	if err != nil {
+		atomic.AddUint64(&r.cacheCounters.errors, 1)
+		return "", false
+	}
+	return strconv.FormatUint(id, 10) + ":" + key, true
+}
+
+// cacheStorable rejects results that are not final yet, like the receipt of a pending
+// transaction or of one mined in a block that may still be reorged
+func (r *CClient) cacheStorable(ctx context.Context, method string, raw json.RawMessage) bool {
+	if len(raw) == 0 || string(raw) == "null" {
+		return false
+	}
+	switch method {
+	case "eth_getTransactionByHash", "eth_getTransactionReceipt":
+		var obj struct {
+			BlockNumber *string `json:"blockNumber"`
+		}
+		if json.Unmarshal(raw, &obj) != nil || obj.BlockNumber == nil {
+			return false
+		}
+		return r.isConfirmed(ctx, *obj.BlockNumber)
+	}
+	return true
+}
+
+func (r *CClient) cacheGet(ctx context.Context, key string) (raw json.RawMessage, ok bool) {
+	val, ok, err := r.Cache.Get(ctx, key)
+	if err != nil {
+		atomic.AddUint64(&r.cacheCounters.errors, 1)
+		return nil, false
+	}
+	if !ok {
+		atomic.AddUint64(&r.cacheCounters.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&r.cacheCounters.hits, 1)
+	return val, true
+}
+
+func (r *CClient) cacheSet(ctx context.Context, key string, method string, raw json.RawMessage, ttl time.Duration) {
+	if !r.cacheStorable(ctx, method, raw) {
+		return
+	}
+	if err := r.Cache.Set(ctx, key, raw, ttl); err != nil {
+		atomic.AddUint64(&r.cacheCounters.errors, 1)
+	}
+}
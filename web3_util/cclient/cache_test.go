@@ -0,0 +1,112 @@
+package cclient_test
+
+import (
+	"testing"
+	"time"
+
+	"goutil/web3_util/cclient"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+)
+
+var holder = web3.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+func balanceTwice(t *testing.T, c *cclient.CClient, block string) {
+	for i := 0; i < 2; i++ {
+		var out string
+		if err := c.Call("eth_getBalance", &out, holder, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCacheOnlyConfirmedBlocks(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	node.SetBlockNumber(100)
+	c := node.CClient()
+
+	// 0x50 is 20 blocks deep, 0x60 only 4
+	balanceTwice(t, c, "0x50")
+	if n := node.Count("eth_getBalance"); n != 1 {
+		t.Fatalf("confirmed block: %d requests, want 1", n)
+	}
+	balanceTwice(t, c, "0x60")
+	if n := node.Count("eth_getBalance"); n != 3 {
+		t.Fatalf("recent block: %d requests, want 3", n)
+	}
+	balanceTwice(t, c, "latest")
+	if n := node.Count("eth_getBalance"); n != 5 {
+		t.Fatalf("latest: %d requests, want 5", n)
+	}
+
+	var logs []*web3.Log
+	for _, to := range []string{"0x50", "0x50", "0x70", "0x70"} {
+		filter := map[string]interface{}{"fromBlock": "0x1", "toBlock": to}
+		if err := c.Call("eth_getLogs", &logs, filter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the range past the head is partial and asked again
+	if n := node.Count("eth_getLogs"); n != 3 {
+		t.Fatalf("eth_getLogs: %d requests, want 3", n)
+	}
+}
+
+func TestCacheKeyedByChain(t *testing.T) {
+	shared := cclient.NewLruCache(100)
+	bsc, testnet := rpctest.NewServer(), rpctest.NewServer()
+	defer bsc.Close()
+	defer testnet.Close()
+	testnet.ChainID = 97
+
+	for _, node := range []*rpctest.Server{bsc, testnet} {
+		node.SetBlockNumber(100)
+		c := node.CClient()
+		c.Cache = shared
+		balanceTwice(t, c, "0x10")
+		if n := node.Count("eth_getBalance"); n != 1 {
+			t.Fatalf("chain %d: %d requests, want 1", node.ChainID, n)
+		}
+		var id string
+		for i := 0; i < 2; i++ {
+			if err := c.Call("eth_chainId", &id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if id != web3.BlockNumber(node.ChainID).String() {
+			t.Fatalf("eth_chainId = %s, want %d", id, node.ChainID)
+		}
+	}
+}
+
+// a slow eth_blockNumber must not hold up calls that only need the chain id
+func TestCacheHeadOutsideLock(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	node.SetBlockNumber(100)
+	node.SetLatency("eth_blockNumber", 300*time.Millisecond)
+	c := node.CClient()
+
+	done := make(chan error)
+	go func() {
+		var out string
+		done <- c.Call("eth_getBalance", &out, holder, "0x10")
+	}()
+	for node.Count("eth_blockNumber") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	// cached by hash, the head is not needed
+	var out string
+	if err := c.Call("eth_getBalance", &out, holder, web3.HexToHash("0x01").String()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Fatalf("call waited %s for the head request", d)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
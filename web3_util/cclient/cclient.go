@@ -2,6 +2,8 @@ package cclient
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"math"
 	"sync"
 	"time"
@@ -18,17 +20,47 @@ type CClient struct {
 	FindLock     sync.Mutex
 	LastRequest  time.Time
 
+	// QueryApiList serves reads, PostApiList transactions and
+	// HistoryApiList reads of blocks older than head-ArchiveAfter
 	QueryApiList   []string
 	PostApiList    []string
 	HistoryApiList []string
-	UrlLocks       map[string]*sync.Mutex
-
-	ApiLastRequest map[string]time.Time
+	ArchiveAfter   uint64
 
 	Clients   map[string]jsonrpc.IClient
 	Endpoints *jsonrpc.Endpoints
 
-	ReqInterval int64
+	transports map[string]*httpClient
+	limiters   map[string]*rateLimiter
+
+	// CoalesceWindow > 0 gathers concurrent Calls into batches, see EnableCoalesce
+	CoalesceWindow time.Duration
+	CoalesceMax    int
+	coalesceLock   sync.Mutex
+	coalesceQueue  []*rawCall
+
+	inflight inflightCalls
+
+	// Cache keeps results of immutable queries, redis when Rdb is given, in memory otherwise.
+	// Keys hold ChainID, read with eth_chainId when 0.
+	Cache              Cache
+	CacheTTL           map[string]time.Duration
+	CacheConfirmations uint64
+	ChainID            uint64
+	cacheCounters      cacheCounters
+	cacheLock          sync.Mutex
+	cacheHeadN         uint64
+	cacheHeadAt        time.Time
+
+	// endpoint health, an endpoint is skipped while its circuit is open
+	// or when it lags more than MaxLag blocks behind the others
+	health           map[string]*endpointHealth
+	healthLock       sync.Mutex
+	EwmaAlpha        float64
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	MaxLag           uint64
+	MaxRetries       int
 }
 
 func (r *CClient) Close() error {
@@ -36,113 +68,186 @@ func (r *CClient) Close() error {
 	return nil
 }
 
-func New(rdb *redis.Client, redisTimeout time.Duration) (r *CClient) {
+// New creates a client using urls for reads and writes, each limited to 2 requests per second
+func New(rdb *redis.Client, redisTimeout time.Duration, urls ...string) (r *CClient) {
+	r, err := NewWithOptions(&Options{
+		Read:         EndpointsFromUrls(urls...),
+		Rdb:          rdb,
+		RedisTimeout: redisTimeout,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+func NewWithOptions(opts *Options) (r *CClient, err error) {
+	if len(opts.Read) == 0 {
+		err = fmt.Errorf("no read endpoint")
+		return
+	}
+	write := opts.Write
+	if len(write) == 0 {
+		write = opts.Read
+	}
+	archive := opts.Archive
+	if len(archive) == 0 {
+		archive = opts.Read
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
 	r = new(CClient)
-	r.RedisTimeout = redisTimeout
-	r.Rdb = rdb
+	r.RedisTimeout = opts.RedisTimeout
+	r.Rdb = opts.Rdb
 	r.FindLock = sync.Mutex{}
-	r.EnableCache = rdb != nil && redisTimeout.Seconds() != 0
-	r.ReqInterval = 500
-	// https://gist.github.com/akme/89a4e596587cb605b530bd825994a0db
-	r.QueryApiList = config.Inst.Endpoints
-	r.PostApiList = r.QueryApiList
-	r.HistoryApiList = r.QueryApiList
-
-	r.ApiLastRequest = map[string]time.Time{}
-	r.Clients = map[string]jsonrpc.IClient{}
-	r.UrlLocks = map[string]*sync.Mutex{}
+	r.EnableCache = true
+	if r.Rdb != nil {
+		r.Cache = NewRedisCache(r.Rdb)
+	} else {
+		r.Cache = NewLruCache(10000)
+	}
+	r.CacheTTL = map[string]time.Duration{}
+	r.CacheConfirmations = DefaultCacheConfirmations
+	r.ChainID = opts.ChainID
+	r.health = map[string]*endpointHealth{}
+	r.EwmaAlpha = 0.2
+	r.BreakerThreshold = 5
+	r.BreakerCooldown = 30 * time.Second
+	r.MaxLag = 5
+	r.MaxRetries = 2
+	r.ArchiveAfter = opts.ArchiveAfter
+	if r.ArchiveAfter == 0 {
+		r.ArchiveAfter = 128
+	}
 
-	allUrlList := []string{}
-	allUrlListExists := make(map[string]bool)
-	for _, url := range r.QueryApiList {
-		_, found := allUrlListExists[url]
-		if found {
-			continue
+	r.Clients = map[string]jsonrpc.IClient{}
+	r.transports = map[string]*httpClient{}
+	r.limiters = map[string]*rateLimiter{}
+
+	add := func(endpoints []*EndpointConfig) (urls []string, err error) {
+		for _, cfg := range endpoints {
+			if cfg.Url == "" {
+				err = fmt.Errorf("endpoint without url")
+				return
+			}
+			urls = append(urls, cfg.Url)
+			if _, found := r.transports[cfg.Url]; found {
+				continue
+			}
+			transport := newHttpClient(cfg, timeout)
+			r.transports[cfg.Url] = transport
+			r.Clients[cfg.Url] = transport
+			r.limiters[cfg.Url] = newRateLimiter(cfg.Rate, cfg.Burst)
 		}
-		allUrlListExists[url] = true
-		allUrlList = append(allUrlList, url)
+		return
 	}
-	for _, url := range r.PostApiList {
-		_, found := allUrlListExists[url]
-		if found {
-			continue
-		}
-		allUrlListExists[url] = true
-		allUrlList = append(allUrlList, url)
+	if r.QueryApiList, err = add(opts.Read); err != nil {
+		return
 	}
-	for _, url := range r.HistoryApiList {
-		_, found := allUrlListExists[url]
-		if found {
-			continue
-		}
-		allUrlListExists[url] = true
-		allUrlList = append(allUrlList, url)
+	if r.PostApiList, err = add(write); err != nil {
+		return
 	}
+	if r.HistoryApiList, err = add(archive); err != nil {
+		return
+	}
+
+	r.Endpoints = &jsonrpc.Endpoints{EthClient: &jsonrpc.Eth{Client: r}}
+	return
+}
+
+func (r *CClient) GetLock(apiList []string) string {
+	url, _ := r.getLock(context.Background(), apiList, nil)
+	return url
+}
+
+// candidates filters apiList down to healthy endpoints not in exclude,
+// falling back to the whole list rather than returning nothing
+func (r *CClient) candidates(apiList []string, exclude map[string]bool) []string {
+	r.healthLock.Lock()
+	defer r.healthLock.Unlock()
 
-	for _, url := range allUrlList {
-		r.ApiLastRequest[url] = time.Time{}
-		api, err := jsonrpc.NewClient(url)
-		if err != nil {
-			panic(err)
+	now := time.Now()
+	var healthy, notExcluded []string
+	for _, url := range apiList {
+		if exclude[url] {
+			continue
 		}
-		if r.Endpoints == nil {
-			r.Endpoints = api.Endpoints
+		notExcluded = append(notExcluded, url)
+		if r.usable(url, now) {
+			healthy = append(healthy, url)
 		}
-		r.Clients[url] = api
-		r.UrlLocks[url] = &sync.Mutex{}
 	}
-	return
+	if len(healthy) > 0 {
+		return healthy
+	}
+	if len(notExcluded) > 0 {
+		return notExcluded
+	}
+	return apiList
 }
 
-var ctx = context.Background()
+// getLock picks the endpoint whose rate limit lets a request go out soonest,
+// and waits until it may be used or ctx is done
+func (r *CClient) getLock(ctx context.Context, apiList []string, exclude map[string]bool) (string, error) {
+	apiList = r.candidates(apiList, exclude)
 
-func (r *CClient) GetLock(apiList []string) string {
 	r.FindLock.Lock()
 	var foundUrl string
-	interval := int64(math.MaxInt64)
+	interval := time.Duration(math.MaxInt64)
 
+	now := time.Now()
 	for _, url := range apiList {
-		if r.ApiLastRequest[url].IsZero() {
+		wait := r.limiters[url].wait(now)
+		if wait < interval {
+			interval = wait
 			foundUrl = url
-			interval = 0
-			break
 		}
-		now := time.Now()
-		diff := r.ReqInterval - int64(now.Sub(r.ApiLastRequest[url]).Milliseconds())
-		if diff < interval {
-			interval = diff
-			foundUrl = url
+		if wait == 0 {
+			break
 		}
-		//seelog.Infof("diff=%v, interval=%v, foundUrl=%v, url=%v, last=%v, now=%v",
-		//	diff, interval, foundUrl,
-		//	url, r.ApiLastRequest[url], now,
-		//)
 	}
-	r.ApiLastRequest[foundUrl] = time.Now()
+	interval = r.limiters[foundUrl].take(now)
+	r.LastRequest = now
 	r.FindLock.Unlock()
 
-	r.UrlLocks[foundUrl].Lock()
 	if interval > 0 {
-		restTime := time.Duration(interval) * time.Millisecond
-		seelog.Debugf("sleep: %v", restTime)
-		time.Sleep(restTime)
+		seelog.Debugf("sleep: %v", interval)
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			// hand the token back, the request is not sent
+			r.FindLock.Lock()
+			r.limiters[foundUrl].give()
+			r.FindLock.Unlock()
+			return "", ctx.Err()
+		}
 	}
-	return foundUrl
+	return foundUrl, nil
 }
+
+// ReleaseLock is kept for callers of GetLock, the rate limits need no release
 func (r *CClient) ReleaseLock(url string) {
-	//r.LastRequest = time.Now()
-	//r.ApiLastRequest[url] = time.Now()
-	//r.FindLock.Unlock()
-	r.UrlLocks[url].Unlock()
 }
 
 func (r *CClient) Call(method string, out interface{}, params ...interface{}) (err error) {
-	baseUrl := r.GetLock(r.PostApiList)
-	defer r.ReleaseLock(baseUrl)
-
-	api := r.Clients[baseUrl]
-	seelog.Debugf("using url: %v", baseUrl)
+	return r.CallContext(context.Background(), method, out, params...)
+}
 
-	err = api.Call(method, out, params...)
+// CallContext is Call giving up when ctx is done, the http request in flight is aborted
+func (r *CClient) CallContext(ctx context.Context, method string, out interface{}, params ...interface{}) (err error) {
+	raw, err := r.callRaw(ctx, method, params)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(raw, out)
+	if err != nil {
+		err = fmt.Errorf("json.Unmarshal(%s): %w", method, err)
+		return
+	}
 	return
 }
@@ -0,0 +1,56 @@
+package cclient_test
+
+import (
+	"testing"
+
+	"goutil/web3_util/cclient"
+	"goutil/web3_util/rpctest"
+)
+
+func newPair(t *testing.T) (*cclient.CClient, []*rpctest.Server) {
+	nodes := []*rpctest.Server{rpctest.NewServer(), rpctest.NewServer()}
+	c, err := cclient.NewWithOptions(&cclient.Options{
+		Read: []*cclient.EndpointConfig{{Url: nodes[0].URL}, {Url: nodes[1].URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.EnableCache = false
+	return c, nodes
+}
+
+// each endpoint fails once, the second retry succeeds
+func TestRetryOnAnotherEndpoint(t *testing.T) {
+	c, nodes := newPair(t)
+	for _, node := range nodes {
+		defer node.Close()
+		node.FailHTTP("eth_getBalance", 1, 503)
+	}
+
+	var out string
+	if err := c.Call("eth_getBalance", &out, holder, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if out != "0x0" {
+		t.Fatalf("eth_getBalance = %s, want 0x0", out)
+	}
+	if n := nodes[0].Count("eth_getBalance") + nodes[1].Count("eth_getBalance"); n != 3 {
+		t.Fatalf("%d requests, want 3", n)
+	}
+}
+
+func TestNoRetryOfTransactions(t *testing.T) {
+	c, nodes := newPair(t)
+	for _, node := range nodes {
+		defer node.Close()
+		node.FailHTTP("eth_sendRawTransaction", 1, 503)
+	}
+
+	var hash string
+	if err := c.Call("eth_sendRawTransaction", &hash, "0x00"); err == nil {
+		t.Fatal("no error")
+	}
+	if n := nodes[0].Count("eth_sendRawTransaction") + nodes[1].Count("eth_sendRawTransaction"); n != 1 {
+		t.Fatalf("%d requests, want 1", n)
+	}
+}
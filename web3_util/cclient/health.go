@@ -0,0 +1,306 @@
+package cclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3/jsonrpc/codec"
+)
+
+// ErrorKind classifies the error of a call to tell whether another endpoint may do better
+type ErrorKind int
+
+const (
+	ErrorNone ErrorKind = iota
+	// ErrorRateLimited is a 429 or a "rate limit" answer
+	ErrorRateLimited
+	ErrorTimeout
+	// ErrorHeaderNotFound means the endpoint lags behind and does not know the block yet
+	ErrorHeaderNotFound
+	// ErrorNetwork covers refused connections, resets and 5xx statuses
+	ErrorNetwork
+	// ErrorExecution is a revert or a bad request, the endpoint itself is fine
+	ErrorExecution
+	ErrorOther
+)
+
+func (k ErrorKind) String() string {
+	return [...]string{"none", "rate_limited", "timeout", "header_not_found", "network", "execution", "other"}[k]
+}
+
+// Retryable tells whether the call may succeed on another endpoint
+func (k ErrorKind) Retryable() bool {
+	switch k {
+	case ErrorRateLimited, ErrorTimeout, ErrorHeaderNotFound, ErrorNetwork:
+		return true
+	}
+	return false
+}
+
+// ClassifyError tells what kind of failure err is.
+// A json-rpc error is an answer of the endpoint and is classified on its own, a revert reason
+// may say anything and must not pass for a network failure.
+func ClassifyError(err error) ErrorKind {
+	if err == nil {
+		return ErrorNone
+	}
+
+	var rpcErr *codec.ErrorObject
+	if errors.As(err, &rpcErr) {
+		return classifyRpcError(rpcErr)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+
+	switch msg := strings.ToLower(err.Error()); {
+	case containsAny(msg, "http status 429", "too many requests", "rate limit", "limit exceeded", "exceeded the quota"):
+		return ErrorRateLimited
+	case containsAny(msg, "timeout", "deadline exceeded", "timed out"):
+		return ErrorTimeout
+	case containsAny(msg, "connection refused", "connection reset", "eof", "no such host", "broken pipe", "http status 5"):
+		return ErrorNetwork
+	}
+	return ErrorOther
+}
+
+// classifyRpcError tells whether the endpoint refused a json-rpc request (rate limit, unknown
+// block) or answered it, which covers reverts and bad requests
+func classifyRpcError(e *codec.ErrorObject) ErrorKind {
+	msg := strings.ToLower(e.Message)
+	switch {
+	// 3 is a revert with data, its message is the reason
+	case e.Code == 3 || containsAny(msg, "revert", "invalid opcode", "out of gas", "insufficient funds", "nonce too low", "already known"):
+		return ErrorExecution
+	case e.Code == 429 || e.Code == -32005 || containsAny(msg, "too many requests", "rate limit", "limit exceeded", "exceeded the quota"):
+		return ErrorRateLimited
+	case containsAny(msg, "header not found", "unknown block", "missing trie node", "block not found"):
+		return ErrorHeaderNotFound
+	case containsAny(msg, "timeout", "timed out"):
+		return ErrorTimeout
+	}
+	return ErrorExecution
+}
+
+func containsAny(msg string, subs ...string) bool {
+	for _, s := range subs {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIdempotent tells whether a method can safely be sent again to another endpoint
+func isIdempotent(method string) bool {
+	switch method {
+	case "eth_sendRawTransaction", "eth_sendTransaction":
+		return false
+	}
+	return true
+}
+
+// endpointHealth is what we know about one endpoint
+type endpointHealth struct {
+	latency   time.Duration
+	errRate   float64
+	fails     int
+	openUntil time.Time
+	height    uint64
+	lastErr   string
+	requests  uint64
+	errors    uint64
+}
+
+// EndpointStatus is a snapshot of the health of one endpoint
+type EndpointStatus struct {
+	Url              string
+	Healthy          bool
+	CircuitOpen      bool
+	OpenUntil        time.Time
+	Latency          time.Duration
+	ErrorRate        float64
+	ConsecutiveFails int
+	Requests         uint64
+	Errors           uint64
+	Height           uint64
+	Lag              uint64
+	LastError        string
+}
+
+func (r *CClient) endpointHealth(url string) *endpointHealth {
+	h, ok := r.health[url]
+	if !ok {
+		h = &endpointHealth{}
+		r.health[url] = h
+	}
+	return h
+}
+
+func (r *CClient) maxHeight() (max uint64) {
+	for _, h := range r.health {
+		if h.height > max {
+			max = h.height
+		}
+	}
+	return
+}
+
+// usable tells whether url may be picked, r.healthLock must be held
+func (r *CClient) usable(url string, now time.Time) bool {
+	h := r.endpointHealth(url)
+	if now.Before(h.openUntil) {
+		return false
+	}
+	if h.height > 0 && r.MaxLag > 0 && r.maxHeight()-h.height > r.MaxLag {
+		return false
+	}
+	return true
+}
+
+// report records the outcome of a request sent to url
+func (r *CClient) report(url string, method string, latency time.Duration, result []byte, err error) {
+	kind := ClassifyError(err)
+
+	r.healthLock.Lock()
+	defer r.healthLock.Unlock()
+
+	h := r.endpointHealth(url)
+	h.requests++
+	alpha := r.EwmaAlpha
+	if h.latency == 0 {
+		h.latency = latency
+	} else {
+		h.latency = time.Duration(alpha*float64(latency) + (1-alpha)*float64(h.latency))
+	}
+
+	failed := 0.0
+	// an execution error is an answer, the endpoint is healthy
+	if err != nil && kind != ErrorExecution {
+		failed = 1
+		h.errors++
+		h.fails++
+		h.lastErr = err.Error()
+		if h.fails >= r.BreakerThreshold && r.BreakerThreshold > 0 {
+			h.openUntil = time.Now().Add(r.BreakerCooldown)
+			seelog.Warnf("circuit open for %v until %v: %v", url, h.openUntil, err)
+		}
+	} else {
+		h.fails = 0
+	}
+	h.errRate = alpha*failed + (1-alpha)*h.errRate
+
+	if err == nil && method == "eth_blockNumber" {
+		var s string
+		if len(result) > 2 {
+			s = strings.Trim(string(result), `"`)
+		}
+		if height, parseErr := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64); parseErr == nil {
+			h.height = height
+		}
+	}
+}
+
+// Status returns the health of every endpoint, unhealthy ones first
+func (r *CClient) Status() (status []*EndpointStatus) {
+	r.healthLock.Lock()
+	defer r.healthLock.Unlock()
+
+	now := time.Now()
+	max := r.maxHeight()
+	for url := range r.Clients {
+		h := r.endpointHealth(url)
+		s := &EndpointStatus{
+			Url:              url,
+			Healthy:          r.usable(url, now),
+			CircuitOpen:      now.Before(h.openUntil),
+			OpenUntil:        h.openUntil,
+			Latency:          h.latency,
+			ErrorRate:        h.errRate,
+			ConsecutiveFails: h.fails,
+			Requests:         h.requests,
+			Errors:           h.errors,
+			Height:           h.height,
+			LastError:        h.lastErr,
+		}
+		if h.height > 0 {
+			s.Lag = max - h.height
+		}
+		status = append(status, s)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		if status[i].Healthy != status[j].Healthy {
+			return !status[i].Healthy
+		}
+		return status[i].Url < status[j].Url
+	})
+	return
+}
+
+// RefreshHeights asks every endpoint for its block number, to measure how far each one lags
+func (r *CClient) RefreshHeights() {
+	for url, api := range r.Clients {
+		var result []byte
+		start := time.Now()
+		var out string
+		err := api.Call("eth_blockNumber", &out)
+		if err == nil {
+			result = []byte(strconv.Quote(out))
+		}
+		r.report(url, "eth_blockNumber", time.Since(start), result, err)
+	}
+}
+
+// StartHealthCheck refreshes the block heights every interval until stop is called
+func (r *CClient) StartHealthCheck(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			r.RefreshHeights()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// withEndpoint runs fn on an endpoint of apiList, on a retryable failure of an idempotent
+// request fn is run again on another endpoint, up to MaxRetries times
+func (r *CClient) withEndpoint(ctx context.Context, apiList []string, method string, idempotent bool, fn func(url string) ([]byte, error)) (err error) {
+	tried := map[string]bool{}
+	for attempt := 0; ; attempt++ {
+		var baseUrl string
+		baseUrl, err = r.getLock(ctx, apiList, tried)
+		if err != nil {
+			return
+		}
+		start := time.Now()
+		var result []byte
+		result, err = fn(baseUrl)
+		r.ReleaseLock(baseUrl)
+		if ctx.Err() != nil {
+			// our own cancellation says nothing about the endpoint
+			return ctx.Err()
+		}
+		r.report(baseUrl, method, time.Since(start), result, err)
+
+		if err == nil || !idempotent || attempt >= r.MaxRetries || !ClassifyError(err).Retryable() {
+			return
+		}
+		seelog.Debugf("retry %v on another endpoint, %v failed: %v", method, baseUrl, err)
+		tried[baseUrl] = true
+	}
+}
@@ -0,0 +1,75 @@
+package cclient_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"goutil/web3_util/cclient"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3/jsonrpc/codec"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want cclient.ErrorKind
+	}{
+		{nil, cclient.ErrorNone},
+		{fmt.Errorf("http status 429: slow down"), cclient.ErrorRateLimited},
+		{fmt.Errorf("c.client.Do: read: connection reset by peer"), cclient.ErrorNetwork},
+		{fmt.Errorf("c.client.Do: unexpected EOF"), cclient.ErrorNetwork},
+		{fmt.Errorf("http status 503: "), cclient.ErrorNetwork},
+		{&codec.ErrorObject{Code: -32005, Message: "limit exceeded"}, cclient.ErrorRateLimited},
+		{&codec.ErrorObject{Code: -32000, Message: "header not found"}, cclient.ErrorHeaderNotFound},
+		{&codec.ErrorObject{Code: -32602, Message: "invalid argument 0"}, cclient.ErrorExecution},
+		// reverts whose reason looks like a transport failure
+		{&codec.ErrorObject{Code: 3, Message: "execution reverted: 429"}, cclient.ErrorExecution},
+		{&codec.ErrorObject{Code: -32000, Message: "execution reverted: unexpected EOF in rate limit"}, cclient.ErrorExecution},
+		{fmt.Errorf("eth_call: %w", &codec.ErrorObject{Code: 3, Message: "execution reverted: timeout"}), cclient.ErrorExecution},
+		{errors.New("something else"), cclient.ErrorOther},
+	} {
+		if got := cclient.ClassifyError(c.err); got != c.want {
+			t.Errorf("ClassifyError(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestArchiveRoutingWithStateOverride(t *testing.T) {
+	read, archive := rpctest.NewServer(), rpctest.NewServer()
+	defer read.Close()
+	defer archive.Close()
+	read.SetBlockNumber(1000)
+	archive.SetBlockNumber(1000)
+	for _, node := range []*rpctest.Server{read, archive} {
+		node.Respond("eth_call", "0x")
+	}
+
+	c, err := cclient.NewWithOptions(&cclient.Options{
+		Read:    []*cclient.EndpointConfig{{Url: read.URL}},
+		Archive: []*cclient.EndpointConfig{{Url: archive.URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.EnableCache = false
+	var head string
+	if err = c.Call("eth_blockNumber", &head); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := map[string]interface{}{"to": "0x00000000000000000000000000000000000000aa", "data": "0x"}
+	override := map[string]interface{}{"0x00000000000000000000000000000000000000bb": map[string]interface{}{"balance": "0x1"}}
+	var out string
+	if err = c.Call("eth_call", &out, msg, "0x10", override); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Call("eth_call", &out, msg, "latest", override); err != nil {
+		t.Fatal(err)
+	}
+	if read.Count("eth_call") != 1 || archive.Count("eth_call") != 1 {
+		t.Fatalf("eth_call went %d times to read and %d to archive, want 1 and 1",
+			read.Count("eth_call"), archive.Count("eth_call"))
+	}
+}
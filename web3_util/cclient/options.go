@@ -0,0 +1,164 @@
+package cclient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// EndpointConfig describes one json-rpc endpoint
+type EndpointConfig struct {
+	Url string
+	// Rate is the allowed requests per second and Burst how many may go at once,
+	// a zero Rate means no limit
+	Rate  float64
+	Burst int
+	// Headers are added to every request, e.g. Authorization
+	Headers map[string]string
+	// Timeout overrides Options.Timeout
+	Timeout time.Duration
+}
+
+// Options configures a CClient
+type Options struct {
+	// Read endpoints serve queries, Write endpoints get transactions and
+	// Archive endpoints get calls pinned to blocks older than head-ArchiveAfter.
+	// Write and Archive default to Read.
+	Read         []*EndpointConfig
+	Write        []*EndpointConfig
+	Archive      []*EndpointConfig
+	ArchiveAfter uint64
+
+	Rdb          *redis.Client
+	RedisTimeout time.Duration
+	// ChainID keys the cache, read from the endpoints when 0
+	ChainID uint64
+
+	Timeout time.Duration
+}
+
+// EndpointsFromUrls builds endpoint configs limited to 2 requests per second,
+// which is what public BSC endpoints allow
+func EndpointsFromUrls(urls ...string) (endpoints []*EndpointConfig) {
+	for _, url := range urls {
+		endpoints = append(endpoints, &EndpointConfig{Url: url, Rate: 2, Burst: 1})
+	}
+	return
+}
+
+// rateLimiter is a token bucket, tokens below zero are requests already waiting
+type rateLimiter struct {
+	Rate   float64
+	Burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{Rate: rate, Burst: float64(burst), tokens: float64(burst)}
+}
+
+func (l *rateLimiter) refill(now time.Time) float64 {
+	tokens := l.tokens
+	if !l.last.IsZero() {
+		tokens += now.Sub(l.last).Seconds() * l.Rate
+	}
+	if tokens > l.Burst {
+		tokens = l.Burst
+	}
+	return tokens
+}
+
+// wait returns how long a request would have to wait, without taking a token
+func (l *rateLimiter) wait(now time.Time) time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+	tokens := l.refill(now) - 1
+	if tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tokens / l.Rate * float64(time.Second))
+}
+
+// take takes a token and returns how long the request has to wait for it
+func (l *rateLimiter) take(now time.Time) time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+	l.tokens = l.refill(now) - 1
+	l.last = now
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.Rate * float64(time.Second))
+}
+
+// give hands back a token taken for a request that was not sent
+func (l *rateLimiter) give() {
+	if l.Rate <= 0 {
+		return
+	}
+	l.tokens++
+	if l.tokens > l.Burst {
+		l.tokens = l.Burst
+	}
+}
+
+// pool returns the endpoints a request should be sent to
+func (r *CClient) pool(method string, params []interface{}) []string {
+	switch method {
+	case "eth_sendRawTransaction", "eth_sendTransaction":
+		return r.PostApiList
+	}
+	if r.isHistorical(method, params) {
+		return r.HistoryApiList
+	}
+	return r.QueryApiList
+}
+
+// blockParam returns the block parameter of method, by its position:
+// eth_call takes a state override after the block for instance
+func blockParam(method string, params []interface{}) (block string, ok bool) {
+	pos := -1
+	switch method {
+	case "eth_getBlockByNumber":
+		pos = 0
+	case "eth_call", "eth_getBalance", "eth_getCode", "eth_getTransactionCount":
+		pos = 1
+	case "eth_getStorageAt":
+		pos = 2
+	}
+	if pos < 0 || pos >= len(params) {
+		return
+	}
+	switch b := params[pos].(type) {
+	case string:
+		return b, true
+	case fmt.Stringer:
+		return b.String(), true
+	}
+	return
+}
+
+// isHistorical tells whether a request reads state of a block older than head-ArchiveAfter
+func (r *CClient) isHistorical(method string, params []interface{}) bool {
+	block, ok := blockParam(method, params)
+	if !ok {
+		return false
+	}
+	number, isNumber, _ := parseBlock(block)
+	if !isNumber {
+		// a tag like latest, or a block hash
+		return false
+	}
+
+	r.healthLock.Lock()
+	head := r.maxHeight()
+	r.healthLock.Unlock()
+	return head > 0 && number+r.ArchiveAfter < head
+}
@@ -0,0 +1,154 @@
+package cclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/panyanyany/go-web3/jsonrpc/codec"
+)
+
+// httpClient is a json-rpc client over http supporting headers, timeouts and batches,
+// it implements jsonrpc.IClient
+type httpClient struct {
+	Url     string
+	Headers map[string]string
+	client  *http.Client
+	nextID  uint64
+}
+
+func newHttpClient(cfg *EndpointConfig, timeout time.Duration) *httpClient {
+	if cfg.Timeout > 0 {
+		timeout = cfg.Timeout
+	}
+	return &httpClient{
+		Url:     cfg.Url,
+		Headers: cfg.Headers,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *httpClient) Close() error {
+	return nil
+}
+
+// Call implements jsonrpc.IClient
+func (c *httpClient) Call(method string, out interface{}, params ...interface{}) (err error) {
+	return c.CallContext(context.Background(), method, out, params...)
+}
+
+func (c *httpClient) CallContext(ctx context.Context, method string, out interface{}, params ...interface{}) (err error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	req := &rpcRequest{JsonRPC: "2.0", ID: atomic.AddUint64(&c.nextID, 1), Method: method, Params: params}
+	body, err := json.Marshal(req)
+	if err != nil {
+		err = fmt.Errorf("json.Marshal: %w", err)
+		return
+	}
+
+	bs, err := c.post(ctx, body)
+	if err != nil {
+		return
+	}
+
+	var response codec.Response
+	if err = json.Unmarshal(bs, &response); err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if err = json.Unmarshal(response.Result, out); err != nil {
+		err = fmt.Errorf("json.Unmarshal(result): %w", err)
+		return
+	}
+	return
+}
+
+// batch posts calls as a json-rpc array and fills their Result or Err
+func (c *httpClient) batch(ctx context.Context, calls []*rawCall) (err error) {
+	reqs := make([]*rpcRequest, len(calls))
+	for i, call := range calls {
+		params := call.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		reqs[i] = &rpcRequest{JsonRPC: "2.0", ID: uint64(i + 1), Method: call.Method, Params: params}
+	}
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		err = fmt.Errorf("json.Marshal: %w", err)
+		return
+	}
+
+	bs, err := c.post(ctx, body)
+	if err != nil {
+		return
+	}
+
+	var responses []*codec.Response
+	if err = json.Unmarshal(bs, &responses); err != nil {
+		// a node that does not support batches answers with a single error object
+		var single codec.Response
+		if json.Unmarshal(bs, &single) == nil && single.Error != nil {
+			err = single.Error
+			return
+		}
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+
+	byID := map[uint64]*codec.Response{}
+	for _, res := range responses {
+		byID[res.ID] = res
+	}
+	for i, call := range calls {
+		res, ok := byID[uint64(i+1)]
+		switch {
+		case !ok:
+			call.Err = fmt.Errorf("no response for %s in batch", call.Method)
+		case res.Error != nil:
+			call.Err = res.Error
+		default:
+			call.Result = res.Result
+		}
+	}
+	return
+}
+
+func (c *httpClient) post(ctx context.Context, body []byte) (bs []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Url, bytes.NewReader(body))
+	if err != nil {
+		err = fmt.Errorf("http.NewRequestWithContext: %w", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("c.client.Do: %w", err)
+		return
+	}
+	defer resp.Body.Close()
+	bs, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("ioutil.ReadAll: %w", err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http status %d: %s", resp.StatusCode, bs)
+		return
+	}
+	return
+}
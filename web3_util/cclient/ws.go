@@ -0,0 +1,663 @@
+package cclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goutil/web3_util/contract"
+
+	"github.com/cihub/seelog"
+	"github.com/gorilla/websocket"
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc"
+	"github.com/panyanyany/go-web3/jsonrpc/codec"
+)
+
+// maxEarly caps the notifications kept for a subscription id not known yet
+const maxEarly = 1024
+
+var (
+	ErrWsClosed       = errors.New("websocket closed")
+	ErrWsDisconnected = errors.New("websocket disconnected")
+)
+
+// WsClient is a json-rpc client over a websocket supporting eth_subscribe.
+// It reconnects and resubscribes by itself, and backfills the blocks and logs
+// missed while disconnected. It implements jsonrpc.IClient.
+type WsClient struct {
+	Url     string
+	Headers map[string]string
+	// Backfill fetches what was missed during a disconnection, usually the http CClient,
+	// the websocket itself is used when nil
+	Backfill jsonrpc.IClient
+	// MaxBackfill caps the number of blocks fetched after a reconnect
+	MaxBackfill       uint64
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	// CallTimeout applies to calls whose context has no deadline
+	CallTimeout time.Duration
+
+	connLock sync.Mutex
+	conn     *websocket.Conn
+	nextID   uint64
+
+	lock    sync.Mutex
+	pending map[uint64]chan *wsMessage
+	subs    map[*Subscription]bool
+	byID    map[string]*Subscription
+	// early holds the notifications that arrived before the eth_subscribe answer
+	early map[string]*earlyNotifications
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type wsMessage struct {
+	ID     *uint64            `json:"id"`
+	Method string             `json:"method"`
+	Params *wsNotification    `json:"params"`
+	Result json.RawMessage    `json:"result"`
+	Error  *codec.ErrorObject `json:"error"`
+}
+
+type earlyNotifications struct {
+	at   time.Time
+	msgs []json.RawMessage
+}
+
+type wsNotification struct {
+	Subscription string          `json:"subscription"`
+	Result       json.RawMessage `json:"result"`
+}
+
+func NewWsClient(url string, headers map[string]string) (c *WsClient, err error) {
+	c = &WsClient{
+		Url:               url,
+		Headers:           headers,
+		MaxBackfill:       1000,
+		ReconnectDelay:    time.Second,
+		MaxReconnectDelay: 30 * time.Second,
+		CallTimeout:       30 * time.Second,
+		pending:           map[uint64]chan *wsMessage{},
+		subs:              map[*Subscription]bool{},
+		byID:              map[string]*Subscription{},
+		early:             map[string]*earlyNotifications{},
+		closed:            make(chan struct{}),
+	}
+	conn, err := c.dial()
+	if err != nil {
+		return
+	}
+	c.conn = conn
+	go c.run(conn)
+	return
+}
+
+func (c *WsClient) dial() (conn *websocket.Conn, err error) {
+	header := http.Header{}
+	for k, v := range c.Headers {
+		header.Set(k, v)
+	}
+	conn, _, err = websocket.DefaultDialer.Dial(c.Url, header)
+	if err != nil {
+		err = fmt.Errorf("websocket.Dial(%v): %w", c.Url, err)
+		return
+	}
+	return
+}
+
+// Close closes the connection, subscriptions stop receiving
+func (c *WsClient) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.connLock.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.connLock.Unlock()
+	})
+	return nil
+}
+
+func (c *WsClient) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// run reads from conn and reconnects when it breaks
+func (c *WsClient) run(conn *websocket.Conn) {
+	for {
+		err := c.read(conn)
+		c.disconnected()
+		if c.isClosed() {
+			return
+		}
+		seelog.Warnf("websocket %v disconnected: %v", c.Url, err)
+
+		conn = c.reconnect()
+		if conn == nil {
+			return
+		}
+		go c.restore()
+	}
+}
+
+func (c *WsClient) read(conn *websocket.Conn) error {
+	for {
+		_, bs, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var msg wsMessage
+		if err = json.Unmarshal(bs, &msg); err != nil {
+			seelog.Debugf("bad websocket message: %v", err)
+			continue
+		}
+
+		if msg.Method == "eth_subscription" && msg.Params != nil {
+			c.lock.Lock()
+			sub := c.byID[msg.Params.Subscription]
+			if sub == nil {
+				c.keepEarly(msg.Params.Subscription, msg.Params.Result)
+			}
+			c.lock.Unlock()
+			if sub != nil {
+				sub.push(msg.Params.Result, true)
+			}
+			continue
+		}
+		if msg.ID != nil {
+			c.lock.Lock()
+			ch := c.pending[*msg.ID]
+			c.lock.Unlock()
+			if ch != nil {
+				ch <- &msg
+			}
+		}
+	}
+}
+
+// keepEarly holds a notification of an unknown subscription id until subscribe registers it,
+// the server may send it before answering eth_subscribe. Ids nobody claims expire after CallTimeout.
+// c.lock must be held.
+func (c *WsClient) keepEarly(id string, raw json.RawMessage) {
+	now := time.Now()
+	e := c.early[id]
+	if e == nil {
+		for other, e := range c.early {
+			if now.Sub(e.at) > c.CallTimeout {
+				delete(c.early, other)
+			}
+		}
+		e = &earlyNotifications{at: now}
+		c.early[id] = e
+	}
+	if len(e.msgs) < maxEarly {
+		e.msgs = append(e.msgs, raw)
+	}
+}
+
+// disconnected fails the calls waiting for an answer and forgets the subscription ids
+func (c *WsClient) disconnected() {
+	c.connLock.Lock()
+	c.conn = nil
+	c.connLock.Unlock()
+
+	c.lock.Lock()
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.byID = map[string]*Subscription{}
+	c.early = map[string]*earlyNotifications{}
+	c.lock.Unlock()
+}
+
+func (c *WsClient) reconnect() *websocket.Conn {
+	delay := c.ReconnectDelay
+	for {
+		select {
+		case <-c.closed:
+			return nil
+		case <-time.After(delay):
+		}
+		conn, err := c.dial()
+		if err == nil {
+			c.connLock.Lock()
+			c.conn = conn
+			c.connLock.Unlock()
+			seelog.Infof("websocket %v reconnected", c.Url)
+			return conn
+		}
+		seelog.Warnf("websocket reconnect: %v", err)
+		delay *= 2
+		if delay > c.MaxReconnectDelay {
+			delay = c.MaxReconnectDelay
+		}
+	}
+}
+
+// restore resubscribes after a reconnect and backfills what was missed
+func (c *WsClient) restore() {
+	c.lock.Lock()
+	subs := make([]*Subscription, 0, len(c.subs))
+	for sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	c.lock.Unlock()
+
+	for _, sub := range subs {
+		sub.hold()
+		ctx, cancel := context.WithTimeout(context.Background(), c.CallTimeout)
+		err := c.subscribe(ctx, sub)
+		if err == nil && sub.backfill != nil {
+			err = sub.backfill(ctx)
+		}
+		cancel()
+		sub.release()
+		if err != nil {
+			sub.fail(fmt.Errorf("resubscribe %v: %w", sub.Kind, err))
+		}
+	}
+}
+
+func (c *WsClient) write(bs []byte) error {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	if c.conn == nil {
+		return ErrWsDisconnected
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, bs)
+}
+
+// Call implements jsonrpc.IClient
+func (c *WsClient) Call(method string, out interface{}, params ...interface{}) error {
+	return c.CallContext(context.Background(), method, out, params...)
+}
+
+func (c *WsClient) CallContext(ctx context.Context, method string, out interface{}, params ...interface{}) (err error) {
+	if c.isClosed() {
+		return ErrWsClosed
+	}
+	if _, ok := ctx.Deadline(); !ok && c.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.CallTimeout)
+		defer cancel()
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	id := atomic.AddUint64(&c.nextID, 1)
+	body, err := json.Marshal(&rpcRequest{JsonRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		err = fmt.Errorf("json.Marshal: %w", err)
+		return
+	}
+
+	ch := make(chan *wsMessage, 1)
+	c.lock.Lock()
+	c.pending[id] = ch
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		delete(c.pending, id)
+		c.lock.Unlock()
+	}()
+
+	if err = c.write(body); err != nil {
+		return
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return ErrWsDisconnected
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if err = json.Unmarshal(msg.Result, out); err != nil {
+			err = fmt.Errorf("json.Unmarshal(%s): %w", method, err)
+			return
+		}
+		return
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return ErrWsClosed
+	}
+}
+
+func (c *WsClient) backfillClient() jsonrpc.IClient {
+	if c.Backfill != nil {
+		return c.Backfill
+	}
+	return c
+}
+
+func (c *WsClient) blockNumber(ctx context.Context) (uint64, error) {
+	var out string
+	if err := callContext(ctx, c.backfillClient(), "eth_blockNumber", &out); err != nil {
+		return 0, err
+	}
+	return contract.ParseHexUint64(out)
+}
+
+func (c *WsClient) subscribe(ctx context.Context, sub *Subscription) (err error) {
+	var id string
+	if err = c.CallContext(ctx, "eth_subscribe", &id, sub.params...); err != nil {
+		err = fmt.Errorf("eth_subscribe: %w", err)
+		return
+	}
+	c.lock.Lock()
+	sub.id = id
+	c.byID[id] = sub
+	c.subs[sub] = true
+	// pushed under the lock so that the read loop cannot deliver a later one first
+	if e := c.early[id]; e != nil {
+		delete(c.early, id)
+		for _, raw := range e.msgs {
+			sub.push(raw, true)
+		}
+	}
+	c.lock.Unlock()
+	return
+}
+
+func (c *WsClient) start(ctx context.Context, sub *Subscription) (*Subscription, error) {
+	if err := c.subscribe(ctx, sub); err != nil {
+		return nil, err
+	}
+	go sub.dispatch()
+	return sub, nil
+}
+
+// SubscribeNewHeads delivers every new block header on ch
+func (c *WsClient) SubscribeNewHeads(ctx context.Context, ch chan<- *web3.Block) (*Subscription, error) {
+	sub := newSubscription(c, "newHeads", "newHeads")
+	sub.handle = func(raw json.RawMessage) {
+		block := new(web3.Block)
+		if err := json.Unmarshal(raw, block); err != nil {
+			sub.fail(fmt.Errorf("json.Unmarshal(header): %w", err))
+			return
+		}
+		if !sub.first(block.Hash.String()) {
+			return
+		}
+		sub.advance(block.Number)
+		select {
+		case ch <- block:
+		case <-sub.done:
+		}
+	}
+	sub.backfill = func(ctx context.Context) error {
+		last := atomic.LoadUint64(&sub.last)
+		if last == 0 {
+			return nil
+		}
+		head, err := c.blockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		from := last + 1
+		if head >= from && head-from >= c.MaxBackfill {
+			from = head - c.MaxBackfill + 1
+		}
+		for n := from; n <= head; n++ {
+			var raw json.RawMessage
+			if err = callContext(ctx, c.backfillClient(), "eth_getBlockByNumber", &raw, fmt.Sprintf("0x%x", n), false); err != nil {
+				return fmt.Errorf("eth_getBlockByNumber(%v): %w", n, err)
+			}
+			sub.push(raw, false)
+		}
+		return nil
+	}
+	return c.start(ctx, sub)
+}
+
+// SubscribeLogs delivers the logs matching the address and topics of filter on ch,
+// removed logs of a reorg included. Its block range is ignored.
+func (c *WsClient) SubscribeLogs(ctx context.Context, filter *contract.LogFilter, ch chan<- *web3.Log) (*Subscription, error) {
+	live := contract.LogFilter{}
+	if filter != nil {
+		live.Address, live.Topics = filter.Address, filter.Topics
+	}
+	// the head at subscription time is where a backfill starts when no log came yet
+	head, err := c.blockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("eth_blockNumber: %w", err)
+	}
+
+	sub := newSubscription(c, "logs", "logs", &live)
+	sub.last = head
+	sub.handle = func(raw json.RawMessage) {
+		log := new(web3.Log)
+		if err := json.Unmarshal(raw, log); err != nil {
+			sub.fail(fmt.Errorf("json.Unmarshal(log): %w", err))
+			return
+		}
+		key := fmt.Sprintf("%s:%s:%d:%v", log.BlockHash, log.TransactionHash, log.LogIndex, log.Removed)
+		if !sub.first(key) {
+			return
+		}
+		sub.advance(log.BlockNumber)
+		select {
+		case ch <- log:
+		case <-sub.done:
+		}
+	}
+	sub.backfill = func(ctx context.Context) error {
+		head, err := c.blockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		// logs of the last block may have been delivered in part, duplicates are skipped
+		from := atomic.LoadUint64(&sub.last)
+		if head < from {
+			return nil
+		}
+		if head-from >= c.MaxBackfill {
+			from = head - c.MaxBackfill + 1
+		}
+		missed := live
+		var logs []json.RawMessage
+		if err = callContext(ctx, c.backfillClient(), "eth_getLogs", &logs, missed.SetRange(from, head)); err != nil {
+			return fmt.Errorf("eth_getLogs(%v-%v): %w", from, head, err)
+		}
+		for _, raw := range logs {
+			sub.push(raw, false)
+		}
+		return nil
+	}
+	return c.start(ctx, sub)
+}
+
+// SubscribePendingTransactions delivers the hashes of new pending transactions on ch,
+// those sent while disconnected are lost
+func (c *WsClient) SubscribePendingTransactions(ctx context.Context, ch chan<- web3.Hash) (*Subscription, error) {
+	sub := newSubscription(c, "newPendingTransactions", "newPendingTransactions")
+	sub.handle = func(raw json.RawMessage) {
+		var hash web3.Hash
+		if err := json.Unmarshal(raw, &hash); err != nil {
+			sub.fail(fmt.Errorf("json.Unmarshal(hash): %w", err))
+			return
+		}
+		select {
+		case ch <- hash:
+		case <-sub.done:
+		}
+	}
+	return c.start(ctx, sub)
+}
+
+// Subscription is an eth_subscribe subscription surviving reconnects
+type Subscription struct {
+	Kind     string
+	client   *WsClient
+	params   []interface{}
+	id       string
+	handle   func(raw json.RawMessage)
+	backfill func(ctx context.Context) error
+
+	// last is the highest block delivered
+	last uint64
+	seen map[string]bool
+
+	lock    sync.Mutex
+	queue   []json.RawMessage
+	held    []json.RawMessage
+	holding bool
+	wake    chan struct{}
+
+	err  chan error
+	done chan struct{}
+	once sync.Once
+}
+
+func newSubscription(c *WsClient, kind string, params ...interface{}) *Subscription {
+	return &Subscription{
+		Kind:   kind,
+		client: c,
+		params: params,
+		seen:   map[string]bool{},
+		wake:   make(chan struct{}, 1),
+		err:    make(chan error, 8),
+		done:   make(chan struct{}),
+	}
+}
+
+// Err delivers the errors met while decoding, resubscribing or backfilling
+func (s *Subscription) Err() <-chan error {
+	return s.err
+}
+
+// Unsubscribe stops the subscription
+func (s *Subscription) Unsubscribe() (err error) {
+	s.once.Do(func() {
+		close(s.done)
+		c := s.client
+		c.lock.Lock()
+		delete(c.subs, s)
+		delete(c.byID, s.id)
+		id := s.id
+		c.lock.Unlock()
+
+		var ok bool
+		err = c.Call("eth_unsubscribe", &ok, id)
+		if errors.Is(err, ErrWsDisconnected) || errors.Is(err, ErrWsClosed) {
+			// the server forgot it already
+			err = nil
+		}
+	})
+	return
+}
+
+func (s *Subscription) fail(err error) {
+	select {
+	case s.err <- err:
+	default:
+		seelog.Warnf("subscription %v: %v", s.Kind, err)
+	}
+}
+
+// first tells whether key is seen for the first time
+func (s *Subscription) first(key string) bool {
+	if s.seen[key] {
+		return false
+	}
+	if len(s.seen) >= 4096 {
+		s.seen = map[string]bool{}
+	}
+	s.seen[key] = true
+	return true
+}
+
+func (s *Subscription) advance(number uint64) {
+	if number > atomic.LoadUint64(&s.last) {
+		atomic.StoreUint64(&s.last, number)
+	}
+}
+
+// push queues a notification, live ones are held back while a backfill runs
+// so that everything is delivered in order
+func (s *Subscription) push(raw json.RawMessage, live bool) {
+	s.lock.Lock()
+	if live && s.holding {
+		s.held = append(s.held, raw)
+	} else {
+		s.queue = append(s.queue, raw)
+	}
+	s.lock.Unlock()
+	s.notify()
+}
+
+func (s *Subscription) hold() {
+	s.lock.Lock()
+	s.holding = true
+	s.lock.Unlock()
+}
+
+func (s *Subscription) release() {
+	s.lock.Lock()
+	s.holding = false
+	s.queue = append(s.queue, s.held...)
+	s.held = nil
+	s.lock.Unlock()
+	s.notify()
+}
+
+func (s *Subscription) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands the queued notifications to the handler, out of the read loop
+// so that a slow consumer making calls cannot block their responses
+func (s *Subscription) dispatch() {
+	for {
+		s.lock.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.lock.Unlock()
+
+		for _, raw := range queue {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.handle(raw)
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-s.client.closed:
+			return
+		case <-s.wake:
+		}
+	}
+}
+
+// callContext calls client with ctx when it supports it
+func callContext(ctx context.Context, client jsonrpc.IClient, method string, out interface{}, params ...interface{}) error {
+	if cc, ok := client.(interface {
+		CallContext(ctx context.Context, method string, out interface{}, params ...interface{}) error
+	}); ok {
+		return cc.CallContext(ctx, method, out, params...)
+	}
+	return client.Call(method, out, params...)
+}
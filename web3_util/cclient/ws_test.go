@@ -0,0 +1,87 @@
+package cclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goutil/web3_util/cclient"
+	"goutil/web3_util/contract"
+
+	"github.com/gorilla/websocket"
+	"github.com/panyanyany/go-web3"
+)
+
+// wsNode answers eth_blockNumber and sends the first notification of a subscription
+// before the eth_subscribe answer, as nodes behind a load balancer sometimes do
+func wsNode(t *testing.T, filters chan<- json.RawMessage) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req struct {
+				ID     uint64            `json:"id"`
+				Method string            `json:"method"`
+				Params []json.RawMessage `json:"params"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			switch req.Method {
+			case "eth_blockNumber":
+				conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": "0x10"})
+			case "eth_subscribe":
+				filters <- req.Params[1]
+				log := map[string]interface{}{
+					"address": "0x00000000000000000000000000000000000000aa", "topics": []string{},
+					"data": "0x", "blockNumber": "0x11", "logIndex": "0x0",
+					"transactionHash": "0x" + strings.Repeat("1", 64), "blockHash": "0x" + strings.Repeat("2", 64),
+					"transactionIndex": "0x0", "removed": false,
+				}
+				conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "method": "eth_subscription",
+					"params": map[string]interface{}{"subscription": "0xs1", "result": log}})
+				time.Sleep(20 * time.Millisecond)
+				conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": "0xs1"})
+			}
+		}
+	}))
+}
+
+func TestWsNotificationBeforeSubscribeAnswer(t *testing.T) {
+	filters := make(chan json.RawMessage, 1)
+	srv := wsNode(t, filters)
+	defer srv.Close()
+	c, err := cclient.NewWsClient("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ch := make(chan *web3.Log, 1)
+	filter := &contract.LogFilter{Address: []web3.Address{web3.HexToAddress("0xaa")}}
+	sub, err := c.SubscribeLogs(context.Background(), filter.SetRange(1, 2), ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(<-filters); strings.Contains(got, "fromBlock") || !strings.Contains(got, "address") {
+		t.Fatalf("subscribed with %s, want the address and no range", got)
+	}
+	select {
+	case log := <-ch:
+		if log.BlockNumber != 0x11 {
+			t.Fatalf("got a log of block %d, want 17", log.BlockNumber)
+		}
+	case err = <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification sent before the eth_subscribe answer was lost")
+	}
+}
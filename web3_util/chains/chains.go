@@ -0,0 +1,374 @@
+package chains
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goutil/web3_util/abis"
+	"goutil/web3_util/contract"
+
+	"github.com/panyanyany/go-web3"
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed chains.json
+var embedded []byte
+
+// Token is an ERC20 token of a chain, Symbol is its key in Chain.Tokens
+type Token struct {
+	Symbol   string       `json:"-"`
+	Name     string       `json:"name"`
+	Address  web3.Address `json:"address"`
+	Decimals int          `json:"decimals"`
+}
+
+// Chain describes a network and the contracts we use on it
+type Chain struct {
+	Name string `json:"-"`
+	// Extends names the chain this one starts as a copy of, e.g. a local fork
+	Extends string `json:"extends,omitempty"`
+
+	ChainID       uint64            `json:"chainId"`
+	NativeSymbol  string            `json:"nativeSymbol"`
+	WrappedNative string            `json:"wrappedNative"`
+	Stablecoins   []string          `json:"stablecoins"`
+	Tokens        map[string]*Token `json:"tokens"`
+
+	// the uniswap v2 style dex and Multicall3
+	Factory   web3.Address `json:"factory"`
+	Router    web3.Address `json:"router"`
+	Multicall web3.Address `json:"multicall"`
+	// Contracts are other named contracts
+	Contracts map[string]web3.Address `json:"contracts"`
+
+	// BlockTime is in seconds
+	BlockTime   float64 `json:"blockTime"`
+	Explorer    string  `json:"explorer"`
+	ExplorerApi string  `json:"explorerApi"`
+	// ExplorerApiKey is best given in a user override file
+	ExplorerApiKey string   `json:"explorerApiKey,omitempty"`
+	Rpc            []string `json:"rpc"`
+}
+
+// Token returns the token of symbol
+func (c *Chain) Token(symbol string) (token *Token, err error) {
+	token, ok := c.Tokens[symbol]
+	if !ok {
+		err = fmt.Errorf("no token %s on %s", symbol, c.Name)
+		return
+	}
+	return
+}
+
+// WrappedNativeToken returns WBNB, WETH and the like
+func (c *Chain) WrappedNativeToken() (*Token, error) {
+	return c.Token(c.WrappedNative)
+}
+
+// StableTokens returns the stablecoins, in order of preference
+func (c *Chain) StableTokens() (tokens []*Token, err error) {
+	for _, symbol := range c.Stablecoins {
+		var token *Token
+		token, err = c.Token(symbol)
+		if err != nil {
+			return
+		}
+		tokens = append(tokens, token)
+	}
+	return
+}
+
+// Contract returns the address of a contract of Contracts
+func (c *Chain) Contract(name string) (addr web3.Address, err error) {
+	addr, ok := c.Contracts[name]
+	if !ok {
+		err = fmt.Errorf("no contract %s on %s", name, c.Name)
+		return
+	}
+	return
+}
+
+func (c *Chain) BlockDuration() time.Duration {
+	return time.Duration(c.BlockTime * float64(time.Second))
+}
+
+// ResourceName is the chain whose resources, like ABI files, apply to this one
+func (c *Chain) ResourceName() string {
+	if c.Extends != "" {
+		return c.Extends
+	}
+	return c.Name
+}
+
+// NewContract returns a contract of the chain, its ABI is looked up under the chain resources
+func (c *Chain) NewContract(name string, symbol string, addr web3.Address, decimals int) *contract.Contract {
+	return &contract.Contract{Name: name, Symbol: symbol, Address: addr, Decimals: decimals, ChainName: c.ResourceName()}
+}
+
+// TokenContract returns the token of symbol as a contract
+func (c *Chain) TokenContract(symbol string) (*contract.Contract, error) {
+	token, err := c.Token(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewContract(token.Symbol, token.Symbol, token.Address, token.Decimals), nil
+}
+
+func (c *Chain) TxUrl(hash web3.Hash) string {
+	return fmt.Sprintf("%s/tx/%s", c.Explorer, hash)
+}
+
+func (c *Chain) AddressUrl(addr web3.Address) string {
+	return fmt.Sprintf("%s/address/%s", c.Explorer, addr)
+}
+
+func (c *Chain) clone() (*Chain, error) {
+	bs, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	out := new(Chain)
+	if err = json.Unmarshal(bs, out); err != nil {
+		return nil, err
+	}
+	out.Name = c.Name
+	return out, nil
+}
+
+// Registry holds chains by name
+type Registry struct {
+	lock   sync.RWMutex
+	chains map[string]*Chain
+}
+
+func NewRegistry() *Registry {
+	return &Registry{chains: map[string]*Chain{}}
+}
+
+// Default holds the embedded chains: bsc, bsc-testnet, ethereum, polygon and local,
+// their explorer apis are used by abis.Default to download ABIs
+var Default = mustDefault()
+
+func mustDefault() *Registry {
+	r := NewRegistry()
+	if err := r.Load(embedded, ".json"); err != nil {
+		panic(fmt.Errorf("embedded chains: %w", err))
+	}
+	r.RegisterExplorers(abis.Default.Explorer)
+	return r
+}
+
+// RegisterExplorers sets the explorer apis of the chains on e
+func (r *Registry) RegisterExplorers(e *abis.Explorer) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for name, c := range r.chains {
+		e.SetApi(name, c.ExplorerApi, c.ExplorerApiKey)
+	}
+}
+
+func Get(name string) (*Chain, error) {
+	return Default.Get(name)
+}
+
+func MustGet(name string) *Chain {
+	c, err := Default.Get(name)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func ByID(chainID uint64) (*Chain, error) {
+	return Default.ByID(chainID)
+}
+
+// LoadFile applies the overrides of a json or yaml file to the default registry
+func LoadFile(path string) error {
+	if err := Default.LoadFile(path); err != nil {
+		return err
+	}
+	Default.RegisterExplorers(abis.Default.Explorer)
+	return nil
+}
+
+// Get returns the chain of name, it is shared and must not be modified
+func (r *Registry) Get(name string) (*Chain, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	c, ok := r.chains[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown chain %q", name)
+	}
+	return c, nil
+}
+
+func (r *Registry) ByID(chainID uint64) (*Chain, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, name := range r.names() {
+		if c := r.chains[name]; c.ChainID == chainID {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown chain id %d", chainID)
+}
+
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.names()
+}
+
+func (r *Registry) names() (names []string) {
+	for name := range r.chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Add registers c under c.Name, replacing the chain of that name
+func (r *Registry) Add(c *Chain) {
+	r.lock.Lock()
+	r.chains[c.Name] = c
+	r.lock.Unlock()
+}
+
+func (r *Registry) LoadFile(path string) (err error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("ioutil.ReadFile: %w", err)
+		return
+	}
+	err = r.Load(bs, filepath.Ext(path))
+	if err != nil {
+		err = fmt.Errorf("r.Load(%v): %w", path, err)
+		return
+	}
+	return
+}
+
+// Load reads chains by name from json, or yaml when ext is .yaml or .yml.
+// The fields given override those of a chain already known, a new chain
+// starts as a copy of the one it extends.
+func (r *Registry) Load(data []byte, ext string) (err error) {
+	if ext == ".yaml" || ext == ".yml" {
+		data, err = yamlToJson(data)
+		if err != nil {
+			return
+		}
+	}
+	var raws map[string]json.RawMessage
+	if err = json.Unmarshal(data, &raws); err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	loaded := map[string]bool{}
+	var load func(name string, depth int) error
+	load = func(name string, depth int) error {
+		if loaded[name] {
+			return nil
+		}
+		if depth > len(raws) {
+			return fmt.Errorf("chain %s extends itself", name)
+		}
+		raw := raws[name]
+
+		var head struct {
+			Extends string `json:"extends"`
+		}
+		if err := json.Unmarshal(raw, &head); err != nil {
+			return fmt.Errorf("chain %s: %w", name, err)
+		}
+
+		var c *Chain
+		var err error
+		if old, ok := r.chains[name]; ok {
+			c, err = old.clone()
+		} else if head.Extends != "" {
+			if _, ok := raws[head.Extends]; ok {
+				if err = load(head.Extends, depth+1); err != nil {
+					return err
+				}
+			}
+			base, ok := r.chains[head.Extends]
+			if !ok {
+				return fmt.Errorf("chain %s extends unknown %s", name, head.Extends)
+			}
+			c, err = base.clone()
+		} else {
+			c = &Chain{}
+		}
+		if err != nil {
+			return fmt.Errorf("chain %s: %w", name, err)
+		}
+
+		if err = json.Unmarshal(raw, c); err != nil {
+			return fmt.Errorf("chain %s: %w", name, err)
+		}
+		c.Name = name
+		for symbol, token := range c.Tokens {
+			token.Symbol = symbol
+		}
+		r.chains[name] = c
+		loaded[name] = true
+		return nil
+	}
+
+	names := make([]string, 0, len(raws))
+	for name := range raws {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = load(name, 0); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// yamlToJson converts yaml to json, whose decoding handles addresses and the merging of overrides
+func yamlToJson(data []byte) (out []byte, err error) {
+	var v interface{}
+	if err = yaml.Unmarshal(data, &v); err != nil {
+		err = fmt.Errorf("yaml.Unmarshal: %w", err)
+		return
+	}
+	out, err = json.Marshal(jsonValue(v))
+	if err != nil {
+		err = fmt.Errorf("json.Marshal: %w", err)
+		return
+	}
+	return
+}
+
+// jsonValue turns the map[interface{}]interface{} of yaml into map[string]interface{}
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[strings.TrimSpace(fmt.Sprint(k))] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,176 @@
+package chains_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"goutil/web3_util/chains"
+
+	"github.com/panyanyany/go-web3"
+)
+
+func TestEmbedded(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		chainID  uint64
+		usdt     string
+		decimals int
+	}{
+		{"bsc", 56, "0x55d398326f99059fF775485246999027B3197955", 18},
+		{"ethereum", 1, "0xdAC17F958D2ee523a2206206994597C13D831ec7", 6},
+		{"polygon", 137, "0xc2132D05D31c914a87C6611C10748AEb04B58e8F", 6},
+	} {
+		chain, err := chains.Get(c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chain.Name != c.name || chain.ChainID != c.chainID {
+			t.Fatalf("%s: name %s chain id %d", c.name, chain.Name, chain.ChainID)
+		}
+		usdt, err := chain.Token("USDT")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usdt.Symbol != "USDT" || usdt.Address != web3.HexToAddress(c.usdt) || usdt.Decimals != c.decimals {
+			t.Fatalf("%s: USDT %s with %d decimals", c.name, usdt.Address, usdt.Decimals)
+		}
+		if _, err = chain.WrappedNativeToken(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = chain.StableTokens(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bsc := chains.MustGet("bsc")
+	stables, _ := bsc.StableTokens()
+	if len(stables) != 3 || stables[0].Symbol != "BUSD" {
+		t.Fatalf("bsc stablecoins %v, want BUSD first", bsc.Stablecoins)
+	}
+	if _, err := bsc.Token("DAI"); err == nil {
+		t.Fatal("Token of a missing symbol gave no error")
+	}
+	if _, err := chains.Get("solana"); err == nil {
+		t.Fatal("Get of an unknown chain gave no error")
+	}
+}
+
+// local is a fork of bsc: its tokens and resources are those of bsc
+func TestEmbeddedExtends(t *testing.T) {
+	local := chains.MustGet("local")
+	if local.ChainID != 1337 || local.Router != chains.MustGet("bsc").Router || local.Rpc[0] != "http://127.0.0.1:8545" {
+		t.Fatalf("local chain id %d router %s rpc %v", local.ChainID, local.Router, local.Rpc)
+	}
+	wbnb, err := local.TokenContract("WBNB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wbnb.ChainName != "bsc" || local.ResourceName() != "bsc" {
+		t.Fatalf("resources of %s, want bsc", wbnb.ChainName)
+	}
+}
+
+const base = `{
+  "bsc": {
+    "chainId": 56,
+    "wrappedNative": "WBNB",
+    "tokens": {"WBNB": {"name": "Wrapped BNB", "address": "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c", "decimals": 18}},
+    "router": "0x10ED43C718714eb63d5aA57B78B54704E256024E",
+    "rpc": ["https://bsc-dataseed.binance.org"]
+  }
+}`
+
+const override = `
+bsc:
+  rpc: [https://my-node]
+  explorerApiKey: KEY
+  tokens:
+    CAKE: {name: PancakeSwap Token, address: "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82", decimals: 18}
+fork:
+  extends: bsc
+  chainId: 31337
+`
+
+func TestLoadYamlOverride(t *testing.T) {
+	r := chains.NewRegistry()
+	if err := r.Load([]byte(base), ".json"); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "chains")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chains.yaml")
+	if err = ioutil.WriteFile(path, []byte(override), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	bsc, err := r.Get("bsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fields given are replaced, the others kept
+	if len(bsc.Rpc) != 1 || bsc.Rpc[0] != "https://my-node" || bsc.ExplorerApiKey != "KEY" || bsc.ChainID != 56 ||
+		bsc.Router != web3.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E") {
+		t.Fatalf("bsc after override: rpc %v key %s chain id %d router %s", bsc.Rpc, bsc.ExplorerApiKey, bsc.ChainID, bsc.Router)
+	}
+	if _, err = bsc.Token("WBNB"); err != nil {
+		t.Fatal(err)
+	}
+	cake, err := bsc.Token("CAKE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cake.Symbol != "CAKE" || cake.Decimals != 18 {
+		t.Fatalf("CAKE %+v", cake)
+	}
+
+	fork, err := r.Get("fork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.ChainID != 31337 || fork.Rpc[0] != "https://my-node" || fork.ResourceName() != "bsc" {
+		t.Fatalf("fork chain id %d rpc %v resources %s", fork.ChainID, fork.Rpc, fork.ResourceName())
+	}
+	if _, err = fork.Token("CAKE"); err != nil {
+		t.Fatal(err)
+	}
+	// a copy, not the bsc chain itself
+	fork.Tokens["X"] = &chains.Token{}
+	if _, ok := bsc.Tokens["X"]; ok {
+		t.Fatal("fork shares its tokens with bsc")
+	}
+}
+
+func TestLoadExtendsErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"fork": {"extends": "nowhere"}}`,
+		`{"a": {"extends": "b"}, "b": {"extends": "a"}}`,
+		`{"bsc": {"chainId": "56"}}`,
+	} {
+		if err := chains.NewRegistry().Load([]byte(data), ".json"); err == nil {
+			t.Errorf("Load(%s) gave no error", data)
+		}
+	}
+}
+
+func TestByID(t *testing.T) {
+	for id, name := range map[uint64]string{56: "bsc", 97: "bsc-testnet", 1: "ethereum", 137: "polygon", 1337: "local"} {
+		c, err := chains.ByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Name != name {
+			t.Errorf("ByID(%d) = %s, want %s", id, c.Name, name)
+		}
+	}
+	if _, err := chains.ByID(12345); err == nil {
+		t.Fatal("ByID of an unknown chain id gave no error")
+	}
+}
@@ -0,0 +1,100 @@
+package contract
+
+import (
+	"fmt"
+	"math/big"
+
+	"goutil/web3_util"
+)
+
+// TokenAmount is a raw token amount with the decimals it is expressed in
+type TokenAmount struct {
+	Raw      *big.Int
+	Decimals int
+}
+
+func NewTokenAmount(raw *big.Int, decimals int) *TokenAmount {
+	if raw == nil {
+		raw = new(big.Int)
+	}
+	return &TokenAmount{Raw: raw, Decimals: decimals}
+}
+
+// ParseTokenAmount reads a human amount such as "1.5" exactly,
+// more fractional digits than decimals are an error unless they are zeros
+func ParseTokenAmount(s string, decimals int) (a *TokenAmount, err error) {
+	d, err := web3_util.ParseDecimal(s)
+	if err != nil {
+		err = fmt.Errorf("bad amount %q: %w", s, err)
+		return
+	}
+	raw, err := d.Wei(decimals)
+	if err != nil {
+		err = fmt.Errorf("amount %q: %w", s, err)
+		return
+	}
+	return NewTokenAmount(raw, decimals), nil
+}
+
+// Decimal is the exact amount in units
+func (a *TokenAmount) Decimal() web3_util.Decimal {
+	return web3_util.FromWeiDecimal(a.Raw, a.Decimals)
+}
+
+// String formats the amount in units, without trailing zeros
+func (a *TokenAmount) String() string {
+	return a.Format(-1)
+}
+
+// Format formats the amount with at most prec fractional digits, truncating.
+// A negative prec keeps all the digits but the trailing zeros.
+func (a *TokenAmount) Format(prec int) string {
+	d := a.Decimal()
+	if prec >= 0 {
+		d = d.Round(prec, web3_util.RoundDown)
+	}
+	return d.String()
+}
+
+// Float is the amount as a big.Float, for display or rough maths only
+func (a *TokenAmount) Float() *big.Float {
+	f := new(big.Float).SetInt(a.Raw)
+	return f.Quo(f, new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(a.Decimals)), nil)))
+}
+
+func (a *TokenAmount) IsZero() bool {
+	return a.Raw.Sign() == 0
+}
+
+// rescale returns the raw amounts of a and b in the larger of their decimals, which is exact
+func rescale(a, b *TokenAmount) (x, y *big.Int, decimals int) {
+	x, y, decimals = a.Raw, b.Raw, a.Decimals
+	if b.Decimals > decimals {
+		decimals = b.Decimals
+	}
+	scale := func(raw *big.Int, from int) *big.Int {
+		if from == decimals {
+			return raw
+		}
+		return new(big.Int).Mul(raw, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals-from)), nil))
+	}
+	return scale(x, a.Decimals), scale(y, b.Decimals), decimals
+}
+
+// Cmp compares the amounts, those of different decimals are rescaled first
+func (a *TokenAmount) Cmp(b *TokenAmount) int {
+	x, y, _ := rescale(a, b)
+	return x.Cmp(y)
+}
+
+// Add returns a + b in the larger of their decimals
+func (a *TokenAmount) Add(b *TokenAmount) *TokenAmount {
+	x, y, decimals := rescale(a, b)
+	return NewTokenAmount(new(big.Int).Add(x, y), decimals)
+}
+
+// Sub returns a - b in the larger of their decimals
+func (a *TokenAmount) Sub(b *TokenAmount) *TokenAmount {
+	x, y, decimals := rescale(a, b)
+	return NewTokenAmount(new(big.Int).Sub(x, y), decimals)
+}
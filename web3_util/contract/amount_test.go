@@ -0,0 +1,71 @@
+package contract_test
+
+import (
+	"testing"
+
+	"goutil/web3_util/contract"
+)
+
+func TestTokenAmount(t *testing.T) {
+	for _, c := range []struct {
+		in       string
+		decimals int
+		raw      string
+		str      string
+		fixed2   string
+	}{
+		{"1.5", 18, "1500000000000000000", "1.5", "1.5"},
+		{"-0.001", 18, "-1000000000000000", "-0.001", "0"},
+		{"0.123450", 5, "12345", "0.12345", "0.12"},
+		{"+42", 0, "42", "42", "42"},
+		{".5", 6, "500000", "0.5", "0.5"},
+		{"1e-6", 6, "1", "0.000001", "0"},
+	} {
+		a, err := contract.ParseTokenAmount(c.in, c.decimals)
+		if err != nil {
+			t.Fatalf("ParseTokenAmount(%q, %d): %v", c.in, c.decimals, err)
+		}
+		if a.Raw.String() != c.raw {
+			t.Errorf("ParseTokenAmount(%q, %d) = %s, want %s", c.in, c.decimals, a.Raw, c.raw)
+		}
+		if a.String() != c.str || a.Format(2) != c.fixed2 {
+			t.Errorf("%q formats as %s and %s, want %s and %s", c.in, a, a.Format(2), c.str, c.fixed2)
+		}
+	}
+	for _, in := range []string{"", ".", "1.2.3", "abc", "0.0000001"} {
+		if _, err := contract.ParseTokenAmount(in, 6); err == nil {
+			t.Errorf("ParseTokenAmount(%q, 6) gave no error", in)
+		}
+	}
+}
+
+// amounts of different decimals are rescaled to the larger ones
+func TestTokenAmountMixedDecimals(t *testing.T) {
+	parse := func(s string, decimals int) *contract.TokenAmount {
+		a, err := contract.ParseTokenAmount(s, decimals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	usdt6, usdt18 := parse("1.5", 6), parse("1.5", 18)
+	if usdt6.Cmp(usdt18) != 0 || usdt18.Cmp(usdt6) != 0 {
+		t.Fatalf("1.5 with 6 and 18 decimals compare as %d and %d", usdt6.Cmp(usdt18), usdt18.Cmp(usdt6))
+	}
+	if c := parse("1.4999999", 18).Cmp(usdt6); c != -1 {
+		t.Fatalf("1.4999999 compares to 1.5 as %d", c)
+	}
+
+	sum := usdt6.Add(parse("0.000000000000000001", 18))
+	if sum.Decimals != 18 || sum.String() != "1.500000000000000001" {
+		t.Fatalf("sum %s with %d decimals", sum, sum.Decimals)
+	}
+	diff := parse("2", 0).Sub(usdt6)
+	if diff.Decimals != 6 || diff.String() != "0.5" {
+		t.Fatalf("difference %s with %d decimals", diff, diff.Decimals)
+	}
+	// same decimals are kept as they are
+	if sum = usdt6.Add(usdt6); sum.Decimals != 6 || sum.Raw.Int64() != 3000000 {
+		t.Fatalf("sum %s with %d decimals", sum.Raw, sum.Decimals)
+	}
+}
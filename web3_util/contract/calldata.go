@@ -0,0 +1,82 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/panyanyany/go-web3/abi"
+)
+
+// MethodByID finds the method whose 4-byte selector is id
+func (c *Contract) MethodByID(id []byte) (*abi.Method, bool) {
+	for _, m := range c.Abi.Methods {
+		if bytes.Equal(m.ID(), id) {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// EncodeInput builds the calldata of a call to method
+func (c *Contract) EncodeInput(method string, args ...interface{}) (data []byte, err error) {
+	m, ok := c.Abi.Methods[method]
+	if !ok {
+		err = fmt.Errorf("method %s not found in Contract.Abi.Methods[method]", method)
+		return
+	}
+	data, err = abi.Encode(args, m.Inputs)
+	if err != nil {
+		err = fmt.Errorf("abi.Encode(%s): %w", method, err)
+		return
+	}
+	data = append(m.ID(), data...)
+	return
+}
+
+// DecodeInput matches the selector of the calldata against the abi and decodes the arguments
+func (c *Contract) DecodeInput(data []byte) (method string, args map[string]interface{}, err error) {
+	if len(data) < 4 {
+		err = fmt.Errorf("calldata too short: %d bytes", len(data))
+		return
+	}
+	m, ok := c.MethodByID(data[:4])
+	if !ok {
+		err = fmt.Errorf("no method of Contract.Abi matches selector 0x%s", hex.EncodeToString(data[:4]))
+		return
+	}
+
+	args = map[string]interface{}{}
+	if len(m.Inputs.TupleElems()) > 0 {
+		var respInterface interface{}
+		respInterface, err = abi.Decode(m.Inputs, data[4:])
+		if err != nil {
+			err = fmt.Errorf("abi.Decode(%s): %w", m.Name, err)
+			return
+		}
+		args = respInterface.(map[string]interface{})
+	}
+	method = m.Name
+	return
+}
+
+// DecodeOutput decodes the return data of a call to method
+func (c *Contract) DecodeOutput(method string, data []byte) (resp map[string]interface{}, err error) {
+	m, ok := c.Abi.Methods[method]
+	if !ok {
+		err = fmt.Errorf("method %s not found in Contract.Abi.Methods[method]", method)
+		return
+	}
+
+	resp = map[string]interface{}{}
+	if m.Outputs == nil || len(m.Outputs.TupleElems()) == 0 {
+		return
+	}
+	respInterface, err := abi.Decode(m.Outputs, data)
+	if err != nil {
+		err = fmt.Errorf("abi.Decode(%s): %w", m.Name, err)
+		return
+	}
+	resp = respInterface.(map[string]interface{})
+	return
+}
@@ -0,0 +1,132 @@
+package contract_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+// transfer(0x…dd, 1e18)
+const transferInput = "a9059cbb" +
+	"00000000000000000000000000000000000000000000000000000000000000dd" +
+	"0000000000000000000000000000000000000000000000000de0b6b3a7640000"
+
+func TestDecodeInput(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	c := newTokenContract(t, node)
+	data, _ := hex.DecodeString(transferInput)
+
+	method, args, err := c.DecodeInput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != "transfer" || args["to"] != holder || args["amount"].(*big.Int).Cmp(big.NewInt(1e18)) != 0 {
+		t.Fatalf("DecodeInput() = %s %v", method, args)
+	}
+	encoded, err := c.EncodeInput("transfer", holder, big.NewInt(1e18))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(encoded) != transferInput {
+		t.Fatalf("EncodeInput() = %x", encoded)
+	}
+
+	for _, bad := range []string{"a905", "deadbeef", "a9059cbb00"} {
+		data, _ = hex.DecodeString(bad)
+		if _, _, err = c.DecodeInput(data); err == nil {
+			t.Errorf("DecodeInput(%s) gave no error", bad)
+		}
+	}
+
+	// true
+	out, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000001")
+	resp, err := c.DecodeOutput("transfer", out)
+	if err != nil || resp["0"] != true {
+		t.Fatalf("DecodeOutput() = %v, %v", resp, err)
+	}
+}
+
+// sendPending sends a transaction to the node, which mines it at once,
+// the watcher only sees it through the filter handlers
+func sendPending(t *testing.T, tx *contract.Tx, key *wallet.Key) web3.Hash {
+	if tx.Method != "" {
+		if err := tx.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.SetKey(key).SetGas(100000).DoRawContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return tx.Hash
+}
+
+func TestPendingWatcher(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	c := newTokenContract(t, node)
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := contract.NewContract(web3.HexToAddress("0x00000000000000000000000000000000000000ee"), contract.Erc20Abi, c.Provider)
+	hashes := []web3.Hash{
+		sendPending(t, contract.NewTx().SetContract(c).SetMethod("transfer").AddArgs(holder, big.NewInt(5)), key),
+		sendPending(t, contract.NewTx().SetContract(other).SetMethod("transfer").AddArgs(holder, big.NewInt(5)), key),
+		sendPending(t, contract.NewTx().SetContract(c).SetInput([]byte{1, 2, 3, 4}), key),
+		// unknown to the node, dropped
+		web3.HexToHash("0x00000000000000000000000000000000000000000000000000000000000000ff"),
+	}
+	node.Handle("eth_newPendingTransactionFilter", func(params []json.RawMessage) (interface{}, error) {
+		return "0x1", nil
+	})
+	// every poll returns all of them again
+	node.Handle("eth_getFilterChanges", func(params []json.RawMessage) (interface{}, error) {
+		return hashes, nil
+	})
+	node.Handle("eth_uninstallFilter", func(params []json.RawMessage) (interface{}, error) {
+		return true, nil
+	})
+
+	w := contract.NewPendingWatcher(c.Provider, c)
+	w.UseFilter = true
+	w.PollInterval = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan *contract.PendingTx, 10)
+	done := make(chan error)
+	go func() {
+		done <- w.Watch(ctx, ch)
+	}()
+
+	for node.Count("eth_getFilterChanges") < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Fatalf("Watch() = %v, want context.Canceled", err)
+	}
+	close(ch)
+	var got []*contract.PendingTx
+	for p := range ch {
+		got = append(got, p)
+	}
+	if len(got) != 2 {
+		t.Fatalf("%d pending transactions delivered, want the 2 to the token once each", len(got))
+	}
+	if p := got[0]; p.Tx.Hash != hashes[0] || p.Method != "transfer" || p.Args["to"] != holder || p.Err != nil {
+		t.Fatalf("first delivered %s %s %v %v", p.Tx.Hash, p.Method, p.Args, p.Err)
+	}
+	if p := got[1]; p.Tx.Hash != hashes[2] || p.Err == nil {
+		t.Fatalf("second delivered %s with error %v, want the undecodable calldata", p.Tx.Hash, p.Err)
+	}
+}
@@ -0,0 +1,163 @@
+package contract
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+// ContextCaller is a json-rpc client able to abort a request, cclient.CClient is one
+type ContextCaller interface {
+	CallContext(ctx context.Context, method string, out interface{}, params ...interface{}) error
+}
+
+// WithContext runs fn and returns ctx.Err() as soon as ctx is done,
+// fn is then left to finish in the background
+func WithContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ch := make(chan error, 1)
+	go func() {
+		ch <- fn()
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rpcContext runs method on the json-rpc client of provider, the request is aborted when ctx
+// is done if the client is a ContextCaller. Providers without a client run fallback instead.
+func rpcContext(ctx context.Context, provider jsonrpc.IEth, fallback func() error, method string, out interface{}, params ...interface{}) error {
+	client, err := providerClient(provider)
+	if err != nil {
+		return WithContext(ctx, fallback)
+	}
+	return clientCallContext(ctx, client, method, out, params...)
+}
+
+func clientCallContext(ctx context.Context, client jsonrpc.IClient, method string, out interface{}, params ...interface{}) error {
+	if cc, ok := client.(ContextCaller); ok {
+		return cc.CallContext(ctx, method, out, params...)
+	}
+	return WithContext(ctx, func() error {
+		return client.Call(method, out, params...)
+	})
+}
+
+// ParseHexUint64 parses a json-rpc quantity, decimal strings are accepted too
+func ParseHexUint64(s string) (uint64, error) {
+	if strings.HasPrefix(s, "0x") {
+		return strconv.ParseUint(s[2:], 16, 64)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func uint64Context(ctx context.Context, provider jsonrpc.IEth, fallback func() (uint64, error), method string, params ...interface{}) (n uint64, err error) {
+	var out string
+	err = rpcContext(ctx, provider, func() (err error) {
+		n, err = fallback()
+		out = ""
+		return
+	}, method, &out, params...)
+	if err != nil || out == "" {
+		return
+	}
+	return ParseHexUint64(out)
+}
+
+func blockNumberContext(ctx context.Context, provider jsonrpc.IEth) (uint64, error) {
+	return uint64Context(ctx, provider, provider.BlockNumber, "eth_blockNumber")
+}
+
+func gasPriceContext(ctx context.Context, provider jsonrpc.IEth) (uint64, error) {
+	return uint64Context(ctx, provider, provider.GasPrice, "eth_gasPrice")
+}
+
+func chainIDContext(ctx context.Context, provider jsonrpc.IEth) (uint64, error) {
+	return uint64Context(ctx, provider, func() (uint64, error) {
+		id, err := provider.ChainID()
+		if err != nil {
+			return 0, err
+		}
+		return id.Uint64(), nil
+	}, "eth_chainId")
+}
+
+func estimateGasContext(ctx context.Context, provider jsonrpc.IEth, msg *web3.CallMsg) (uint64, error) {
+	return uint64Context(ctx, provider, func() (uint64, error) {
+		return provider.EstimateGas(msg)
+	}, "eth_estimateGas", msg)
+}
+
+func nonceContext(ctx context.Context, provider jsonrpc.IEth, addr web3.Address, block web3.BlockNumber) (uint64, error) {
+	return uint64Context(ctx, provider, func() (uint64, error) {
+		return provider.GetNonce(addr, block)
+	}, "eth_getTransactionCount", addr, block.String())
+}
+
+func ethCallContext(ctx context.Context, provider jsonrpc.IEth, msg *web3.CallMsg, block web3.BlockNumber) (out string, err error) {
+	err = rpcContext(ctx, provider, func() (err error) {
+		out, err = provider.Call(msg, block)
+		return
+	}, "eth_call", &out, msg, block.String())
+	return
+}
+
+func sendRawTransactionContext(ctx context.Context, provider jsonrpc.IEth, data []byte) (hash web3.Hash, err error) {
+	err = rpcContext(ctx, provider, func() (err error) {
+		hash, err = provider.SendRawTransaction(data)
+		return
+	}, "eth_sendRawTransaction", &hash, "0x"+hex.EncodeToString(data))
+	return
+}
+
+func blockContext(ctx context.Context, provider jsonrpc.IEth, n web3.BlockNumber) (block *web3.Block, err error) {
+	err = rpcContext(ctx, provider, func() (err error) {
+		block, err = provider.GetBlockByNumber(n, false)
+		return
+	}, "eth_getBlockByNumber", &block, n.String(), false)
+	return
+}
+
+// receiptContext returns a nil receipt while the transaction is pending,
+// status is read from the json-rpc answer and is 1 through the fallback
+func receiptContext(ctx context.Context, provider jsonrpc.IEth, hash web3.Hash) (receipt *web3.Receipt, status uint64, err error) {
+	status = 1
+	var raw json.RawMessage
+	err = rpcContext(ctx, provider, func() (err error) {
+		receipt, err = provider.GetTransactionReceipt(hash)
+		return
+	}, "eth_getTransactionReceipt", &raw, hash)
+	if err != nil || receipt != nil || len(raw) == 0 || string(raw) == "null" {
+		return
+	}
+	receipt = new(web3.Receipt)
+	if err = json.Unmarshal(raw, receipt); err != nil {
+		err = fmt.Errorf("json.Unmarshal(receipt): %w", err)
+		return
+	}
+	var st struct {
+		Status string `json:"status"`
+	}
+	if err = json.Unmarshal(raw, &st); err != nil {
+		err = fmt.Errorf("json.Unmarshal(status): %w", err)
+		return
+	}
+	if st.Status != "" {
+		if status, err = ParseHexUint64(st.Status); err != nil {
+			err = fmt.Errorf("bad receipt status %q: %w", st.Status, err)
+			return
+		}
+	}
+	return
+}
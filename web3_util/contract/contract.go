@@ -1,9 +1,11 @@
 package contract
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
-	"io/ioutil"
+
+	"goutil/web3_util/abis"
 
 	"github.com/panyanyany/go-web3"
 	"github.com/panyanyany/go-web3/abi"
@@ -64,26 +66,38 @@ func NewContract(addr web3.Address, abi *abi.ABI, provider jsonrpc.IEth) *Contra
 	}
 }
 
+// LoadAbi resolves the Abi through abis.Default, by ChainName, Name and Address.
+// Explorers are only asked when abis.Default.Remote is set.
 func (r *Contract) LoadAbi() (err error) {
-	var bs []byte
-	bs, err = ioutil.ReadFile(fmt.Sprintf("resources/%s/%s/abi.json",
-		r.ChainName,
-		r.Name,
-	))
-	if err != nil {
-		return
-	}
+	return r.LoadAbiContext(context.Background())
+}
 
-	var abiObj *abi.ABI
-	abiObj, err = abi.NewABI(string(bs))
+// LoadAbiContext is LoadAbi, merging the implementation ABI when the provider shows the contract is a proxy
+func (r *Contract) LoadAbiContext(ctx context.Context) (err error) {
+	client, _ := r.client()
+	abiObj, err := abis.Default.Resolve(ctx, abis.Key{Chain: r.ChainName, Name: r.Name, Address: r.Address}, client)
 	if err != nil {
-		err = fmt.Errorf("abi.NewABI: %w", err)
+		err = fmt.Errorf("abis.Default.Resolve: %w", err)
 		return
 	}
 	r.Abi = abiObj
 	return
 }
 
+// client returns the json-rpc client behind the provider,
+// it is needed for calls that jsonrpc.IEth does not cover
+func (c *Contract) client() (jsonrpc.IClient, error) {
+	return providerClient(c.Provider)
+}
+
+func providerClient(provider jsonrpc.IEth) (jsonrpc.IClient, error) {
+	eth, ok := provider.(*jsonrpc.Eth)
+	if !ok {
+		return nil, fmt.Errorf("provider %T does not expose a json-rpc client", provider)
+	}
+	return eth.Client, nil
+}
+
 // ABI returns the Abi of the contract
 func (c *Contract) ABI() *abi.ABI {
 	return c.Abi
@@ -106,6 +120,11 @@ func (c *Contract) EstimateGas(method string, args ...interface{}) (uint64, erro
 
 // Call calls a method in the contract
 func (c *Contract) Call(method string, block web3.BlockNumber, args ...interface{}) (map[string]interface{}, error) {
+	return c.CallContext(context.Background(), method, block, args...)
+}
+
+// CallContext is Call giving up when ctx is done
+func (c *Contract) CallContext(ctx context.Context, method string, block web3.BlockNumber, args ...interface{}) (map[string]interface{}, error) {
 	m, ok := c.Abi.Methods[method]
 	if !ok {
 		return nil, fmt.Errorf("method %s not found in Contract.Abi.Methods[method]", method)
@@ -128,7 +147,7 @@ func (c *Contract) Call(method string, block web3.BlockNumber, args ...interface
 		msg.From = *c.From
 	}
 
-	rawStr, err := c.Provider.Call(msg, block)
+	rawStr, err := ethCallContext(ctx, c.Provider, msg, block)
 	if err != nil {
 		err = fmt.Errorf("Contract.Provider.Call(): %w", err)
 		return nil, err
@@ -0,0 +1,251 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+const erc20AbiStr = `[
+{"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"symbol","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"account","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"name":"approve","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"name":"transferFrom","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"spender","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Approval","type":"event"}
+]`
+
+// Erc20Abi is the standard ERC-20 interface
+var Erc20Abi = abi.MustNewABI(erc20AbiStr)
+
+// erc20Bytes32Abi reads the name and symbol of old tokens such as MKR, which return bytes32
+var erc20Bytes32Abi = abi.MustNewABI(`[
+{"inputs":[],"name":"name","outputs":[{"name":"","type":"bytes32"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"symbol","outputs":[{"name":"","type":"bytes32"}],"stateMutability":"view","type":"function"}
+]`)
+
+// ErrFalseReturn is returned when a token answers false to transfer, transferFrom or approve
+var ErrFalseReturn = errors.New("token returned false")
+
+// ERC20 is a token contract, its name, symbol and decimals are read from chain once
+type ERC20 struct {
+	*Contract
+
+	lock     sync.Mutex
+	name     *string
+	symbol   *string
+	decimals *int
+}
+
+// NewERC20 returns the token at addr with Erc20Abi
+func NewERC20(addr web3.Address, provider jsonrpc.IEth) *ERC20 {
+	return &ERC20{Contract: NewContract(addr, Erc20Abi, provider)}
+}
+
+// ToERC20 wraps c with Erc20Abi, keeping its address, provider and chain
+func ToERC20(c *Contract) *ERC20 {
+	t := NewERC20(c.Address, c.Provider)
+	t.Contract.ChainName = c.ChainName
+	t.Contract.From = c.From
+	return t
+}
+
+// callRaw runs method with no arguments and returns the undecoded output
+func (t *ERC20) callRaw(ctx context.Context, method string) (raw []byte, err error) {
+	data, err := t.EncodeInput(method)
+	if err != nil {
+		return
+	}
+	msg := &web3.CallMsg{To: &t.Address, Data: data}
+	if t.From != nil {
+		msg.From = *t.From
+	}
+	out, err := ethCallContext(ctx, t.Provider, msg, web3.Latest)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", method, err)
+		return
+	}
+	if len(out) < 2 {
+		err = fmt.Errorf("%s: bad eth_call result: %q", method, out)
+		return
+	}
+	raw, err = hex.DecodeString(out[2:])
+	if err != nil {
+		err = fmt.Errorf("hex.DecodeString: %w", err)
+		return
+	}
+	if len(raw) == 0 {
+		err = fmt.Errorf("%s: empty response", method)
+	}
+	return
+}
+
+// text reads name or symbol as a string, falling back to bytes32
+func (t *ERC20) text(ctx context.Context, method string) (s string, err error) {
+	raw, err := t.callRaw(ctx, method)
+	if err != nil {
+		return
+	}
+	resp, err := t.DecodeOutput(method, raw)
+	if err == nil {
+		s, _ = resp["0"].(string)
+		return
+	}
+	resp, err = (&Contract{Abi: erc20Bytes32Abi}).DecodeOutput(method, raw)
+	if err != nil {
+		err = fmt.Errorf("%s is neither string nor bytes32: %w", method, err)
+		return
+	}
+	b, _ := resp["0"].([32]byte)
+	s = string(bytes.TrimRight(b[:], "\x00"))
+	return
+}
+
+// Name reads the name once and sets Contract.Name
+func (t *ERC20) Name(ctx context.Context) (name string, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.name != nil {
+		return *t.name, nil
+	}
+	if name, err = t.text(ctx, "name"); err != nil {
+		return
+	}
+	t.name = &name
+	t.Contract.Name = name
+	return
+}
+
+// Symbol reads the symbol once and sets Contract.Symbol
+func (t *ERC20) Symbol(ctx context.Context) (symbol string, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.symbol != nil {
+		return *t.symbol, nil
+	}
+	if symbol, err = t.text(ctx, "symbol"); err != nil {
+		return
+	}
+	t.symbol = &symbol
+	t.Contract.Symbol = symbol
+	return
+}
+
+// Decimals reads the decimals once and sets Contract.Decimals
+func (t *ERC20) Decimals(ctx context.Context) (decimals int, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.decimals != nil {
+		return *t.decimals, nil
+	}
+	resp, err := t.CallContext(ctx, "decimals", web3.Latest)
+	if err != nil {
+		err = fmt.Errorf("decimals: %w", err)
+		return
+	}
+	d, ok := resp["0"].(uint8)
+	if !ok {
+		err = fmt.Errorf("bad decimals: %v", resp)
+		return
+	}
+	decimals = int(d)
+	t.decimals = &decimals
+	t.Contract.Decimals = decimals
+	return
+}
+
+// SetDecimals caches decimals without asking the chain
+func (t *ERC20) SetDecimals(decimals int) *ERC20 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.decimals = &decimals
+	t.Contract.Decimals = decimals
+	return t
+}
+
+// amount calls a uint256 view and returns it with the token decimals
+func (t *ERC20) amount(ctx context.Context, method string, args ...interface{}) (a *TokenAmount, err error) {
+	decimals, err := t.Decimals(ctx)
+	if err != nil {
+		return
+	}
+	resp, err := t.CallContext(ctx, method, web3.Latest, args...)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", method, err)
+		return
+	}
+	raw, ok := resp["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("bad %s: %v", method, resp)
+		return
+	}
+	return NewTokenAmount(raw, decimals), nil
+}
+
+func (t *ERC20) TotalSupply(ctx context.Context) (*TokenAmount, error) {
+	return t.amount(ctx, "totalSupply")
+}
+
+func (t *ERC20) BalanceOf(ctx context.Context, owner web3.Address) (*TokenAmount, error) {
+	return t.amount(ctx, "balanceOf", owner)
+}
+
+func (t *ERC20) Allowance(ctx context.Context, owner, spender web3.Address) (*TokenAmount, error) {
+	return t.amount(ctx, "allowance", owner, spender)
+}
+
+// Amount parses a human amount with the token decimals
+func (t *ERC20) Amount(ctx context.Context, s string) (a *TokenAmount, err error) {
+	decimals, err := t.Decimals(ctx)
+	if err != nil {
+		return
+	}
+	return ParseTokenAmount(s, decimals)
+}
+
+func (t *ERC20) tx(method string, args ...interface{}) *Tx {
+	return NewTx().
+		SetMethod(method).
+		AddArgs(args...).
+		SetContract(t.Contract)
+}
+
+// Approve, Transfer and TransferFrom build the transactions, to be signed with Tx.SetKey.
+// Use Check to simulate them, tokens such as USDT on ethereum return nothing instead of a bool.
+func (t *ERC20) Approve(spender web3.Address, amount *big.Int) *Tx {
+	return t.tx("approve", spender, amount)
+}
+
+func (t *ERC20) Transfer(to web3.Address, amount *big.Int) *Tx {
+	return t.tx("transfer", to, amount)
+}
+
+func (t *ERC20) TransferFrom(from, to web3.Address, amount *big.Int) *Tx {
+	return t.tx("transferFrom", from, to, amount)
+}
+
+// Check simulates tx, a token transaction, and fails when it reverts or returns false.
+// An empty return is a success.
+func (t *ERC20) Check(ctx context.Context, tx *Tx) (err error) {
+	resp, err := tx.SimulateContext(ctx, web3.Latest)
+	if err != nil {
+		return
+	}
+	if ok, found := resp["0"].(bool); found && !ok {
+		return fmt.Errorf("%s: %w", tx.Method, ErrFalseReturn)
+	}
+	return
+}
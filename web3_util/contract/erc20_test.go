@@ -0,0 +1,96 @@
+package contract_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+var (
+	token  = web3.HexToAddress("0x00000000000000000000000000000000000000cc")
+	holder = web3.HexToAddress("0x00000000000000000000000000000000000000dd")
+)
+
+func newERC20(t *testing.T, node *rpctest.Server) *contract.ERC20 {
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contract.NewERC20(token, client.Eth())
+}
+
+func TestERC20Reads(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	node.Mock(token, contract.Erc20Abi).
+		Return("symbol", "CAKE").
+		Return("decimals", uint8(18)).
+		On("balanceOf", func(call *rpctest.Call) ([]interface{}, error) {
+			if call.Args["account"] != holder {
+				return []interface{}{big.NewInt(0)}, nil
+			}
+			return []interface{}{new(big.Int).Mul(big.NewInt(15), big.NewInt(1e17))}, nil
+		})
+	t20 := newERC20(t, node)
+	ctx := context.Background()
+
+	if symbol, err := t20.Symbol(ctx); err != nil || symbol != "CAKE" {
+		t.Fatalf("Symbol() = %q, %v", symbol, err)
+	}
+	balance, err := t20.BalanceOf(ctx, holder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.String() != "1.5" {
+		t.Fatalf("BalanceOf() = %s, want 1.5", balance)
+	}
+	// decimals are read once
+	if _, err = t20.BalanceOf(ctx, holder); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(node.Requests("eth_call")); n != 4 {
+		t.Fatalf("%d eth_call, want 4", n)
+	}
+}
+
+func TestERC20Bytes32Name(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	var name [32]byte
+	copy(name[:], "Maker")
+	node.Mock(token, abi.MustNewABI(`[{"inputs":[],"name":"name","outputs":[{"name":"","type":"bytes32"}],"stateMutability":"view","type":"function"}]`)).
+		Return("name", name)
+
+	if got, err := newERC20(t, node).Name(context.Background()); err != nil || got != "Maker" {
+		t.Fatalf("Name() = %q, %v", got, err)
+	}
+}
+
+func TestERC20Check(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	mock := node.Mock(token, contract.Erc20Abi).Return("transfer", false)
+	t20 := newERC20(t, node)
+	ctx := context.Background()
+
+	if err := t20.Check(ctx, t20.Transfer(holder, big.NewInt(1))); !errors.Is(err, contract.ErrFalseReturn) {
+		t.Fatalf("Check() = %v, want ErrFalseReturn", err)
+	}
+	mock.Revert("transfer", "BEP20: transfer amount exceeds balance")
+	var revert *contract.RevertError
+	if err := t20.Check(ctx, t20.Transfer(holder, big.NewInt(1))); !errors.As(err, &revert) || revert.Reason != "BEP20: transfer amount exceeds balance" {
+		t.Fatalf("Check() = %v, want the revert reason", err)
+	}
+	mock.Return("transfer", true)
+	if err := t20.Check(ctx, t20.Transfer(holder, big.NewInt(1))); err != nil {
+		t.Fatal(err)
+	}
+}
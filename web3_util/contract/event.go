@@ -1,8 +1,12 @@
 package contract
 
 import (
+	"fmt"
+	"reflect"
+
 	"github.com/panyanyany/go-web3"
 	"github.com/panyanyany/go-web3/abi"
+	"golang.org/x/crypto/sha3"
 )
 
 // Event is a solidity event
@@ -10,6 +14,11 @@ type Event struct {
 	event *abi.Event
 }
 
+// Name returns the name of the event
+func (e *Event) Name() string {
+	return e.event.Name
+}
+
 // Encode encodes an event
 func (e *Event) Encode() web3.Hash {
 	return e.event.ID()
@@ -19,3 +28,147 @@ func (e *Event) Encode() web3.Hash {
 func (e *Event) ParseLog(log *web3.Log) (map[string]interface{}, error) {
 	return abi.ParseLog(e.event.Inputs, log)
 }
+
+// Topics builds the topics of a log filter for this event.
+// args maps names of indexed arguments to a value, or to a slice of values to match any of them,
+// arguments left out match anything.
+func (e *Event) Topics(args map[string]interface{}) (topics [][]web3.Hash, err error) {
+	topics = [][]web3.Hash{{e.event.ID()}}
+
+	found := 0
+	for _, elem := range e.event.Inputs.TupleElems() {
+		if !elem.Indexed {
+			if _, ok := args[elem.Name]; ok {
+				err = fmt.Errorf("argument %s of %s is not indexed", elem.Name, e.event.Name)
+				return
+			}
+			continue
+		}
+
+		val, ok := args[elem.Name]
+		if !ok {
+			topics = append(topics, nil)
+			continue
+		}
+		found++
+
+		var set []web3.Hash
+		set, err = encodeTopicSet(elem.Elem, val)
+		if err != nil {
+			err = fmt.Errorf("argument %s of %s: %w", elem.Name, e.event.Name, err)
+			return
+		}
+		topics = append(topics, set)
+	}
+	if found != len(args) {
+		err = fmt.Errorf("unknown arguments for %s: %v", e.event.Name, args)
+		return
+	}
+
+	// trailing wildcards are implied
+	for len(topics) > 1 && topics[len(topics)-1] == nil {
+		topics = topics[:len(topics)-1]
+	}
+	return
+}
+
+// encodeTopicSet encodes val as one topic, or as an OR-set when val is a slice of values
+func encodeTopicSet(t *abi.Type, val interface{}) (set []web3.Hash, err error) {
+	v := reflect.ValueOf(val)
+	if v.Kind() == reflect.Slice && t.Kind() != abi.KindBytes && t.Kind() != abi.KindSlice {
+		for i := 0; i < v.Len(); i++ {
+			var topic web3.Hash
+			topic, err = encodeTopic(t, v.Index(i).Interface())
+			if err != nil {
+				return
+			}
+			set = append(set, topic)
+		}
+		return
+	}
+
+	topic, err := encodeTopic(t, val)
+	if err != nil {
+		return
+	}
+	set = []web3.Hash{topic}
+	return
+}
+
+func encodeTopic(t *abi.Type, val interface{}) (topic web3.Hash, err error) {
+	switch t.Kind() {
+	case abi.KindFixedBytes:
+		v := reflect.ValueOf(val)
+		if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+			err = fmt.Errorf("expected bytes for %s, got %T", t.String(), val)
+			return
+		}
+		for i := 0; i < v.Len() && i < len(topic); i++ {
+			topic[i] = byte(v.Index(i).Uint())
+		}
+		return
+	case abi.KindString:
+		s, ok := val.(string)
+		if !ok {
+			err = fmt.Errorf("expected string, got %T", val)
+			return
+		}
+		return keccakHash([]byte(s)), nil
+	case abi.KindBytes:
+		b, ok := val.([]byte)
+		if !ok {
+			err = fmt.Errorf("expected []byte, got %T", val)
+			return
+		}
+		return keccakHash(b), nil
+	}
+	return abi.EncodeTopic(t, val)
+}
+
+func keccakHash(b []byte) (h web3.Hash) {
+	k := sha3.NewLegacyKeccak256()
+	k.Write(b)
+	copy(h[:], k.Sum(nil))
+	return
+}
+
+// EventFilter builds a filter for the named event of the contract, see Event.Topics for args
+func (c *Contract) EventFilter(name string, args map[string]interface{}) (filter *LogFilter, err error) {
+	event, ok := c.Event(name)
+	if !ok {
+		err = fmt.Errorf("event %s not found in Contract.Abi.Events", name)
+		return
+	}
+	topics, err := event.Topics(args)
+	if err != nil {
+		err = fmt.Errorf("event.Topics: %w", err)
+		return
+	}
+	filter = &LogFilter{
+		Address: []web3.Address{c.Address},
+		Topics:  topics,
+	}
+	return
+}
+
+// DecodeLog finds the event of the log by topic[0] across the whole abi and decodes it
+func (c *Contract) DecodeLog(log *web3.Log) (name string, args map[string]interface{}, err error) {
+	if len(log.Topics) == 0 {
+		err = fmt.Errorf("log without topics")
+		return
+	}
+	for _, ev := range c.Abi.Events {
+		if ev.ID() != log.Topics[0] {
+			continue
+		}
+		args, err = abi.ParseLog(ev.Inputs, log)
+		if err != nil {
+			err = fmt.Errorf("abi.ParseLog(%s): %w", ev.Name, err)
+			return
+		}
+		name = ev.Name
+		return
+	}
+	err = fmt.Errorf("no event of Contract.Abi matches topic %s", log.Topics[0])
+	return
+}
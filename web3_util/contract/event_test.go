@@ -0,0 +1,106 @@
+package contract_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+// keccak("Transfer(address,address,uint256)")
+var transferTopic = web3.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+func addressTopic(addr web3.Address) web3.Hash {
+	return web3.BytesToHash(addr[:])
+}
+
+func TestEventFilter(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	c := newTokenContract(t, node)
+	a := web3.HexToAddress("0x00000000000000000000000000000000000000a1")
+	b := web3.HexToAddress("0x00000000000000000000000000000000000000b1")
+
+	filter, err := c.EventFilter("Transfer", map[string]interface{}{"to": []web3.Address{a, b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"address":"` + token.String() + `","topics":["` + transferTopic.String() + `",null,["` +
+		addressTopic(a).String() + `","` + addressTopic(b).String() + `"]]}`
+	if strings.ToLower(string(bs)) != strings.ToLower(want) {
+		t.Fatalf("filter %s, want %s", bs, want)
+	}
+
+	// trailing wildcards are dropped
+	filter, err = c.EventFilter("Transfer", map[string]interface{}{"from": a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filter.Topics) != 2 || filter.Topics[1][0] != addressTopic(a) {
+		t.Fatalf("topics %v", filter.Topics)
+	}
+
+	for _, args := range []map[string]interface{}{{"value": big.NewInt(1)}, {"sender": a}} {
+		if _, err = c.EventFilter("Transfer", args); err == nil {
+			t.Errorf("EventFilter(Transfer, %v) gave no error", args)
+		}
+	}
+	if _, err = c.EventFilter("Mint", nil); err == nil {
+		t.Error("EventFilter of a missing event gave no error")
+	}
+}
+
+// indexed strings and bytes are matched by their hash
+func TestEventTopicsHashed(t *testing.T) {
+	a := abi.MustNewABI(`[{"anonymous":false,"inputs":[{"indexed":true,"name":"name","type":"string"},{"indexed":true,"name":"data","type":"bytes"}],"name":"Named","type":"event"}]`)
+	c := contract.NewContract(token, a, nil)
+
+	filter, err := c.EventFilter("Named", map[string]interface{}{"name": "hello", "data": []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keccak("hello")
+	hello := web3.HexToHash("0x1c8aff950685c2ed4bc3174f3472287b56d9517b9c948127319a09a7a36deac8")
+	if len(filter.Topics) != 3 || filter.Topics[1][0] != hello || filter.Topics[2][0] != hello {
+		t.Fatalf("topics %v, want keccak(hello) twice", filter.Topics)
+	}
+}
+
+func TestDecodeLog(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	c := newTokenContract(t, node)
+	to := web3.HexToAddress("0x00000000000000000000000000000000000000b1")
+	value := new(big.Int).Mul(big.NewInt(3), big.NewInt(1e18))
+	log := &web3.Log{
+		Address: token,
+		Topics:  []web3.Hash{transferTopic, addressTopic(holder), addressTopic(to)},
+		Data:    value.FillBytes(make([]byte, 32)),
+	}
+
+	name, args, err := c.DecodeLog(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Transfer" || args["from"] != holder || args["to"] != to || args["value"].(*big.Int).Cmp(value) != 0 {
+		t.Fatalf("DecodeLog() = %s %v", name, args)
+	}
+
+	log.Topics[0] = web3.HexToHash("0x01")
+	if _, _, err = c.DecodeLog(log); err == nil {
+		t.Fatal("DecodeLog of an unknown event gave no error")
+	}
+	if _, _, err = c.DecodeLog(&web3.Log{}); err == nil {
+		t.Fatal("DecodeLog without topics gave no error")
+	}
+}
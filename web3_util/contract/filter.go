@@ -0,0 +1,92 @@
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"goutil/struct_util"
+
+	"github.com/panyanyany/go-web3"
+)
+
+// LogFilter is an eth_getLogs filter.
+// Unlike web3.LogFilter, every topic position is an OR-set and nil matches anything.
+type LogFilter struct {
+	Address   []web3.Address
+	Topics    [][]web3.Hash
+	BlockHash *web3.Hash
+	From      *web3.BlockNumber
+	To        *web3.BlockNumber
+}
+
+// SetRange sets the block range of the filter, both ends included
+func (l *LogFilter) SetRange(from, to uint64) *LogFilter {
+	f, t := web3.BlockNumber(from), web3.BlockNumber(to)
+	l.From, l.To = &f, &t
+	return l
+}
+
+// MarshalJSON implements the Marshal interface.
+func (l *LogFilter) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{}
+	if len(l.Address) == 1 {
+		m["address"] = l.Address[0]
+	} else if len(l.Address) > 1 {
+		m["address"] = l.Address
+	}
+
+	topics := make([]interface{}, len(l.Topics))
+	for i, set := range l.Topics {
+		switch len(set) {
+		case 0:
+			topics[i] = nil
+		case 1:
+			topics[i] = set[0]
+		default:
+			topics[i] = set
+		}
+	}
+	m["topics"] = topics
+
+	if l.BlockHash != nil {
+		m["blockHash"] = *l.BlockHash
+	}
+	if l.From != nil {
+		m["fromBlock"] = l.From.String()
+	}
+	if l.To != nil {
+		m["toBlock"] = l.To.String()
+	}
+	return json.Marshal(m)
+}
+
+// GetLogs runs eth_getLogs with filter
+func (c *Contract) GetLogs(filter *LogFilter) (logs []*web3.Log, err error) {
+	return c.GetLogsContext(context.Background(), filter)
+}
+
+func (c *Contract) GetLogsContext(ctx context.Context, filter *LogFilter) (logs []*web3.Log, err error) {
+	client, err := c.client()
+	if err != nil {
+		return
+	}
+	err = clientCallContext(ctx, client, "eth_getLogs", &logs, filter)
+	if err != nil {
+		err = fmt.Errorf("eth_getLogs: %w", err)
+		return
+	}
+	return
+}
+
+// DecodedLog is a log decoded against the abi of a contract
+type DecodedLog struct {
+	Event string
+	Args  map[string]interface{}
+	Log   *web3.Log
+}
+
+// Decode copies Args into a struct, fields are matched the json way
+func (d *DecodedLog) Decode(out interface{}) error {
+	return struct_util.Map2Struct(d.Args, out)
+}
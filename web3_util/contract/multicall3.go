@@ -0,0 +1,158 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+// Multicall3Address is the address Multicall3 is deployed at on most chains
+var Multicall3Address = web3.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+const multicall3AbiStr = `[{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+var multicall3Abi = abi.MustNewABI(multicall3AbiStr)
+
+// Call3 is one call batched by Multicall.Aggregate
+type Call3 struct {
+	Contract     *Contract
+	Method       string
+	Args         []interface{}
+	AllowFailure bool
+}
+
+func NewCall3(c *Contract, method string, args ...interface{}) *Call3 {
+	return &Call3{Contract: c, Method: method, Args: args, AllowFailure: true}
+}
+
+// Call3Result is the result of one Call3, Err is set when the call failed or could not be decoded
+type Call3Result struct {
+	Call    *Call3
+	Success bool
+	Resp    map[string]interface{}
+	Raw     []byte
+	Err     error
+}
+
+// Multicall batches arbitrary contract calls into aggregate3 calls of Multicall3
+type Multicall struct {
+	Contract *Contract
+	// MaxCalls and MaxCalldata bound one aggregate3 call,
+	// a chunk the node still refuses is split in halves
+	MaxCalls    int
+	MaxCalldata int
+}
+
+func NewMulticall(provider jsonrpc.IEth) *Multicall {
+	return NewMulticallAt(Multicall3Address, provider)
+}
+
+func NewMulticallAt(addr web3.Address, provider jsonrpc.IEth) *Multicall {
+	return &Multicall{
+		Contract:    NewContract(addr, multicall3Abi, provider),
+		MaxCalls:    200,
+		MaxCalldata: 64 * 1024,
+	}
+}
+
+// Aggregate runs calls through aggregate3 and returns one result per call, in order.
+// A failing call with AllowFailure unset makes the whole batch fail.
+func (m *Multicall) Aggregate(calls []*Call3, block web3.BlockNumber) (results []*Call3Result, err error) {
+	return m.AggregateContext(context.Background(), calls, block)
+}
+
+func (m *Multicall) AggregateContext(ctx context.Context, calls []*Call3, block web3.BlockNumber) (results []*Call3Result, err error) {
+	datas := make([][]byte, len(calls))
+	for i, call := range calls {
+		datas[i], err = call.Contract.EncodeInput(call.Method, call.Args...)
+		if err != nil {
+			err = fmt.Errorf("calls[%d]: %w", i, err)
+			return
+		}
+	}
+
+	results = make([]*Call3Result, 0, len(calls))
+	start, size := 0, 0
+	for i := range calls {
+		size += len(datas[i])
+		if i+1 == len(calls) || i+1-start >= m.MaxCalls || size+len(datas[i+1]) > m.MaxCalldata {
+			var chunk []*Call3Result
+			chunk, err = m.aggregate(ctx, calls[start:i+1], datas[start:i+1], block)
+			if err != nil {
+				return
+			}
+			results = append(results, chunk...)
+			start, size = i+1, 0
+		}
+	}
+	return
+}
+
+func (m *Multicall) aggregate(ctx context.Context, calls []*Call3, datas [][]byte, block web3.BlockNumber) (results []*Call3Result, err error) {
+	items := make([]map[string]interface{}, len(calls))
+	for i, call := range calls {
+		items[i] = map[string]interface{}{
+			"target":       call.Contract.Address,
+			"allowFailure": call.AllowFailure,
+			"callData":     datas[i],
+		}
+	}
+	input, err := m.Contract.EncodeInput("aggregate3", items)
+	if err != nil {
+		return
+	}
+
+	msg := &callArgs{To: &m.Contract.Address, Data: input}
+	raw, err := m.Contract.ethCall(ctx, msg, block, nil)
+	if err != nil {
+		var revertErr *RevertError
+		if len(calls) == 1 || errors.As(err, &revertErr) || ctx.Err() != nil {
+			err = fmt.Errorf("aggregate3: %w", err)
+			return
+		}
+		// most likely out of gas or a response too large, retry in halves
+		half := len(calls) / 2
+		var tail []*Call3Result
+		results, err = m.aggregate(ctx, calls[:half], datas[:half], block)
+		if err != nil {
+			return
+		}
+		tail, err = m.aggregate(ctx, calls[half:], datas[half:], block)
+		if err != nil {
+			return
+		}
+		results = append(results, tail...)
+		return
+	}
+
+	resp, err := m.Contract.DecodeOutput("aggregate3", raw)
+	if err != nil {
+		return
+	}
+	items, ok := resp["returnData"].([]map[string]interface{})
+	if !ok || len(items) != len(calls) {
+		err = fmt.Errorf("aggregate3: bad returnData: %T", resp["returnData"])
+		return
+	}
+
+	results = make([]*Call3Result, len(calls))
+	for i, item := range items {
+		res := &Call3Result{Call: calls[i]}
+		res.Success, _ = item["success"].(bool)
+		res.Raw, _ = item["returnData"].([]byte)
+		if !res.Success {
+			res.Err = &RevertError{Data: res.Raw}
+			if reason, decodeErr := DecodeRevert(res.Raw); decodeErr == nil {
+				res.Err = &RevertError{Reason: reason, Data: res.Raw}
+			}
+		} else {
+			res.Resp, res.Err = calls[i].Contract.DecodeOutput(calls[i].Method, res.Raw)
+		}
+		results[i] = res
+	}
+	return
+}
@@ -0,0 +1,153 @@
+package contract_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+var multicall3Abi = abi.MustNewABI(`[{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`)
+
+// mockMulticall runs aggregate3 against the token: balanceOf returns the last byte of the account,
+// transfer reverts with "nope" and totalSupply returns nothing.
+// Batches of more than maxCalls fail like a node running out of gas.
+func mockMulticall(t *testing.T, node *rpctest.Server, maxCalls int) (sizes *[]int) {
+	c := newTokenContract(t, node)
+	sizes = &[]int{}
+	node.Mock(contract.Multicall3Address, multicall3Abi).On("aggregate3", func(call *rpctest.Call) ([]interface{}, error) {
+		calls := call.Args["calls"].([]map[string]interface{})
+		*sizes = append(*sizes, len(calls))
+		if len(calls) > maxCalls {
+			return nil, errors.New("out of gas")
+		}
+		var results []map[string]interface{}
+		for _, item := range calls {
+			method, args, err := c.DecodeInput(item["callData"].([]byte))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := map[string]interface{}{"success": true, "returnData": []byte{}}
+			switch method {
+			case "balanceOf":
+				account := args["account"].(web3.Address)
+				res["returnData"], err = abi.Encode([]interface{}{big.NewInt(int64(account[19]))}, contract.Erc20Abi.Methods["balanceOf"].Outputs)
+				if err != nil {
+					t.Fatal(err)
+				}
+			case "transfer":
+				if !item["allowFailure"].(bool) {
+					return nil, rpctest.Revert("Multicall3: call failed")
+				}
+				res["success"], res["returnData"] = false, errorString(t, "nope")
+			}
+			results = append(results, res)
+		}
+		return []interface{}{results}, nil
+	})
+	return
+}
+
+// errorString encodes reason as Error(string)
+func errorString(t *testing.T, reason string) []byte {
+	data, err := abi.Encode([]interface{}{reason}, abi.MustNewType("tuple(string reason)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{0x08, 0xc3, 0x79, 0xa0}, data...)
+}
+
+func balanceCalls(c *contract.Contract, n int) (calls []*contract.Call3) {
+	for i := 1; i <= n; i++ {
+		calls = append(calls, contract.NewCall3(c, "balanceOf", web3.BytesToAddress([]byte{byte(i)})))
+	}
+	return
+}
+
+func TestMulticallAggregate(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	sizes := mockMulticall(t, node, 100)
+	c := newTokenContract(t, node)
+	m := contract.NewMulticall(c.Provider)
+	m.MaxCalls = 2
+
+	calls := append(balanceCalls(c, 3),
+		contract.NewCall3(c, "transfer", holder, big.NewInt(1)),
+		contract.NewCall3(c, "totalSupply"))
+	results, err := m.Aggregate(calls, web3.Latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*sizes) != 3 || (*sizes)[0] != 2 || (*sizes)[1] != 2 || (*sizes)[2] != 1 {
+		t.Fatalf("aggregate3 called with %v calls, want chunks of [2 2 1]", *sizes)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("%d results, want %d", len(results), len(calls))
+	}
+	for i, res := range results[:3] {
+		if res.Call != calls[i] || !res.Success || res.Err != nil || res.Resp["0"].(*big.Int).Int64() != int64(i+1) {
+			t.Fatalf("result %d: %v %v %v", i, res.Success, res.Resp, res.Err)
+		}
+	}
+	var revert *contract.RevertError
+	if res := results[3]; res.Success || !errors.As(res.Err, &revert) || revert.Reason != "nope" {
+		t.Fatalf("failed call: success %v err %v, want a revert with reason nope", res.Success, res.Err)
+	}
+	// succeeded, but its empty output does not decode
+	if res := results[4]; !res.Success || res.Err == nil {
+		t.Fatalf("undecodable call: success %v err %v", res.Success, res.Err)
+	}
+}
+
+// a chunk the node refuses is retried in halves until it fits
+func TestMulticallSplitsRefusedChunk(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	sizes := mockMulticall(t, node, 2)
+	c := newTokenContract(t, node)
+
+	calls := balanceCalls(c, 5)
+	results, err := contract.NewMulticall(c.Provider).Aggregate(calls, web3.Latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{5, 2, 3, 1, 2}
+	if len(*sizes) != len(want) {
+		t.Fatalf("aggregate3 called with %v calls, want %v", *sizes, want)
+	}
+	for i := range want {
+		if (*sizes)[i] != want[i] {
+			t.Fatalf("aggregate3 called with %v calls, want %v", *sizes, want)
+		}
+	}
+	for i, res := range results {
+		if res.Call != calls[i] || res.Err != nil || res.Resp["0"].(*big.Int).Int64() != int64(i+1) {
+			t.Fatalf("result %d: %v %v", i, res.Resp, res.Err)
+		}
+	}
+}
+
+// a call without AllowFailure reverts the batch, which is not retried
+func TestMulticallRequiredCallFails(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	sizes := mockMulticall(t, node, 100)
+	c := newTokenContract(t, node)
+
+	transfer := contract.NewCall3(c, "transfer", holder, big.NewInt(1))
+	transfer.AllowFailure = false
+	_, err := contract.NewMulticall(c.Provider).Aggregate(append(balanceCalls(c, 3), transfer), web3.Latest)
+	var revert *contract.RevertError
+	if !errors.As(err, &revert) || revert.Reason != "Multicall3: call failed" {
+		t.Fatalf("Aggregate() = %v, want the aggregate3 revert", err)
+	}
+	if len(*sizes) != 1 {
+		t.Fatalf("aggregate3 called %d times, want 1", len(*sizes))
+	}
+}
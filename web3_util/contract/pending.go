@@ -0,0 +1,186 @@
+package contract
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+// PendingTx is a pending transaction sent to a watched contract
+type PendingTx struct {
+	Tx       *web3.Transaction
+	Contract *Contract
+	Method   string
+	Args     map[string]interface{}
+	// Err is set when the calldata could not be decoded
+	Err error
+}
+
+// PendingWatcher polls pending transactions and decodes those sent to the watched contracts
+type PendingWatcher struct {
+	Provider  jsonrpc.IEth
+	Contracts map[web3.Address]*Contract
+
+	// UseFilter polls eth_newPendingTransactionFilter instead of the "pending" block,
+	// not every node keeps a pending block
+	UseFilter    bool
+	PollInterval time.Duration
+	SeenTTL      time.Duration
+
+	seen map[web3.Hash]time.Time
+}
+
+func NewPendingWatcher(provider jsonrpc.IEth, contracts ...*Contract) *PendingWatcher {
+	w := &PendingWatcher{
+		Provider:     provider,
+		Contracts:    map[web3.Address]*Contract{},
+		PollInterval: 500 * time.Millisecond,
+		SeenTTL:      10 * time.Minute,
+		seen:         map[web3.Hash]time.Time{},
+	}
+	for _, c := range contracts {
+		w.Contracts[c.Address] = c
+	}
+	return w
+}
+
+// Watch delivers decoded pending transactions on ch until ctx is done
+func (w *PendingWatcher) Watch(ctx context.Context, ch chan<- *PendingTx) (err error) {
+	var filterID string
+	if w.UseFilter {
+		client, clientErr := providerClient(w.Provider)
+		if clientErr != nil {
+			err = clientErr
+			return
+		}
+		err = clientCallContext(ctx, client, "eth_newPendingTransactionFilter", &filterID)
+		if err != nil {
+			err = fmt.Errorf("eth_newPendingTransactionFilter: %w", err)
+			return
+		}
+		defer w.Provider.UninstallFilter(filterID)
+	}
+
+	for {
+		var txs []*web3.Transaction
+		if w.UseFilter {
+			txs, err = w.pollFilter(ctx, filterID)
+		} else {
+			txs, err = w.pollBlock(ctx)
+		}
+		if err != nil {
+			return
+		}
+
+		for _, tx := range txs {
+			p := w.decode(tx)
+			if p == nil {
+				continue
+			}
+			select {
+			case ch <- p:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		w.prune()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+func (w *PendingWatcher) pollBlock(ctx context.Context) (txs []*web3.Transaction, err error) {
+	var block *web3.Block
+	err = rpcContext(ctx, w.Provider, func() (err error) {
+		block, err = w.Provider.GetBlockByNumber(web3.Pending, true)
+		return
+	}, "eth_getBlockByNumber", &block, "pending", true)
+	if err != nil {
+		err = fmt.Errorf("w.Provider.GetBlockByNumber(pending): %w", err)
+		return
+	}
+	if block == nil {
+		return
+	}
+	for _, tx := range block.Transactions {
+		if w.markSeen(tx.Hash) {
+			txs = append(txs, tx)
+		}
+	}
+	return
+}
+
+func (w *PendingWatcher) pollFilter(ctx context.Context, id string) (txs []*web3.Transaction, err error) {
+	client, err := providerClient(w.Provider)
+	if err != nil {
+		return
+	}
+	var hashes []web3.Hash
+	err = clientCallContext(ctx, client, "eth_getFilterChanges", &hashes, id)
+	if err != nil {
+		err = fmt.Errorf("eth_getFilterChanges: %w", err)
+		return
+	}
+	for _, hash := range hashes {
+		if !w.markSeen(hash) {
+			continue
+		}
+		var tx *web3.Transaction
+		txErr := clientCallContext(ctx, client, "eth_getTransactionByHash", &tx, hash)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if txErr != nil {
+			// dropped or already mined and pruned, not worth stopping for
+			seelog.Debugf("eth_getTransactionByHash(%v): %v", hash, txErr)
+			continue
+		}
+		if tx != nil {
+			txs = append(txs, tx)
+		}
+	}
+	return
+}
+
+// decode returns nil when tx is not sent to a watched contract
+func (w *PendingWatcher) decode(tx *web3.Transaction) *PendingTx {
+	if tx.To == nil {
+		return nil
+	}
+	c, ok := w.Contracts[*tx.To]
+	if !ok {
+		return nil
+	}
+	p := &PendingTx{Tx: tx, Contract: c}
+	p.Method, p.Args, p.Err = c.DecodeInput(tx.Input)
+	return p
+}
+
+// markSeen returns false when the hash has been delivered before
+func (w *PendingWatcher) markSeen(hash web3.Hash) bool {
+	if w.seen == nil {
+		w.seen = map[web3.Hash]time.Time{}
+	}
+	if _, ok := w.seen[hash]; ok {
+		return false
+	}
+	w.seen[hash] = time.Now()
+	return true
+}
+
+func (w *PendingWatcher) prune() {
+	deadline := time.Now().Add(-w.SeenTTL)
+	for hash, t := range w.seen {
+		if t.Before(deadline) {
+			delete(w.seen, hash)
+		}
+	}
+}
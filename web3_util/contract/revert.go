@@ -0,0 +1,102 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc/codec"
+)
+
+var (
+	// Error(string)
+	revertErrorSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	// Panic(uint256)
+	revertPanicSelector = []byte{0x4e, 0x48, 0x7b, 0x71}
+
+	revertStringType = abi.MustNewType("tuple(string reason)")
+	revertPanicType  = abi.MustNewType("tuple(uint256 code)")
+)
+
+// RevertError is returned when a call or a simulated transaction reverts
+type RevertError struct {
+	Reason string
+	Data   []byte
+	Err    error
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("execution reverted: %s", e.Reason)
+	}
+	if len(e.Data) > 0 {
+		return fmt.Sprintf("execution reverted: 0x%s", hex.EncodeToString(e.Data))
+	}
+	return "execution reverted"
+}
+
+func (e *RevertError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeRevert decodes the revert data of a failed call,
+// it understands Error(string) and Panic(uint256)
+func DecodeRevert(data []byte) (reason string, err error) {
+	if len(data) < 4 {
+		err = fmt.Errorf("revert data too short: %d bytes", len(data))
+		return
+	}
+	switch {
+	case bytes.Equal(data[:4], revertErrorSelector):
+		var out interface{}
+		out, err = abi.Decode(revertStringType, data[4:])
+		if err != nil {
+			err = fmt.Errorf("abi.Decode(Error): %w", err)
+			return
+		}
+		reason, _ = out.(map[string]interface{})["reason"].(string)
+	case bytes.Equal(data[:4], revertPanicSelector):
+		var out interface{}
+		out, err = abi.Decode(revertPanicType, data[4:])
+		if err != nil {
+			err = fmt.Errorf("abi.Decode(Panic): %w", err)
+			return
+		}
+		code, _ := out.(map[string]interface{})["code"].(*big.Int)
+		reason = fmt.Sprintf("panic: 0x%x", code)
+	default:
+		err = fmt.Errorf("unknown revert selector 0x%s", hex.EncodeToString(data[:4]))
+	}
+	return
+}
+
+// parseRevert turns a json-rpc error of a reverted call into *RevertError,
+// other errors are returned unchanged
+func parseRevert(err error) error {
+	if err == nil {
+		return nil
+	}
+	var rpcErr *codec.ErrorObject
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	if !strings.Contains(strings.ToLower(rpcErr.Message), "revert") {
+		return err
+	}
+
+	revertErr := &RevertError{Err: err}
+	if s, ok := rpcErr.Data.(string); ok && strings.HasPrefix(s, "0x") {
+		revertErr.Data, _ = hex.DecodeString(s[2:])
+	}
+	if reason, decodeErr := DecodeRevert(revertErr.Data); decodeErr == nil {
+		revertErr.Reason = reason
+	} else if i := strings.Index(rpcErr.Message, ":"); i >= 0 {
+		// some nodes only put the reason into the message
+		revertErr.Reason = strings.TrimSpace(rpcErr.Message[i+1:])
+	}
+	return revertErr
+}
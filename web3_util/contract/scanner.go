@@ -0,0 +1,423 @@
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"goutil/file_util"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+// LogScanner pages through eth_getLogs for some events of a contract
+type LogScanner struct {
+	Contract *Contract
+	Events   map[web3.Hash]*abi.Event
+	// Addresses, when set, are scanned instead of the address of Contract,
+	// e.g. to follow an event of many pairs
+	Addresses []web3.Address
+	// MaxAddresses, when set, splits Addresses into eth_getLogs of at most that many addresses
+	MaxAddresses int
+
+	// ChunkSize is the current block range of one eth_getLogs,
+	// it shrinks on "too many results" and grows back up to MaxChunk
+	ChunkSize uint64
+	MinChunk  uint64
+	MaxChunk  uint64
+
+	// Follow only reads blocks that are Confirmations behind the head,
+	// and re-checks the hashes of the last ReorgDepth blocks it has read
+	Confirmations uint64
+	ReorgDepth    uint64
+	PollInterval  time.Duration
+
+	recent []*blockRef
+}
+
+type blockRef struct {
+	Number uint64
+	Hash   web3.Hash
+	Logs   []*DecodedLog
+}
+
+// NewLogScanner creates a scanner for the named events of c, all events when none is given
+func NewLogScanner(c *Contract, events ...string) (s *LogScanner, err error) {
+	s = &LogScanner{
+		Contract:     c,
+		Events:       map[web3.Hash]*abi.Event{},
+		ChunkSize:    2000,
+		MinChunk:     1,
+		MaxChunk:     5000,
+		ReorgDepth:   32,
+		PollInterval: 3 * time.Second,
+	}
+	if len(events) == 0 {
+		for name := range c.Abi.Events {
+			events = append(events, name)
+		}
+	}
+	for _, name := range events {
+		ev, ok := c.Abi.Events[name]
+		if !ok {
+			err = fmt.Errorf("event %s not found in Contract.Abi.Events", name)
+			return
+		}
+		s.Events[ev.ID()] = ev
+	}
+	return
+}
+
+func (s *LogScanner) filter(addrs []web3.Address, from, to uint64) *LogFilter {
+	ids := []web3.Hash{}
+	for id := range s.Events {
+		ids = append(ids, id)
+	}
+	f := &LogFilter{
+		Address: addrs,
+		Topics:  [][]web3.Hash{ids},
+	}
+	return f.SetRange(from, to)
+}
+
+// getLogs reads the logs of blocks [from, to], one request per MaxAddresses addresses
+func (s *LogScanner) getLogs(ctx context.Context, from, to uint64) (logs []*web3.Log, err error) {
+	addrs := s.Addresses
+	if addrs == nil {
+		addrs = []web3.Address{s.Contract.Address}
+	}
+	size := s.MaxAddresses
+	if size <= 0 || size > len(addrs) {
+		size = len(addrs)
+	}
+	for i := 0; i < len(addrs); i += size {
+		end := i + size
+		if end > len(addrs) {
+			end = len(addrs)
+		}
+		var part []*web3.Log
+		if part, err = s.Contract.GetLogsContext(ctx, s.filter(addrs[i:end], from, to)); err != nil {
+			return
+		}
+		logs = append(logs, part...)
+	}
+	if size < len(addrs) {
+		sort.SliceStable(logs, func(i, j int) bool {
+			if logs[i].BlockNumber != logs[j].BlockNumber {
+				return logs[i].BlockNumber < logs[j].BlockNumber
+			}
+			return logs[i].LogIndex < logs[j].LogIndex
+		})
+	}
+	return
+}
+
+func (s *LogScanner) decode(log *web3.Log) (d *DecodedLog, err error) {
+	if len(log.Topics) == 0 {
+		err = fmt.Errorf("log without topics")
+		return
+	}
+	ev, ok := s.Events[log.Topics[0]]
+	if !ok {
+		err = fmt.Errorf("unknown topic %s", log.Topics[0])
+		return
+	}
+	args, err := abi.ParseLog(ev.Inputs, log)
+	if err != nil {
+		err = fmt.Errorf("abi.ParseLog(%s): %w", ev.Name, err)
+		return
+	}
+	d = &DecodedLog{Event: ev.Name, Args: args, Log: log}
+	return
+}
+
+// isTooManyResults tells whether a node refused eth_getLogs because the range was too large
+func isTooManyResults(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{
+		"too many",
+		"limit exceeded",
+		"more than",
+		"block range",
+		"range is too large",
+		"response size",
+		"timeout",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan reads the logs of blocks [from, to] in chunks and passes them to fn in order
+func (s *LogScanner) Scan(from, to uint64, fn func(*DecodedLog) error) error {
+	return s.ScanContext(context.Background(), from, to, fn)
+}
+
+// ScanContext is Scan stopping when ctx is done
+func (s *LogScanner) ScanContext(ctx context.Context, from, to uint64, fn func(*DecodedLog) error) error {
+	return s.scan(ctx, from, to, func(end uint64, logs []*DecodedLog) error {
+		for _, d := range logs {
+			if err := fn(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scan calls fn once per chunk, end is the last block of the chunk
+func (s *LogScanner) scan(ctx context.Context, from, to uint64, fn func(end uint64, logs []*DecodedLog) error) (err error) {
+	if s.ChunkSize == 0 {
+		s.ChunkSize = s.MinChunk
+	}
+	for cur := from; cur <= to; {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		end := cur + s.ChunkSize - 1
+		if end > to {
+			end = to
+		}
+
+		var logs []*web3.Log
+		logs, err = s.getLogs(ctx, cur, end)
+		if err != nil {
+			if isTooManyResults(err) && s.ChunkSize > s.MinChunk {
+				s.ChunkSize /= 2
+				if s.ChunkSize < s.MinChunk {
+					s.ChunkSize = s.MinChunk
+				}
+				seelog.Debugf("shrink chunk size to %v: %v", s.ChunkSize, err)
+				continue
+			}
+			err = fmt.Errorf("s.getLogs(%v, %v): %w", cur, end, err)
+			return
+		}
+
+		decoded := make([]*DecodedLog, 0, len(logs))
+		for _, log := range logs {
+			var d *DecodedLog
+			d, err = s.decode(log)
+			if err != nil {
+				err = fmt.Errorf("s.decode: %w", err)
+				return
+			}
+			decoded = append(decoded, d)
+		}
+		if err = fn(end, decoded); err != nil {
+			return
+		}
+
+		cur = end + 1
+		if s.ChunkSize < s.MaxChunk {
+			s.ChunkSize += s.ChunkSize/2 + 1
+			if s.ChunkSize > s.MaxChunk {
+				s.ChunkSize = s.MaxChunk
+			}
+		}
+	}
+	return
+}
+
+// Checkpoint stores the last block Follow has fully delivered
+type Checkpoint interface {
+	Load() (block uint64, ok bool, err error)
+	Save(block uint64) error
+}
+
+// FileCheckpoint is a Checkpoint kept in a json file
+type FileCheckpoint struct {
+	Path string
+}
+
+func (f *FileCheckpoint) Load() (block uint64, ok bool, err error) {
+	bs, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var data struct{ Block uint64 }
+	err = json.Unmarshal(bs, &data)
+	if err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+	return data.Block, true, nil
+}
+
+func (f *FileCheckpoint) Save(block uint64) error {
+	return file_util.OutputFile(f.Path, map[string]uint64{"Block": block}, nil)
+}
+
+// Follow scans from block `from` (or right after the checkpoint) and keeps polling for new blocks,
+// delivering logs on ch until ctx is done. When a reorg is detected the logs of the dropped
+// blocks are delivered again with Log.Removed set, then the new branch is scanned.
+func (s *LogScanner) Follow(ctx context.Context, from uint64, cp Checkpoint, ch chan<- *DecodedLog) (err error) {
+	next := from
+	if cp != nil {
+		last, ok, loadErr := cp.Load()
+		if loadErr != nil {
+			err = fmt.Errorf("cp.Load: %w", loadErr)
+			return
+		}
+		if ok {
+			next = last + 1
+		}
+	}
+
+	send := func(d *DecodedLog) error {
+		select {
+		case ch <- d:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		var rewound uint64
+		rewound, err = s.checkReorg(ctx, next, send)
+		if err != nil {
+			return
+		}
+		if rewound != next && cp != nil && rewound > 0 {
+			if err = cp.Save(rewound - 1); err != nil {
+				err = fmt.Errorf("cp.Save: %w", err)
+				return
+			}
+		}
+		next = rewound
+
+		var head uint64
+		head, err = blockNumberContext(ctx, s.Contract.Provider)
+		if err != nil {
+			err = fmt.Errorf("eth_blockNumber: %w", err)
+			return
+		}
+		if head >= s.Confirmations && next <= head-s.Confirmations {
+			safe := head - s.Confirmations
+			err = s.scan(ctx, next, safe, func(end uint64, logs []*DecodedLog) error {
+				for _, d := range logs {
+					if err := send(d); err != nil {
+						return err
+					}
+					s.remember(d.Log.BlockNumber, d.Log.BlockHash, d)
+				}
+				next = end + 1
+				if cp != nil {
+					if err := cp.Save(end); err != nil {
+						return fmt.Errorf("cp.Save: %w", err)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return
+			}
+			err = s.rememberTip(ctx, safe)
+			if err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+func (s *LogScanner) remember(number uint64, hash web3.Hash, d *DecodedLog) {
+	n := len(s.recent)
+	if n > 0 && s.recent[n-1].Number == number {
+		if d != nil {
+			s.recent[n-1].Logs = append(s.recent[n-1].Logs, d)
+		}
+		return
+	}
+	ref := &blockRef{Number: number, Hash: hash}
+	if d != nil {
+		ref.Logs = append(ref.Logs, d)
+	}
+	s.recent = append(s.recent, ref)
+
+	// forget blocks deeper than ReorgDepth
+	for len(s.recent) > 0 && s.recent[0].Number+s.ReorgDepth < number {
+		s.recent = s.recent[1:]
+	}
+}
+
+func (s *LogScanner) rememberTip(ctx context.Context, number uint64) (err error) {
+	n := len(s.recent)
+	if n > 0 && s.recent[n-1].Number == number {
+		return
+	}
+	block, err := blockContext(ctx, s.Contract.Provider, web3.BlockNumber(number))
+	if err != nil {
+		err = fmt.Errorf("eth_getBlockByNumber(%v): %w", number, err)
+		return
+	}
+	if block == nil {
+		err = fmt.Errorf("eth_getBlockByNumber(%v): block not found", number)
+		return
+	}
+	s.remember(number, block.Hash, nil)
+	return
+}
+
+// checkReorg compares the remembered block hashes with the chain, newest first.
+// On mismatch the logs of the dropped blocks are resent as removed and the block to scan next
+// is moved back to right after the newest block still on the chain. Blocks without logs are not
+// remembered, so everything after that block is scanned again.
+func (s *LogScanner) checkReorg(ctx context.Context, next uint64, send func(*DecodedLog) error) (uint64, error) {
+	dropped := 0
+	for i := len(s.recent) - 1; i >= 0; i-- {
+		ref := s.recent[i]
+		block, err := blockContext(ctx, s.Contract.Provider, web3.BlockNumber(ref.Number))
+		if err != nil {
+			return next, fmt.Errorf("eth_getBlockByNumber(%v): %w", ref.Number, err)
+		}
+		if block != nil && block.Hash == ref.Hash {
+			break
+		}
+		dropped++
+	}
+	if dropped == 0 {
+		return next, nil
+	}
+
+	keep := len(s.recent) - dropped
+	seelog.Warnf("reorg detected, %v remembered blocks dropped", dropped)
+	for i := len(s.recent) - 1; i >= keep; i-- {
+		for j := len(s.recent[i].Logs) - 1; j >= 0; j-- {
+			d := *s.recent[i].Logs[j]
+			log := *d.Log
+			log.Removed = true
+			d.Log = &log
+			if err := send(&d); err != nil {
+				return next, err
+			}
+		}
+	}
+	if keep > 0 {
+		next = s.recent[keep-1].Number + 1
+	} else {
+		seelog.Warnf("reorg deeper than the remembered blocks, rescan from %v", s.recent[0].Number)
+		next = s.recent[0].Number
+	}
+	s.recent = s.recent[:keep]
+	return next, nil
+}
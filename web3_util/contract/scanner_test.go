@@ -0,0 +1,170 @@
+package contract_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
+)
+
+var pingAbi = abi.MustNewABI(`[{"anonymous":false,"inputs":[{"indexed":false,"name":"n","type":"uint256"}],"name":"Ping","type":"event"}]`)
+
+func newPingContract(t *testing.T, node *rpctest.Server) *contract.Contract {
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contract.NewContract(web3.HexToAddress("0x00000000000000000000000000000000000000aa"), pingAbi, client.Eth())
+}
+
+func addPing(t *testing.T, node *rpctest.Server, c *contract.Contract, block uint64, n int64) {
+	data, err := abi.Encode([]interface{}{big.NewInt(n)}, pingAbi.Events["Ping"].Inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.AddLog(&web3.Log{
+		Address:     c.Address,
+		Topics:      []web3.Hash{pingAbi.Events["Ping"].ID()},
+		Data:        data,
+		BlockNumber: block,
+	})
+}
+
+func recvPing(t *testing.T, ch <-chan *contract.DecodedLog) (n int64, block uint64, removed bool) {
+	select {
+	case d := <-ch:
+		return d.Args["n"].(*big.Int).Int64(), d.Log.BlockNumber, d.Log.Removed
+	case <-time.After(5 * time.Second):
+		t.Fatal("no log delivered")
+	}
+	return
+}
+
+func waitRequests(t *testing.T, node *rpctest.Server, method string, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for node.Count(method) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s requested %d times, want %d", method, node.Count(method), count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// The new branch has a log in a block between the last kept block and the dropped one,
+// which Follow only finds by scanning again from right after the kept block.
+func TestFollowReorgSkippingBlocks(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	c := newPingContract(t, node)
+	node.SetBlockNumber(10)
+	addPing(t, node, c, 3, 3)
+	addPing(t, node, c, 8, 8)
+
+	s, err := contract.NewLogScanner(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan *contract.DecodedLog, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Follow(ctx, 1, nil, ch)
+	}()
+
+	for _, want := range []int64{3, 8} {
+		if n, _, removed := recvPing(t, ch); n != want || removed {
+			t.Fatalf("got %d removed=%v, want %d", n, removed, want)
+		}
+	}
+	// the tip is remembered and checked once before the reorg
+	waitRequests(t, node, "eth_getBlockByNumber", 2)
+
+	node.Reorg(5)
+	addPing(t, node, c, 6, 6)
+	addPing(t, node, c, 9, 9)
+
+	if n, block, removed := recvPing(t, ch); n != 8 || block != 8 || !removed {
+		t.Fatalf("got %d at %d removed=%v, want 8 at 8 removed", n, block, removed)
+	}
+	for _, want := range []int64{6, 9} {
+		if n, _, removed := recvPing(t, ch); n != want || removed {
+			t.Fatalf("got %d removed=%v, want %d", n, removed, want)
+		}
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Follow returned %v, want context.Canceled", err)
+	}
+}
+
+func TestScanContextCanceled(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	c := newPingContract(t, node)
+	node.SetBlockNumber(100)
+	addPing(t, node, c, 1, 1)
+
+	s, err := contract.NewLogScanner(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ChunkSize, s.MaxChunk = 10, 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []int64
+	err = s.ScanContext(ctx, 1, 100, func(d *contract.DecodedLog) error {
+		got = append(got, d.Args["n"].(*big.Int).Int64())
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ScanContext returned %v, want context.Canceled", err)
+	}
+	if len(got) != 1 || node.Count("eth_getLogs") != 1 {
+		t.Fatalf("got %v after %d eth_getLogs, want one log and one request", got, node.Count("eth_getLogs"))
+	}
+}
+
+func TestScanSplitsAddresses(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	c := newPingContract(t, node)
+	node.SetBlockNumber(10)
+	var addrs []web3.Address
+	for i := 1; i <= 5; i++ {
+		other := contract.NewContract(web3.HexToAddress(fmt.Sprintf("0x%040x", 0x100+i)), pingAbi, c.Provider)
+		addrs = append(addrs, other.Address)
+		// the last address logs first
+		addPing(t, node, other, uint64(10-i), int64(10-i))
+	}
+
+	s, err := contract.NewLogScanner(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Addresses, s.MaxAddresses = addrs, 2
+	var got []int64
+	err = s.Scan(1, 10, func(d *contract.DecodedLog) error {
+		got = append(got, d.Args["n"].(*big.Int).Int64())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[5 6 7 8 9]" || node.Count("eth_getLogs") != 3 {
+		t.Fatalf("got %v in %d eth_getLogs, want [5 6 7 8 9] in 3", got, node.Count("eth_getLogs"))
+	}
+}
@@ -0,0 +1,186 @@
+package contract
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+// OverrideAccount replaces parts of an account's state during eth_call
+type OverrideAccount struct {
+	Nonce     *uint64
+	Code      []byte
+	Balance   *big.Int
+	State     map[web3.Hash]web3.Hash
+	StateDiff map[web3.Hash]web3.Hash
+}
+
+// MarshalJSON implements the Marshal interface.
+func (o *OverrideAccount) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{}
+	if o.Nonce != nil {
+		m["nonce"] = fmt.Sprintf("0x%x", *o.Nonce)
+	}
+	if o.Code != nil {
+		m["code"] = "0x" + hex.EncodeToString(o.Code)
+	}
+	if o.Balance != nil {
+		m["balance"] = fmt.Sprintf("0x%x", o.Balance)
+	}
+	if o.State != nil {
+		m["state"] = o.State
+	}
+	if o.StateDiff != nil {
+		m["stateDiff"] = o.StateDiff
+	}
+	return json.Marshal(m)
+}
+
+// StateOverride is the optional third parameter of eth_call,
+// it lets a call run against "what if" state
+type StateOverride map[web3.Address]*OverrideAccount
+
+// SetBalance overrides the native balance of addr
+func (s StateOverride) SetBalance(addr web3.Address, balance *big.Int) StateOverride {
+	s.account(addr).Balance = new(big.Int).Set(balance)
+	return s
+}
+
+// SetStorage overrides a single storage slot of addr, other slots are kept
+func (s StateOverride) SetStorage(addr web3.Address, slot web3.Hash, value web3.Hash) StateOverride {
+	acc := s.account(addr)
+	if acc.StateDiff == nil {
+		acc.StateDiff = map[web3.Hash]web3.Hash{}
+	}
+	acc.StateDiff[slot] = value
+	return s
+}
+
+// SetCode overrides the code of addr
+func (s StateOverride) SetCode(addr web3.Address, code []byte) StateOverride {
+	s.account(addr).Code = code
+	return s
+}
+
+func (s StateOverride) account(addr web3.Address) *OverrideAccount {
+	acc, ok := s[addr]
+	if !ok {
+		acc = &OverrideAccount{}
+		s[addr] = acc
+	}
+	return acc
+}
+
+// callArgs is the eth_call message, web3.CallMsg has no gas field
+type callArgs struct {
+	From     web3.Address
+	To       *web3.Address
+	Data     []byte
+	Gas      uint64
+	GasPrice uint64
+	Value    *big.Int
+}
+
+// MarshalJSON implements the Marshal interface.
+func (c *callArgs) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"from": c.From.String(),
+	}
+	if c.To != nil {
+		m["to"] = c.To.String()
+	}
+	if len(c.Data) != 0 {
+		m["data"] = "0x" + hex.EncodeToString(c.Data)
+	}
+	if c.Gas != 0 {
+		m["gas"] = fmt.Sprintf("0x%x", c.Gas)
+	}
+	if c.GasPrice != 0 {
+		m["gasPrice"] = fmt.Sprintf("0x%x", c.GasPrice)
+	}
+	if c.Value != nil {
+		m["value"] = fmt.Sprintf("0x%x", c.Value)
+	}
+	return json.Marshal(m)
+}
+
+// ethCall runs eth_call with optional state overrides and returns the raw output,
+// a revert is returned as *RevertError
+func (c *Contract) ethCall(ctx context.Context, msg *callArgs, block web3.BlockNumber, override StateOverride) (raw []byte, err error) {
+	client, err := c.client()
+	if err != nil {
+		return
+	}
+
+	params := []interface{}{msg, block.String()}
+	if len(override) > 0 {
+		params = append(params, override)
+	}
+
+	var out string
+	err = clientCallContext(ctx, client, "eth_call", &out, params...)
+	if err != nil {
+		err = parseRevert(err)
+		return
+	}
+	if len(out) < 2 {
+		err = fmt.Errorf("bad eth_call result: %q", out)
+		return
+	}
+	raw, err = hex.DecodeString(out[2:])
+	if err != nil {
+		err = fmt.Errorf("hex.DecodeString: %w", err)
+		return
+	}
+	return
+}
+
+// Simulate runs the transaction through eth_call exactly as it would be sent,
+// with the same from, value and gas, and decodes the method outputs.
+// A revert is returned as *RevertError carrying the decoded reason.
+func (t *Tx) Simulate(block web3.BlockNumber) (resp map[string]interface{}, err error) {
+	return t.SimulateContext(context.Background(), block)
+}
+
+func (t *Tx) SimulateContext(ctx context.Context, block web3.BlockNumber) (resp map[string]interface{}, err error) {
+	if err = t.Validate(); err != nil {
+		err = fmt.Errorf("t.Validate: %w", err)
+		return
+	}
+
+	msg := &callArgs{
+		From:     t.From,
+		To:       t.To,
+		Data:     t.Input,
+		Gas:      t.Gas,
+		GasPrice: t.GasPrice,
+		Value:    t.Value,
+	}
+	if t.Signer != nil {
+		msg.From = t.Signer.Address()
+	}
+
+	raw, err := t.Contract.ethCall(ctx, msg, block, t.StateOverride)
+	if err != nil {
+		err = fmt.Errorf("t.Contract.ethCall: %w", err)
+		return
+	}
+
+	method := t.Contract.Abi.Methods[t.Method]
+	if len(raw) == 0 || len(method.Outputs.TupleElems()) == 0 {
+		resp = map[string]interface{}{}
+		return
+	}
+	respInterface, err := abi.Decode(method.Outputs, raw)
+	if err != nil {
+		err = fmt.Errorf("abi.Decode: %w", err)
+		return
+	}
+	resp = respInterface.(map[string]interface{})
+	return
+}
@@ -0,0 +1,155 @@
+package contract_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc"
+	"github.com/panyanyany/go-web3/jsonrpc/codec"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+func newTokenContract(t *testing.T, node *rpctest.Server) *contract.Contract {
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contract.NewContract(token, contract.Erc20Abi, client.Eth())
+}
+
+func TestSimulateStateOverride(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var from web3.Address
+	node.Mock(token, contract.Erc20Abi).On("balanceOf", func(call *rpctest.Call) ([]interface{}, error) {
+		from = call.From
+		return []interface{}{big.NewInt(7)}, nil
+	})
+	slot := web3.HexToHash("0x01")
+	override := contract.StateOverride{}.
+		SetBalance(holder, big.NewInt(100)).
+		SetStorage(token, slot, web3.HexToHash("0x2a"))
+
+	tx := contract.NewTx().SetContract(newTokenContract(t, node)).SetMethod("balanceOf").AddArgs(holder).
+		SetKey(key).SetStateOverride(override)
+	resp, err := tx.Simulate(web3.Latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp["0"].(*big.Int).Int64() != 7 {
+		t.Fatalf("Simulate() = %v, want 7", resp)
+	}
+	if from != key.Address() {
+		t.Fatalf("simulated from %s, want the signer %s", from, key.Address())
+	}
+
+	params := node.Requests("eth_call")[0].Params
+	if len(params) != 3 {
+		t.Fatalf("eth_call with %d params, want the override as third", len(params))
+	}
+	var sent map[web3.Address]struct {
+		Balance   string                  `json:"balance"`
+		StateDiff map[web3.Hash]web3.Hash `json:"stateDiff"`
+	}
+	if err = json.Unmarshal(params[2], &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent[holder].Balance != "0x64" || sent[token].StateDiff[slot] != web3.HexToHash("0x2a") {
+		t.Fatalf("override sent as %s", params[2])
+	}
+
+	// without overrides the parameter is left out
+	if _, err = tx.SetStateOverride(nil).Simulate(web3.Latest); err != nil {
+		t.Fatal(err)
+	}
+	if params = node.Requests("eth_call")[1].Params; len(params) != 2 {
+		t.Fatalf("eth_call with %d params, want 2", len(params))
+	}
+}
+
+func TestSimulateRevert(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	node.Mock(token, contract.Erc20Abi).Revert("balanceOf", "paused")
+
+	_, err := contract.NewTx().SetContract(newTokenContract(t, node)).SetMethod("balanceOf").AddArgs(holder).
+		Simulate(web3.Latest)
+	var revert *contract.RevertError
+	if !errors.As(err, &revert) || revert.Reason != "paused" {
+		t.Fatalf("Simulate() = %v, want a revert with reason paused", err)
+	}
+}
+
+// custom errors are left undecoded, their data is kept for the caller's ABI
+func TestSimulateCustomError(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	data := customError(t)
+	node.Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+		return nil, &codec.ErrorObject{Code: 3, Message: "execution reverted", Data: "0x" + hex.EncodeToString(data)}
+	})
+
+	_, err := contract.NewTx().SetContract(newTokenContract(t, node)).SetMethod("balanceOf").AddArgs(holder).
+		Simulate(web3.Latest)
+	var revert *contract.RevertError
+	if !errors.As(err, &revert) {
+		t.Fatalf("Simulate() = %v, want a revert", err)
+	}
+	if revert.Reason != "" || hex.EncodeToString(revert.Data) != hex.EncodeToString(data) {
+		t.Fatalf("revert reason %q data %x, want data %x", revert.Reason, revert.Data, data)
+	}
+}
+
+// customError is InsufficientBalance(uint256 available, uint256 required)
+func customError(t *testing.T) []byte {
+	args, err := abi.Encode([]interface{}{big.NewInt(1), big.NewInt(2)}, abi.MustNewType("tuple(uint256 available,uint256 required)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, err := abi.NewMethod("InsufficientBalance(uint256 available, uint256 required)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(method.ID(), args...)
+}
+
+func TestDecodeRevert(t *testing.T) {
+	encode := func(selector string, typ string, v interface{}) []byte {
+		data, err := abi.Encode([]interface{}{v}, abi.MustNewType(typ))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sel, _ := hex.DecodeString(selector)
+		return append(sel, data...)
+	}
+	for _, c := range []struct {
+		name   string
+		data   []byte
+		reason string
+		fails  bool
+	}{
+		{"Error(string)", encode("08c379a0", "tuple(string reason)", "Ownable: caller is not the owner"), "Ownable: caller is not the owner", false},
+		{"Panic(uint256) overflow", encode("4e487b71", "tuple(uint256 code)", big.NewInt(0x11)), "panic: 0x11", false},
+		{"Panic(uint256) division by zero", encode("4e487b71", "tuple(uint256 code)", big.NewInt(0x12)), "panic: 0x12", false},
+		{"custom error", customError(t), "", true},
+		{"empty", nil, "", true},
+		{"truncated Error(string)", []byte{0x08, 0xc3, 0x79, 0xa0, 0x00}, "", true},
+	} {
+		reason, err := contract.DecodeRevert(c.data)
+		if (err != nil) != c.fails || reason != c.reason {
+			t.Errorf("%s: DecodeRevert() = %q, %v", c.name, reason, err)
+		}
+	}
+}
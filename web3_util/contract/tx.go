@@ -1,8 +1,12 @@
 package contract
 
 import (
+	"context"
 	"fmt"
 	"math/big"
+	"time"
+
+	"goutil/web3_util/signer"
 
 	unit "github.com/DeOne4eg/eth-unit-converter"
 	"github.com/cihub/seelog"
@@ -14,24 +18,69 @@ import (
 // Tx is a transaction object
 type Tx struct {
 	*web3.Transaction
-	Receipt            *web3.Receipt
+	Receipt *web3.Receipt
+	// Status is the status of Receipt, 1 when the transaction succeeded and 0 when it reverted.
+	// It is 1 when the provider is not a json-rpc one, web3.Receipt has no status.
+	Status             uint64
 	Contract           *Contract
 	Args               []interface{}
 	Method             string
 	Key                *wallet.Key
 	GasPriceMultiplier uint64
+	// Signer signs the transaction, SetKey sets a local one
+	Signer signer.Signer
+	// SimulateFirst makes Do run Simulate before sending and abort on revert
+	SimulateFirst bool
+	StateOverride StateOverride
+	// PollInterval is how often Wait asks for the receipt
+	PollInterval time.Duration
+	// ChainID signs the transaction, asked to the node when 0
+	ChainID uint64
 }
 
 func NewTx() *Tx {
-	return &Tx{Transaction: &web3.Transaction{}, GasPriceMultiplier: 1}
+	return &Tx{Transaction: &web3.Transaction{}, GasPriceMultiplier: 1, PollInterval: time.Second}
 }
 
 func (t *Tx) SetGasPriceMultiplier(m uint64) *Tx {
 	t.GasPriceMultiplier = m
 	return t
 }
+
+// SetKey sets the key signing the transaction, and its sender
 func (t *Tx) SetKey(key *wallet.Key) *Tx {
 	t.Key = key
+	return t.SetSigner(signer.NewLocal(key))
+}
+
+// SetSigner sets what signs the transaction, and its sender
+func (t *Tx) SetSigner(s signer.Signer) *Tx {
+	t.Signer = s
+	t.From = s.Address()
+	return t
+}
+
+// SetChainID sets the chain id the transaction is signed for, see chains.Chain
+func (t *Tx) SetChainID(id uint64) *Tx {
+	t.ChainID = id
+	return t
+}
+
+// SetPollInterval sets how often Wait asks for the receipt
+func (t *Tx) SetPollInterval(d time.Duration) *Tx {
+	t.PollInterval = d
+	return t
+}
+
+// SetSimulateFirst makes Do simulate the transaction before sending it
+func (t *Tx) SetSimulateFirst(b bool) *Tx {
+	t.SimulateFirst = b
+	return t
+}
+
+// SetStateOverride sets the state overrides used by Simulate
+func (t *Tx) SetStateOverride(o StateOverride) *Tx {
+	t.StateOverride = o
 	return t
 }
 
@@ -80,104 +129,142 @@ func (t *Tx) EstimateGas() (uint64, error) {
 		err = fmt.Errorf("t.Validate: %w", err)
 		return 0, err
 	}
-	return t.estimateGas()
+	return t.estimateGas(context.Background())
 }
 
-func (t *Tx) estimateGas() (uint64, error) {
+func (t *Tx) estimateGas(ctx context.Context) (uint64, error) {
 	msg := &web3.CallMsg{
 		From:  t.From,
 		To:    t.To,
 		Data:  t.Input,
 		Value: t.Value,
 	}
-	return t.Contract.Provider.EstimateGas(msg)
+	return estimateGasContext(ctx, t.Contract.Provider, msg)
 }
 
 // DoAndWait is a blocking query that combines
 // both Do and Wait functions
 func (t *Tx) DoAndWait() error {
-	if err := t.Do(); err != nil {
+	return t.DoAndWaitContext(context.Background())
+}
+
+func (t *Tx) DoAndWaitContext(ctx context.Context) error {
+	if err := t.DoContext(ctx); err != nil {
 		return err
 	}
-	if err := t.Wait(); err != nil {
+	if err := t.WaitContext(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 func (t *Tx) DoRaw() (err error) {
-	chErr := make(chan error)
+	return t.DoRawContext(context.Background())
+}
+
+// DoRawContext fills gas, gas price and nonce, signs and sends the transaction,
+// giving up when ctx is done
+func (t *Tx) DoRawContext(ctx context.Context) (err error) {
+	// Key set directly, without SetKey, still signs
+	if t.Signer == nil && t.Key != nil {
+		t.SetSigner(signer.NewLocal(t.Key))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// the goroutines fill locals, t is only written once all of them succeeded:
+	// on an error we return while some may still run, and the caller may retry with t
+	gasPrice, gas, chainID := t.GasPrice, t.Gas, t.ChainID
+	var nonce uint64
+	// buffered so the remaining goroutines do not block once we returned on an error
+	chErr := make(chan error, 4)
 	chCnt := 0
 	// estimate gas price
-	if t.GasPrice == 0 {
+	if gasPrice == 0 {
 		chCnt++
 		go func() {
-			var err error
-			t.GasPrice, err = t.Contract.Provider.GasPrice()
-			t.GasPrice *= t.GasPriceMultiplier
-			seelog.Debugf("get GasPrice: %v", unit.NewWei(big.NewInt(int64(t.GasPrice))))
+			price, err := gasPriceContext(ctx, t.Contract.Provider)
 			if err != nil {
-				err = fmt.Errorf("t.Contract.Provider.GasPrice(): %w", err)
+				chErr <- fmt.Errorf("t.Contract.Provider.GasPrice(): %w", err)
+				return
 			}
-			chErr <- err
+			gasPrice = price * t.GasPriceMultiplier
+			seelog.Debugf("get GasPrice: %v", unit.NewWei(big.NewInt(int64(gasPrice))))
+			chErr <- nil
 		}()
 	}
 	// estimate gas limit
-	if t.Gas == 0 {
+	if gas == 0 {
 		chCnt++
 		go func() {
-			var err error
-			t.Gas, err = t.estimateGas()
-			t.Gas = t.Gas * 150 / 100 // 必须调为 150% 否则可能失败
-			seelog.Debugf("get Gas: %v", unit.NewWei(big.NewInt(int64(t.Gas))))
+			estimated, err := t.estimateGas(ctx)
 			if err != nil {
-				err = fmt.Errorf("t.estimateGas(): %w", err)
+				chErr <- fmt.Errorf("t.estimateGas(): %w", err)
+				return
 			}
-			chErr <- err
+			gas = estimated * 150 / 100 // 必须调为 150% 否则可能失败
+			seelog.Debugf("get Gas: %v", unit.NewWei(big.NewInt(int64(gas))))
+			chErr <- nil
 		}()
 	}
 
 	// nonce
 	chCnt++
 	go func() {
-		var err error
-		blockNumber, err := t.Contract.Provider.BlockNumber()
+		blockNumber, err := blockNumberContext(ctx, t.Contract.Provider)
 		if err != nil {
-			err = fmt.Errorf("t.Contract.Provider.BlockNumber(): %w", err)
-			chErr <- err
+			chErr <- fmt.Errorf("t.Contract.Provider.BlockNumber(): %w", err)
 			return
 		}
-
-		nonce, err := t.Contract.Provider.GetNonce(t.Key.Address(), web3.BlockNumber(blockNumber))
+		n, err := nonceContext(ctx, t.Contract.Provider, t.From, web3.BlockNumber(blockNumber))
 		if err != nil {
-			err = fmt.Errorf("nonce: %w", err)
-			chErr <- err
+			chErr <- fmt.Errorf("nonce: %w", err)
 			return
 		}
-		t.Nonce = nonce
-		chErr <- err
+		nonce = n
+		chErr <- nil
 	}()
 
-	errCnt := 0
-	for goErr := range chErr {
-		if goErr != nil {
-			err = goErr
+	// chain id
+	if chainID == 0 {
+		chCnt++
+		go func() {
+			id, err := chainIDContext(ctx, t.Contract.Provider)
+			if err != nil {
+				chErr <- fmt.Errorf("t.Contract.Provider.ChainID(): %w", err)
+				return
+			}
+			chainID = id
+			chErr <- nil
+		}()
+	}
+
+	for i := 0; i < chCnt; i++ {
+		if err = <-chErr; err != nil {
 			return
 		}
-		errCnt++
-		if errCnt >= chCnt {
-			close(chErr)
-		}
 	}
+	t.GasPrice, t.Gas, t.Nonce, t.ChainID = gasPrice, gas, nonce, chainID
 
-	// Create the signer object and sign
-	t.Transaction, _ = wallet.NewEIP155Signer(56).SignTx(t.Transaction, t.Key)
+	if t.Signer == nil {
+		err = fmt.Errorf("no signer, see SetKey and SetSigner")
+		return
+	}
+	// every rlp marshal gets its own copy of To, see detachTo
+	unsigned := *t.Transaction
+	detachTo(&unsigned)
+	t.Transaction, err = t.Signer.SignTx(&unsigned, t.ChainID)
+	if err != nil {
+		err = fmt.Errorf("t.Signer.SignTx: %w", err)
+		return
+	}
+	detachTo(t.Transaction)
 
 	// Send the signed transaction
 	data := t.Transaction.MarshalRLP()
+	detachTo(t.Transaction)
 	//if t.addr != nil {
 	//	txn.To = t.addr
 	//}
-	t.Hash, err = t.Contract.Provider.SendRawTransaction(data)
+	t.Hash, err = sendRawTransactionContext(ctx, t.Contract.Provider, data)
 	if err != nil {
 		err = fmt.Errorf("t.Contract.Provider.SendTransaction: %w", err)
 		return
@@ -185,15 +272,37 @@ func (t *Tx) DoRaw() (err error) {
 	return nil
 }
 
+// detachTo points To at a copy of the address. MarshalRLP leaves a reference to
+// the To bytes in a pooled fastrlp arena and a later marshal writes over them,
+// which would corrupt the address of the contract the Tx was built from
+func detachTo(tx *web3.Transaction) {
+	if tx.To != nil {
+		to := *tx.To
+		tx.To = &to
+	}
+}
+
 // Do sends the transaction to the network
 func (t *Tx) Do() (err error) {
+	return t.DoContext(context.Background())
+}
+
+func (t *Tx) DoContext(ctx context.Context) (err error) {
 	err = t.Validate()
 	if err != nil {
 		err = fmt.Errorf("t.Validate: %w", err)
 		return err
 	}
 
-	return t.DoRaw()
+	if t.SimulateFirst {
+		_, err = t.SimulateContext(ctx, web3.Latest)
+		if err != nil {
+			err = fmt.Errorf("t.Simulate: %w", err)
+			return err
+		}
+	}
+
+	return t.DoRawContext(ctx)
 }
 
 // SetGasPrice sets the gas price of the transaction
@@ -210,14 +319,22 @@ func (t *Tx) SetGas(gasLimit uint64) *Tx {
 
 // Wait waits till the transaction is mined
 func (t *Tx) Wait() error {
+	return t.WaitContext(context.Background())
+}
+
+// WaitContext waits till the transaction is mined or ctx is done
+func (t *Tx) WaitContext(ctx context.Context) error {
 	if (t.Hash == web3.Hash{}) {
 		panic("transaction not executed")
 	}
 
 	var err error
 	for {
-		t.Receipt, err = t.Contract.Provider.GetTransactionReceipt(t.Hash)
+		t.Receipt, t.Status, err = receiptContext(ctx, t.Contract.Provider, t.Hash)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			if err.Error() != "not found" {
 				return err
 			}
@@ -225,6 +342,11 @@ func (t *Tx) Wait() error {
 		if t.Receipt != nil {
 			break
 		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(t.PollInterval):
+		}
 	}
 	return nil
 }
@@ -0,0 +1,115 @@
+package contract_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"goutil/web3_util/contract"
+	"goutil/web3_util/rpctest"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+func newTestTx(t *testing.T, node *rpctest.Server) *contract.Tx {
+	client, err := jsonrpc.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := contract.NewContract(web3.HexToAddress("0x00000000000000000000000000000000000000aa"), pingAbi, client.Eth())
+	return contract.NewTx().SetContract(c).SetKey(key).SetInput([]byte{1, 2, 3, 4})
+}
+
+func TestDoRawContextSends(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	tx := newTestTx(t, node)
+	node.SetNonce(tx.From, 7)
+
+	if err := tx.DoRawContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sent := node.Sent()
+	if len(sent) != 1 || sent[0].Tx.Hash != tx.Hash {
+		t.Fatalf("sent %d transactions, want the one of hash %s", len(sent), tx.Hash)
+	}
+	if tx.Nonce != 7 || tx.ChainID != node.ChainID || tx.GasPrice != node.GasPrice || tx.Gas != node.GasLimit*150/100 {
+		t.Fatalf("filled nonce %d chain %d gas price %d gas %d", tx.Nonce, tx.ChainID, tx.GasPrice, tx.Gas)
+	}
+	if sent[0].Tx.From != tx.From {
+		t.Fatalf("signed by %s, want %s", sent[0].Tx.From, tx.From)
+	}
+}
+
+func TestDoRawContextKeyWithoutSigner(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	tx := newTestTx(t, node)
+	tx.Signer, tx.From = nil, web3.Address{}
+
+	if err := tx.DoRawContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sent := node.Sent(); len(sent) != 1 || sent[0].Tx.From != tx.Key.Address() {
+		t.Fatalf("sent %d transactions, want one signed by %s", len(sent), tx.Key.Address())
+	}
+}
+
+// rlp marshalling leaves the To bytes in a pooled arena, later txs must not write over
+// the address of the contract they were built from
+func TestDoRawContextKeepsContractAddress(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	tx := newTestTx(t, node)
+	c, key := tx.Contract, tx.Key
+	want := c.Address
+
+	for i := 0; i < 5; i++ {
+		tx = contract.NewTx().SetContract(c).SetKey(key).SetInput([]byte{1, 2, 3, 4})
+		if err := tx.SetGas(uint64(100000 + i)).DoRawContext(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Address != want {
+		t.Fatalf("contract address %s, want %s", c.Address, want)
+	}
+	for _, sent := range node.Sent() {
+		if *sent.Tx.To != want {
+			t.Fatalf("sent to %s, want %s", sent.Tx.To, want)
+		}
+	}
+}
+
+// A failed fill returns while the other requests are in flight, they must not write the Tx
+// the caller may already be retrying with (go test -race)
+func TestDoRawContextErrorLeavesTx(t *testing.T) {
+	node := rpctest.NewServer()
+	defer node.Close()
+	tx := newTestTx(t, node)
+	node.Fail("eth_gasPrice", 1, -32000, "boom")
+	node.SetLatency("eth_estimateGas", 50*time.Millisecond)
+	node.SetLatency("eth_chainId", 50*time.Millisecond)
+
+	if err := tx.DoRawContext(context.Background()); err == nil {
+		t.Fatal("no error")
+	}
+	for i := 0; i < 10; i++ {
+		if tx.Gas != 0 || tx.ChainID != 0 || tx.GasPrice != 0 || tx.Nonce != 0 {
+			t.Fatalf("tx written after the error: gas %d chain %d gas price %d nonce %d", tx.Gas, tx.ChainID, tx.GasPrice, tx.Nonce)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := tx.DoRawContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Sent()) != 1 {
+		t.Fatalf("sent %d transactions on retry, want 1", len(node.Sent()))
+	}
+}
@@ -0,0 +1,338 @@
+package web3_util
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode tells how Decimal.Round drops digits
+type RoundingMode int
+
+const (
+	// RoundDown truncates toward zero
+	RoundDown RoundingMode = iota
+	// RoundUp rounds away from zero
+	RoundUp
+	// RoundHalfUp rounds to nearest, ties away from zero
+	RoundHalfUp
+	// RoundHalfEven rounds to nearest, ties to the even neighbour
+	RoundHalfEven
+	// RoundFloor rounds toward negative infinity
+	RoundFloor
+	// RoundCeil rounds toward positive infinity
+	RoundCeil
+)
+
+// Decimal is an exact decimal number, value * 10^-scale. The zero value is 0.
+// Operations return new Decimals and never change their operands.
+type Decimal struct {
+	value *big.Int
+	scale int
+}
+
+var bigTen = big.NewInt(10)
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// NewDecimal returns value * 10^-scale
+func NewDecimal(value *big.Int, scale int) Decimal {
+	d := Decimal{value: new(big.Int), scale: scale}
+	if value != nil {
+		d.value.Set(value)
+	}
+	if scale < 0 {
+		d.value.Mul(d.value, pow10(-scale))
+		d.scale = 0
+	}
+	return d
+}
+
+func NewDecimalFromInt(i int64) Decimal {
+	return NewDecimal(big.NewInt(i), 0)
+}
+
+// ParseDecimal reads a decimal such as "-1.25" or "1e-6", exactly
+func ParseDecimal(s string) (d Decimal, err error) {
+	str := strings.TrimSpace(s)
+	exp := 0
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		exp, err = strconv.Atoi(str[i+1:])
+		if err != nil {
+			err = fmt.Errorf("bad decimal %q: %w", s, err)
+			return
+		}
+		str = str[:i]
+	}
+	neg := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "-"), "+")
+
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		err = fmt.Errorf("bad decimal %q", s)
+		return
+	}
+	value, _ := new(big.Int).SetString(digits, 10)
+	if neg {
+		value.Neg(value)
+	}
+	return NewDecimal(value, len(fracPart)-exp), nil
+}
+
+// MustParseDecimal is ParseDecimal panicking on error, for constants
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// FromWeiDecimal is the exact amount of wei in units of decimals
+func FromWeiDecimal(wei *big.Int, decimals int) Decimal {
+	return NewDecimal(wei, decimals)
+}
+
+// FromWeiString formats wei in units of decimals, exactly
+func FromWeiString(wei *big.Int, decimals int) string {
+	return FromWeiDecimal(wei, decimals).String()
+}
+
+// ToWei converts a human amount to wei, more fractional digits than decimals are an error
+func ToWei(s string, decimals int) (wei *big.Int, err error) {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		return
+	}
+	return d.Wei(decimals)
+}
+
+func (d Decimal) int() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+// rescale returns the value of d at a scale not lower than d.scale
+func (d Decimal) rescale(scale int) *big.Int {
+	v := new(big.Int).Set(d.int())
+	if scale > d.scale {
+		v.Mul(v, pow10(scale-d.scale))
+	}
+	return v
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Wei is d in wei of decimals, an error when it does not fit exactly
+func (d Decimal) Wei(decimals int) (wei *big.Int, err error) {
+	r := d.Round(decimals, RoundDown)
+	if r.Cmp(d) != 0 {
+		err = fmt.Errorf("%s has more than %d decimals", d, decimals)
+		return
+	}
+	return r.rescale(decimals), nil
+}
+
+// WeiRound is d in wei of decimals, rounded with mode
+func (d Decimal) WeiRound(decimals int, mode RoundingMode) *big.Int {
+	return d.Round(decimals, mode).rescale(decimals)
+}
+
+// Round keeps places fractional digits, places may be negative to round tens, hundreds...
+func (d Decimal) Round(places int, mode RoundingMode) Decimal {
+	if d.scale <= places {
+		return d
+	}
+	div := pow10(d.scale - places)
+	q, r := new(big.Int).QuoRem(d.int(), div, new(big.Int))
+	if r.Sign() != 0 && roundAway(q, r, div, d.int().Sign(), mode) {
+		if d.int().Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return NewDecimal(q, places)
+}
+
+// roundAway tells whether the truncated quotient q, with remainder r of div, moves away from zero
+func roundAway(q, r, div *big.Int, sign int, mode RoundingMode) bool {
+	switch mode {
+	case RoundUp:
+		return true
+	case RoundFloor:
+		return sign < 0
+	case RoundCeil:
+		return sign > 0
+	case RoundHalfUp, RoundHalfEven:
+		half := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2))
+		switch half.Cmp(div) {
+		case 1:
+			return true
+		case 0:
+			return mode == RoundHalfUp || q.Bit(0) == 1
+		}
+	}
+	return false
+}
+
+func (d Decimal) Add(y Decimal) Decimal {
+	scale := maxInt(d.scale, y.scale)
+	return NewDecimal(new(big.Int).Add(d.rescale(scale), y.rescale(scale)), scale)
+}
+
+func (d Decimal) Sub(y Decimal) Decimal {
+	scale := maxInt(d.scale, y.scale)
+	return NewDecimal(new(big.Int).Sub(d.rescale(scale), y.rescale(scale)), scale)
+}
+
+func (d Decimal) Mul(y Decimal) Decimal {
+	return NewDecimal(new(big.Int).Mul(d.int(), y.int()), d.scale+y.scale)
+}
+
+// Quo divides d by y keeping places fractional digits, it panics when y is 0 like big.Int
+func (d Decimal) Quo(y Decimal, places int, mode RoundingMode) Decimal {
+	// one digit more than places, plus a sticky digit for an inexact quotient, rounds right
+	scale := maxInt(places+1, d.scale-y.scale)
+	num := new(big.Int).Mul(d.int(), pow10(scale+y.scale-d.scale))
+	q, r := new(big.Int).QuoRem(num, y.int(), new(big.Int))
+	if r.Sign() != 0 {
+		q.Mul(q, bigTen)
+		q.Add(q, big.NewInt(int64(d.Sign()*y.Sign())))
+		scale++
+	}
+	return NewDecimal(q, scale).Round(places, mode)
+}
+
+func (d Decimal) Neg() Decimal {
+	return NewDecimal(new(big.Int).Neg(d.int()), d.scale)
+}
+
+func (d Decimal) Abs() Decimal {
+	return NewDecimal(new(big.Int).Abs(d.int()), d.scale)
+}
+
+// Shift moves the decimal point n places to the right
+func (d Decimal) Shift(n int) Decimal {
+	return NewDecimal(d.int(), d.scale-n)
+}
+
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+func (d Decimal) Cmp(y Decimal) int {
+	scale := maxInt(d.scale, y.scale)
+	return d.rescale(scale).Cmp(y.rescale(scale))
+}
+
+func (d Decimal) Equal(y Decimal) bool {
+	return d.Cmp(y) == 0
+}
+
+// BigInt truncates d toward zero
+func (d Decimal) BigInt() *big.Int {
+	return d.Round(0, RoundDown).rescale(0)
+}
+
+// Float64 is the nearest float64 to d
+func (d Decimal) Float64() float64 {
+	v, _ := new(big.Rat).SetFrac(d.int(), pow10(d.scale)).Float64()
+	return v
+}
+
+// String formats d exactly, without trailing fractional zeros
+func (d Decimal) String() string {
+	s := d.StringFixed(d.scale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// StringFixed formats d with exactly places fractional digits, rounding half up
+func (d Decimal) StringFixed(places int) string {
+	if places < 0 {
+		places = 0
+	}
+	r := d.Round(places, RoundHalfUp)
+	digits := new(big.Int).Abs(r.rescale(places)).String()
+	if places > 0 {
+		if len(digits) <= places {
+			digits = strings.Repeat("0", places-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+	}
+	if r.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return digits
+}
+
+// MarshalJSON writes d as a string, keeping all the digits for javascript
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads a string or a number
+func (d *Decimal) UnmarshalJSON(data []byte) (err error) {
+	s := string(data)
+	if s == "null" {
+		return
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err = json.Unmarshal(data, &s); err != nil {
+			return
+		}
+	}
+	*d, err = ParseDecimal(s)
+	return
+}
+
+// Value stores d as a string, exact in DECIMAL and text columns
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan reads DECIMAL, text, integer and float columns
+func (d *Decimal) Scan(src interface{}) (err error) {
+	switch v := src.(type) {
+	case string:
+		*d, err = ParseDecimal(v)
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+	case int64:
+		*d = NewDecimalFromInt(v)
+	case float64:
+		*d, err = ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		err = fmt.Errorf("cannot scan %T into Decimal", src)
+	}
+	return
+}
+
+// GormDataType makes gorm create a text column by default,
+// set gorm:"type:decimal(65,18)" on the field for a numeric one
+func (d Decimal) GormDataType() string {
+	return "string"
+}
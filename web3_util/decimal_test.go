@@ -0,0 +1,255 @@
+package web3_util_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"goutil/web3_util"
+)
+
+func TestParseDecimal(t *testing.T) {
+	for _, c := range []struct {
+		in  string
+		out string
+	}{
+		{"-1.25", "-1.25"},
+		{".5", "0.5"},
+		{"-.5", "-0.5"},
+		{"5.", "5"},
+		{"+7", "7"},
+		{"  3.10  ", "3.1"},
+		{"0.000", "0"},
+		{"-0", "0"},
+		{"1e3", "1000"},
+		{"1.5E-2", "0.015"},
+		{"-2.5e+1", "-25"},
+		{"1e-20", "0.00000000000000000001"},
+		{"123456789012345678901234567890.123456789", "123456789012345678901234567890.123456789"},
+	} {
+		d, err := web3_util.ParseDecimal(c.in)
+		if err != nil {
+			t.Errorf("ParseDecimal(%q): %v", c.in, err)
+			continue
+		}
+		if d.String() != c.out {
+			t.Errorf("ParseDecimal(%q) = %s, want %s", c.in, d, c.out)
+		}
+	}
+	for _, in := range []string{"", "-", ".", "+.", "abc", "1.2.3", "1e", "1e1.5", "--1", "+-1", "0x10", "1,5", "1 000", "NaN", "Inf"} {
+		if d, err := web3_util.ParseDecimal(in); err == nil {
+			t.Errorf("ParseDecimal(%q) = %s, want an error", in, d)
+		}
+	}
+}
+
+func TestStringFixed(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		places int
+		out    string
+	}{
+		{"1", 3, "1.000"},
+		{"1.005", 2, "1.01"},
+		{"-0.5", 0, "-1"},
+		{"0.001", 2, "0.00"},
+		{"-0.001", 2, "0.00"},
+		{"12.345", -1, "12"},
+	} {
+		if out := web3_util.MustParseDecimal(c.in).StringFixed(c.places); out != c.out {
+			t.Errorf("%s.StringFixed(%d) = %s, want %s", c.in, c.places, out, c.out)
+		}
+	}
+}
+
+func TestRoundTies(t *testing.T) {
+	ins := []string{"2.5", "-2.5", "3.5", "-3.5"}
+	for _, c := range []struct {
+		name string
+		mode web3_util.RoundingMode
+		outs []string
+	}{
+		{"RoundDown", web3_util.RoundDown, []string{"2", "-2", "3", "-3"}},
+		{"RoundUp", web3_util.RoundUp, []string{"3", "-3", "4", "-4"}},
+		{"RoundHalfUp", web3_util.RoundHalfUp, []string{"3", "-3", "4", "-4"}},
+		{"RoundHalfEven", web3_util.RoundHalfEven, []string{"2", "-2", "4", "-4"}},
+		{"RoundFloor", web3_util.RoundFloor, []string{"2", "-3", "3", "-4"}},
+		{"RoundCeil", web3_util.RoundCeil, []string{"3", "-2", "4", "-3"}},
+	} {
+		for i, in := range ins {
+			if out := web3_util.MustParseDecimal(in).Round(0, c.mode).String(); out != c.outs[i] {
+				t.Errorf("%s of %s = %s, want %s", c.name, in, out, c.outs[i])
+			}
+		}
+	}
+
+	for _, c := range []struct {
+		in     string
+		places int
+		mode   web3_util.RoundingMode
+		out    string
+	}{
+		// only a tie goes to the even neighbour
+		{"2.51", 0, web3_util.RoundHalfEven, "3"},
+		{"2.49", 0, web3_util.RoundHalfUp, "2"},
+		{"0.125", 2, web3_util.RoundHalfEven, "0.12"},
+		{"0.135", 2, web3_util.RoundHalfEven, "0.14"},
+		{"125", -1, web3_util.RoundHalfEven, "120"},
+		{"135", -1, web3_util.RoundHalfEven, "140"},
+		{"1.5", 3, web3_util.RoundUp, "1.5"},
+	} {
+		if out := web3_util.MustParseDecimal(c.in).Round(c.places, c.mode).String(); out != c.out {
+			t.Errorf("%s.Round(%d, %d) = %s, want %s", c.in, c.places, c.mode, out, c.out)
+		}
+	}
+}
+
+func TestWei(t *testing.T) {
+	for _, c := range []struct {
+		in       string
+		decimals int
+		wei      string
+	}{
+		{"0", 0, "0"},
+		{"0", 6, "0"},
+		{"0", 18, "0"},
+		{"42", 0, "42"},
+		{"1.5", 6, "1500000"},
+		{"1.5", 18, "1500000000000000000"},
+		{"1.000000000", 6, "1000000"},
+		{"-0.000001", 6, "-1"},
+		{"0.000000000000000001", 18, "1"},
+	} {
+		wei, err := web3_util.ToWei(c.in, c.decimals)
+		if err != nil {
+			t.Errorf("ToWei(%q, %d): %v", c.in, c.decimals, err)
+			continue
+		}
+		if wei.String() != c.wei {
+			t.Errorf("ToWei(%q, %d) = %s, want %s", c.in, c.decimals, wei, c.wei)
+		}
+		back, _ := new(big.Int).SetString(c.wei, 10)
+		if out := web3_util.FromWeiDecimal(back, c.decimals); !out.Equal(web3_util.MustParseDecimal(c.in)) {
+			t.Errorf("FromWeiDecimal(%s, %d) = %s, want %s", c.wei, c.decimals, out, c.in)
+		}
+	}
+	for _, c := range []struct {
+		in       string
+		decimals int
+	}{
+		{"1.5", 0},
+		{"0.0000001", 6},
+		{"0.0000000000000000001", 18},
+		{"abc", 18},
+	} {
+		if wei, err := web3_util.ToWei(c.in, c.decimals); err == nil {
+			t.Errorf("ToWei(%q, %d) = %s, want an error", c.in, c.decimals, wei)
+		}
+	}
+
+	if s := web3_util.FromWeiString(big.NewInt(1), 18); s != "0.000000000000000001" {
+		t.Errorf("FromWeiString(1, 18) = %s", s)
+	}
+	if wei := web3_util.MustParseDecimal("0.0000015").WeiRound(6, web3_util.RoundHalfEven); wei.Int64() != 2 {
+		t.Errorf("WeiRound(0.0000015, 6, RoundHalfEven) = %s, want 2", wei)
+	}
+}
+
+func TestQuo(t *testing.T) {
+	for _, c := range []struct {
+		x, y   string
+		places int
+		mode   web3_util.RoundingMode
+		out    string
+	}{
+		{"1", "3", 18, web3_util.RoundDown, "0.333333333333333333"},
+		{"2", "3", 4, web3_util.RoundDown, "0.6666"},
+		{"2", "3", 4, web3_util.RoundHalfUp, "0.6667"},
+		{"-2", "3", 4, web3_util.RoundHalfUp, "-0.6667"},
+		{"2", "-3", 4, web3_util.RoundFloor, "-0.6667"},
+		// an exact tie, and one only past the digits kept
+		{"1", "8", 2, web3_util.RoundHalfEven, "0.12"},
+		{"1", "8", 2, web3_util.RoundHalfUp, "0.13"},
+		{"1.0000000001", "8", 2, web3_util.RoundHalfEven, "0.13"},
+		{"10", "4", 0, web3_util.RoundHalfEven, "2"},
+		{"1.5", "0.5", 0, web3_util.RoundDown, "3"},
+		{"1000000000000000000000000000000", "7", 0, web3_util.RoundDown, "142857142857142857142857142857"},
+		{"0.000001", "1000000", 12, web3_util.RoundDown, "0.000000000001"},
+	} {
+		x, y := web3_util.MustParseDecimal(c.x), web3_util.MustParseDecimal(c.y)
+		if out := x.Quo(y, c.places, c.mode).String(); out != c.out {
+			t.Errorf("%s / %s to %d places = %s, want %s", c.x, c.y, c.places, out, c.out)
+		}
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	type row struct {
+		Price  web3_util.Decimal  `json:"price"`
+		Amount *web3_util.Decimal `json:"amount"`
+	}
+	price := web3_util.MustParseDecimal("12345678901234567890.123456789")
+	bs, err := json.Marshal(row{Price: price})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a string, float64 would lose digits
+	if string(bs) != `{"price":"12345678901234567890.123456789","amount":null}` {
+		t.Fatalf("json %s", bs)
+	}
+	var back row
+	if err = json.Unmarshal(bs, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !back.Price.Equal(price) || back.Amount != nil {
+		t.Fatalf("round trip %s %v", back.Price, back.Amount)
+	}
+
+	// numbers are read too
+	if err = json.Unmarshal([]byte(`{"price":1.5e-3,"amount":"-2"}`), &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Price.String() != "0.0015" || back.Amount.String() != "-2" {
+		t.Fatalf("read %s %s", back.Price, back.Amount)
+	}
+	if err = json.Unmarshal([]byte(`{"price":"1.2.3"}`), &back); err == nil {
+		t.Fatal("bad decimal read without error")
+	}
+}
+
+func TestDecimalSQL(t *testing.T) {
+	d := web3_util.MustParseDecimal("-0.000000000000000001")
+	v, err := d.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back web3_util.Decimal
+	if err = back.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if !back.Equal(d) {
+		t.Fatalf("round trip %s, want %s", back, d)
+	}
+
+	for _, c := range []struct {
+		src interface{}
+		out string
+	}{
+		{"1.50", "1.5"},
+		{[]byte("123.456"), "123.456"},
+		{int64(-42), "-42"},
+		{0.1, "0.1"},
+	} {
+		if err = back.Scan(c.src); err != nil {
+			t.Fatalf("Scan(%v): %v", c.src, err)
+		}
+		if back.String() != c.out {
+			t.Errorf("Scan(%#v) = %s, want %s", c.src, back, c.out)
+		}
+	}
+	for _, src := range []interface{}{true, "abc", nil} {
+		if err = back.Scan(src); err == nil {
+			t.Errorf("Scan(%#v) gave no error", src)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package eip712
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"goutil/web3_util/contract"
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+)
+
+const permitAbiStr = `[
+{"inputs":[{"name":"owner","type":"address"}],"name":"nonces","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"DOMAIN_SEPARATOR","outputs":[{"name":"","type":"bytes32"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"version","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"},{"name":"value","type":"uint256"},{"name":"deadline","type":"uint256"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"name":"permit","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+// PermitAbi has the EIP-2612 methods of a token
+var PermitAbi = abi.MustNewABI(permitAbiStr)
+
+// PermitTypes is the Permit struct of EIP-2612
+var PermitTypes = Types{
+	"Permit": {
+		{"owner", "address"},
+		{"spender", "address"},
+		{"value", "uint256"},
+		{"nonce", "uint256"},
+		{"deadline", "uint256"},
+	},
+}
+
+// Permit lets Spender spend Value of the tokens of Owner until Deadline, without an approve transaction
+type Permit struct {
+	Owner    web3.Address
+	Spender  web3.Address
+	Value    *big.Int
+	Nonce    *big.Int
+	Deadline *big.Int
+}
+
+// TypedData is the permit in the domain of the token
+func (p *Permit) TypedData(domain Domain) *TypedData {
+	return &TypedData{
+		Types:       PermitTypes,
+		PrimaryType: "Permit",
+		Domain:      domain,
+		Message: map[string]interface{}{
+			"owner":    p.Owner,
+			"spender":  p.Spender,
+			"value":    bigArg(p.Value),
+			"nonce":    bigArg(p.Nonce),
+			"deadline": bigArg(p.Deadline),
+		},
+	}
+}
+
+// PermitSignature is a signed Permit, with v, r and s split as permit() takes them
+type PermitSignature struct {
+	*Permit
+	V uint8
+	R [32]byte
+	S [32]byte
+}
+
+// Sign signs the permit with s, which must be the owner
+func (p *Permit) Sign(s signer.Signer, domain Domain) (ps *PermitSignature, err error) {
+	if s.Address() != p.Owner {
+		err = fmt.Errorf("signer %s is not the owner %s", s.Address(), p.Owner)
+		return
+	}
+	sig, err := p.TypedData(domain).Sign(s)
+	if err != nil {
+		return
+	}
+	ps = &PermitSignature{Permit: p}
+	ps.V, ps.R, ps.S, err = SplitSignature(sig)
+	return
+}
+
+// Recover returns the address that signed the permit
+func (ps *PermitSignature) Recover(domain Domain) (web3.Address, error) {
+	sig := append(append(append([]byte{}, ps.R[:]...), ps.S[:]...), ps.V)
+	return ps.TypedData(domain).Recover(sig)
+}
+
+// Args are the arguments of permit(), to pass into a router or any contract taking them
+func (ps *PermitSignature) Args() []interface{} {
+	return []interface{}{ps.Owner, ps.Spender, bigArg(ps.Value), bigArg(ps.Deadline), ps.V, ps.R, ps.S}
+}
+
+// Tx is the permit() call on token, anyone can send it
+func (ps *PermitSignature) Tx(token *contract.Contract) *contract.Tx {
+	c := contract.NewContract(token.Address, PermitAbi, token.Provider)
+	return contract.NewTx().
+		SetMethod("permit").
+		AddArgs(ps.Args()...).
+		SetContract(c)
+}
+
+// PermitDomain builds the domain of token, reading its name and version (default "1"),
+// and checks it against DOMAIN_SEPARATOR when the token has one
+func PermitDomain(ctx context.Context, token *contract.ERC20, chainID uint64) (domain Domain, err error) {
+	name, err := token.Name(ctx)
+	if err != nil {
+		return
+	}
+	addr := token.Address
+	domain = Domain{Name: name, Version: "1", ChainID: new(big.Int).SetUint64(chainID), VerifyingContract: &addr}
+
+	c := contract.NewContract(token.Address, PermitAbi, token.Provider)
+	if resp, versionErr := c.CallContext(ctx, "version", web3.Latest); versionErr == nil {
+		if v, _ := resp["0"].(string); v != "" {
+			domain.Version = v
+		}
+	}
+	resp, sepErr := c.CallContext(ctx, "DOMAIN_SEPARATOR", web3.Latest)
+	if sepErr != nil {
+		return
+	}
+	onChain, _ := resp["0"].([32]byte)
+	ours, err := (&TypedData{Types: PermitTypes, Domain: domain}).DomainSeparator()
+	if err != nil {
+		return
+	}
+	if web3.Hash(onChain) != ours {
+		err = fmt.Errorf("DOMAIN_SEPARATOR of %s is %s, built %s from name %q version %q",
+			token.Address, web3.Hash(onChain), ours, domain.Name, domain.Version)
+	}
+	return
+}
+
+// NewPermit reads the nonce of owner on token
+func NewPermit(ctx context.Context, token *contract.ERC20, owner, spender web3.Address, value, deadline *big.Int) (p *Permit, err error) {
+	c := contract.NewContract(token.Address, PermitAbi, token.Provider)
+	resp, err := c.CallContext(ctx, "nonces", web3.Latest, owner)
+	if err != nil {
+		err = fmt.Errorf("nonces: %w", err)
+		return
+	}
+	nonce, ok := resp["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("bad nonces: %v", resp)
+		return
+	}
+	return &Permit{Owner: owner, Spender: spender, Value: value, Nonce: nonce, Deadline: deadline}, nil
+}
@@ -0,0 +1,62 @@
+package eip712_test
+
+import (
+	"math/big"
+	"testing"
+
+	"goutil/web3_util/eip712"
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+// the digest is built again as EIP-2612 and ERC20Permit contracts do, from their typehash constants
+func TestPermitDigest(t *testing.T) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := web3.HexToAddress("0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82")
+	p := &eip712.Permit{
+		Owner:    key.Address(),
+		Spender:  web3.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E"),
+		Value:    new(big.Int).Mul(big.NewInt(5), big.NewInt(1e18)),
+		Nonce:    big.NewInt(3),
+		Deadline: big.NewInt(1700000000),
+	}
+	domain := eip712.Domain{Name: "PancakeSwap Token", Version: "1", ChainID: big.NewInt(56), VerifyingContract: &token}
+
+	permitTypeHash := web3.HexToHash("0x6e71edae12b1b97f4d1f60370fef10105fa2faae0126114a169c64845d6126c9")
+	domainTypeHash := web3.HexToHash("0x8b73c3c69bb8fe3d512ecc4cf759cc79239f7b179b0ffacaa9a75d522b39400f")
+	if got := eip712.PermitTypes.TypeHash("Permit"); got != permitTypeHash {
+		t.Fatalf("TypeHash(Permit) = %s, want %s", got, permitTypeHash)
+	}
+	words := abi.MustNewType("tuple(bytes32 a,address b,address c,uint256 d,uint256 e,uint256 f)")
+	structData, err := abi.Encode([]interface{}{permitTypeHash, p.Owner, p.Spender, p.Value, p.Nonce, p.Deadline}, words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	domainWords := abi.MustNewType("tuple(bytes32 a,bytes32 b,bytes32 c,uint256 d,address e)")
+	domainData, err := abi.Encode([]interface{}{domainTypeHash, keccak([]byte(domain.Name)), keccak([]byte(domain.Version)), domain.ChainID, token}, domainWords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	domainSeparator, structHash := keccak(domainData), keccak(structData)
+	want := keccak([]byte{0x19, 0x01}, domainSeparator[:], structHash[:])
+
+	if got, err := p.TypedData(domain).Hash(); err != nil || got != want {
+		t.Fatalf("Hash() = %s, %v, want %s", got, err, want)
+	}
+	ps, err := p.Sign(signer.NewLocal(key), domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.V != 27 && ps.V != 28 {
+		t.Fatalf("v = %d", ps.V)
+	}
+	if addr, err := ps.Recover(domain); err != nil || addr != key.Address() {
+		t.Fatalf("Recover() = %s, %v, want %s", addr, err, key.Address())
+	}
+}
@@ -0,0 +1,50 @@
+package eip712
+
+import (
+	"fmt"
+	"math/big"
+
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+// PersonalSign signs msg as personal_sign does (EIP-191 version 0x45)
+func PersonalSign(key *wallet.Key, msg []byte) ([]byte, error) {
+	return signer.NewLocal(key).SignMessage(msg)
+}
+
+// RecoverPersonal returns the address that personal_signed msg
+func RecoverPersonal(msg, sig []byte) (web3.Address, error) {
+	return signer.Recover(signer.TextHash(msg), sig)
+}
+
+// VerifyPersonal tells whether addr personal_signed msg
+func VerifyPersonal(addr web3.Address, msg, sig []byte) bool {
+	signed, err := RecoverPersonal(msg, sig)
+	return err == nil && signed == addr
+}
+
+// SplitSignature returns v (27/28), r and s of a 65 bytes signature, as contracts take them
+func SplitSignature(sig []byte) (v uint8, r, s [32]byte, err error) {
+	if len(sig) != 65 {
+		err = fmt.Errorf("signature must be 65 bytes, got %d", len(sig))
+		return
+	}
+	copy(r[:], sig[:32])
+	copy(s[:], sig[32:64])
+	v = sig[64]
+	if v < 27 {
+		v += 27
+	}
+	return
+}
+
+// bigArg keeps a nil *big.Int out of typed data
+func bigArg(n *big.Int) *big.Int {
+	if n == nil {
+		return new(big.Int)
+	}
+	return n
+}
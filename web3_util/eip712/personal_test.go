@@ -0,0 +1,48 @@
+package eip712_test
+
+import (
+	"testing"
+
+	"goutil/web3_util/eip712"
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+func TestPersonalSign(t *testing.T) {
+	// keccak("\x19Ethereum Signed Message:\n5hello"), as wallets compute it
+	if h := signer.TextHash([]byte("hello")); h != web3.HexToHash("0x50b2c43fd39106bafbba0da34fc430e1f91e3c96ea2acee2bc34119f92b37750") {
+		t.Fatalf("TextHash() = %s", h)
+	}
+
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("hello")
+	sig, err := eip712.PersonalSign(key, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := eip712.RecoverPersonal(msg, sig); err != nil || addr != key.Address() {
+		t.Fatalf("RecoverPersonal() = %s, %v, want %s", addr, err, key.Address())
+	}
+	// some wallets give v as 0/1
+	raw := append([]byte{}, sig...)
+	raw[64] -= 27
+	if !eip712.VerifyPersonal(key.Address(), msg, raw) {
+		t.Fatal("a v of 0/1 does not verify")
+	}
+	if eip712.VerifyPersonal(key.Address(), []byte("hellO"), sig) {
+		t.Fatal("another message verifies")
+	}
+
+	v, r, s, err := eip712.SplitSignature(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != sig[64] || string(r[:]) != string(sig[:32]) || string(s[:]) != string(sig[32:64]) {
+		t.Fatalf("SplitSignature() = %d %x %x", v, r, s)
+	}
+}
@@ -0,0 +1,384 @@
+package eip712
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+	"golang.org/x/crypto/sha3"
+)
+
+// Field is a member of a struct type
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Types are the struct types of typed data, by name. EIP712Domain is added by TypedData when missing.
+type Types map[string][]Field
+
+// Domain is the EIP712Domain, only the set fields are part of it
+type Domain struct {
+	Name              string        `json:"name,omitempty"`
+	Version           string        `json:"version,omitempty"`
+	ChainID           *big.Int      `json:"chainId,omitempty"`
+	VerifyingContract *web3.Address `json:"verifyingContract,omitempty"`
+	Salt              *web3.Hash    `json:"salt,omitempty"`
+}
+
+func (d *Domain) fields() (fields []Field, values map[string]interface{}) {
+	values = map[string]interface{}{}
+	if d.Name != "" {
+		fields = append(fields, Field{"name", "string"})
+		values["name"] = d.Name
+	}
+	if d.Version != "" {
+		fields = append(fields, Field{"version", "string"})
+		values["version"] = d.Version
+	}
+	if d.ChainID != nil {
+		fields = append(fields, Field{"chainId", "uint256"})
+		values["chainId"] = d.ChainID
+	}
+	if d.VerifyingContract != nil {
+		fields = append(fields, Field{"verifyingContract", "address"})
+		values["verifyingContract"] = *d.VerifyingContract
+	}
+	if d.Salt != nil {
+		fields = append(fields, Field{"salt", "bytes32"})
+		values["salt"] = *d.Salt
+	}
+	return
+}
+
+// TypedData is the argument of eth_signTypedData_v4
+type TypedData struct {
+	Types       Types                  `json:"types"`
+	PrimaryType string                 `json:"primaryType"`
+	Domain      Domain                 `json:"domain"`
+	Message     map[string]interface{} `json:"message"`
+}
+
+// ParseTypedData reads the JSON of eth_signTypedData_v4
+func ParseTypedData(data []byte) (td *TypedData, err error) {
+	td = new(TypedData)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(td); err != nil {
+		err = fmt.Errorf("json.Decode: %w", err)
+		return
+	}
+	return
+}
+
+func keccak(parts ...[]byte) (h web3.Hash) {
+	k := sha3.NewLegacyKeccak256()
+	for _, p := range parts {
+		k.Write(p)
+	}
+	copy(h[:], k.Sum(nil))
+	return
+}
+
+var arrayRe = regexp.MustCompile(`^(.+)\[(\d*)\]$`)
+
+// types returns Types with the EIP712Domain of Domain
+func (td *TypedData) types() Types {
+	types := Types{}
+	for name, fields := range td.Types {
+		types[name] = fields
+	}
+	if _, ok := types["EIP712Domain"]; !ok {
+		types["EIP712Domain"], _ = td.Domain.fields()
+	}
+	return types
+}
+
+// deps adds to found the struct types used by typ, typ included
+func (t Types) deps(typ string, found map[string]bool) {
+	if m := arrayRe.FindStringSubmatch(typ); m != nil {
+		typ = m[1]
+	}
+	if _, ok := t[typ]; !ok || found[typ] {
+		return
+	}
+	found[typ] = true
+	for _, f := range t[typ] {
+		t.deps(f.Type, found)
+	}
+}
+
+// EncodeType is typ with its referenced types appended in name order,
+// such as Mail(Person from,Person to,string contents)Person(string name,address wallet)
+func (t Types) EncodeType(typ string) string {
+	found := map[string]bool{}
+	t.deps(typ, found)
+	delete(found, typ)
+	names := []string{typ}
+	var others []string
+	for name := range found {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + "(")
+		for i, f := range t[name] {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(f.Type + " " + f.Name)
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+func (t Types) TypeHash(typ string) web3.Hash {
+	return keccak([]byte(t.EncodeType(typ)))
+}
+
+// HashStruct is keccak(typeHash ‖ encodeData(data))
+func (t Types) HashStruct(typ string, data map[string]interface{}) (h web3.Hash, err error) {
+	fields, ok := t[typ]
+	if !ok {
+		err = fmt.Errorf("unknown type %s", typ)
+		return
+	}
+	typeHash := t.TypeHash(typ)
+	enc := [][]byte{typeHash[:]}
+	for _, f := range fields {
+		word, encErr := t.encodeValue(f.Type, data[f.Name])
+		if encErr != nil {
+			err = fmt.Errorf("%s.%s: %w", typ, f.Name, encErr)
+			return
+		}
+		enc = append(enc, word)
+	}
+	return keccak(enc...), nil
+}
+
+// encodeValue is the 32 bytes encoding of v as typ
+func (t Types) encodeValue(typ string, v interface{}) (word []byte, err error) {
+	if m := arrayRe.FindStringSubmatch(typ); m != nil {
+		items, ok := v.([]interface{})
+		if !ok {
+			err = fmt.Errorf("%s wants an array, got %T", typ, v)
+			return
+		}
+		if m[2] != "" {
+			if n, _ := strconv.Atoi(m[2]); n != len(items) {
+				err = fmt.Errorf("%s wants %d items, got %d", typ, n, len(items))
+				return
+			}
+		}
+		var parts [][]byte
+		for i, item := range items {
+			part, itemErr := t.encodeValue(m[1], item)
+			if itemErr != nil {
+				err = fmt.Errorf("[%d]: %w", i, itemErr)
+				return
+			}
+			parts = append(parts, part)
+		}
+		h := keccak(parts...)
+		return h[:], nil
+	}
+	if _, ok := t[typ]; ok {
+		data, ok := v.(map[string]interface{})
+		if !ok {
+			err = fmt.Errorf("%s wants an object, got %T", typ, v)
+			return
+		}
+		h, hashErr := t.HashStruct(typ, data)
+		return h[:], hashErr
+	}
+
+	word = make([]byte, 32)
+	switch {
+	case typ == "string":
+		s, ok := v.(string)
+		if !ok {
+			err = fmt.Errorf("string wants a string, got %T", v)
+			return
+		}
+		h := keccak([]byte(s))
+		return h[:], nil
+	case typ == "bytes":
+		b, bErr := toBytes(v)
+		if bErr != nil {
+			return nil, bErr
+		}
+		h := keccak(b)
+		return h[:], nil
+	case typ == "bool":
+		b, ok := v.(bool)
+		if !ok {
+			err = fmt.Errorf("bool wants a bool, got %T", v)
+			return
+		}
+		if b {
+			word[31] = 1
+		}
+	case typ == "address":
+		var addr web3.Address
+		switch a := v.(type) {
+		case web3.Address:
+			addr = a
+		case *web3.Address:
+			addr = *a
+		case string:
+			addr = web3.HexToAddress(a)
+		default:
+			err = fmt.Errorf("address wants an address, got %T", v)
+			return
+		}
+		copy(word[12:], addr[:])
+	case strings.HasPrefix(typ, "bytes"):
+		n, _ := strconv.Atoi(strings.TrimPrefix(typ, "bytes"))
+		b, bErr := toBytes(v)
+		if bErr != nil {
+			return nil, bErr
+		}
+		if n < 1 || n > 32 || len(b) > n {
+			err = fmt.Errorf("%s got %d bytes", typ, len(b))
+			return
+		}
+		copy(word, b)
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		n, nErr := toBig(v)
+		if nErr != nil {
+			return nil, nErr
+		}
+		if n.Sign() < 0 {
+			if strings.HasPrefix(typ, "uint") {
+				err = fmt.Errorf("%s got negative %s", typ, n)
+				return
+			}
+			// two's complement on 256 bits
+			n = new(big.Int).Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		if n.BitLen() > 256 {
+			err = fmt.Errorf("%s overflows: %s", typ, n)
+			return
+		}
+		n.FillBytes(word)
+	default:
+		err = fmt.Errorf("unknown type %s", typ)
+	}
+	return
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case [32]byte:
+		return b[:], nil
+	case web3.Hash:
+		return b[:], nil
+	case string:
+		return hex.DecodeString(strings.TrimPrefix(b, "0x"))
+	}
+	return nil, fmt.Errorf("bytes wants bytes or hex, got %T", v)
+}
+
+func toBig(v interface{}) (*big.Int, error) {
+	switch n := v.(type) {
+	case *big.Int:
+		return new(big.Int).Set(n), nil
+	case int:
+		return big.NewInt(int64(n)), nil
+	case int64:
+		return big.NewInt(n), nil
+	case uint64:
+		return new(big.Int).SetUint64(n), nil
+	case uint32:
+		return big.NewInt(int64(n)), nil
+	case uint8:
+		return big.NewInt(int64(n)), nil
+	case float64:
+		if n != float64(int64(n)) {
+			return nil, fmt.Errorf("integer wants a whole number, got %v", n)
+		}
+		return big.NewInt(int64(n)), nil
+	case json.Number:
+		return toBig(string(n))
+	case string:
+		i, ok := new(big.Int).SetString(n, 0)
+		if !ok {
+			return nil, fmt.Errorf("bad integer %q", n)
+		}
+		return i, nil
+	}
+	return nil, fmt.Errorf("integer wants a number, got %T", v)
+}
+
+// DomainSeparator is the hash of Domain
+func (td *TypedData) DomainSeparator() (web3.Hash, error) {
+	types := td.types()
+	_, values := td.Domain.fields()
+	return types.HashStruct("EIP712Domain", values)
+}
+
+// StructHash is the hash of Message as PrimaryType
+func (td *TypedData) StructHash() (web3.Hash, error) {
+	return td.types().HashStruct(td.PrimaryType, td.Message)
+}
+
+// Hashes returns the domain separator and the struct hash, what signer.Signer.SignTypedData takes
+func (td *TypedData) Hashes() (domainSeparator, structHash web3.Hash, err error) {
+	if domainSeparator, err = td.DomainSeparator(); err != nil {
+		err = fmt.Errorf("domain: %w", err)
+		return
+	}
+	if structHash, err = td.StructHash(); err != nil {
+		err = fmt.Errorf("message: %w", err)
+		return
+	}
+	return
+}
+
+// Hash is the digest signed, keccak(0x1901 ‖ domainSeparator ‖ structHash)
+func (td *TypedData) Hash() (h web3.Hash, err error) {
+	domainSeparator, structHash, err := td.Hashes()
+	if err != nil {
+		return
+	}
+	return signer.TypedDataHash(domainSeparator, structHash), nil
+}
+
+// Sign signs td with s, a 65 bytes signature with v 27/28
+func (td *TypedData) Sign(s signer.Signer) (sig []byte, err error) {
+	domainSeparator, structHash, err := td.Hashes()
+	if err != nil {
+		return
+	}
+	return s.SignTypedData(domainSeparator, structHash)
+}
+
+// SignWithKey is Sign with a wallet.Key
+func (td *TypedData) SignWithKey(key *wallet.Key) ([]byte, error) {
+	return td.Sign(signer.NewLocal(key))
+}
+
+// Recover returns the address that signed td
+func (td *TypedData) Recover(sig []byte) (addr web3.Address, err error) {
+	h, err := td.Hash()
+	if err != nil {
+		return
+	}
+	return signer.Recover(h, sig)
+}
@@ -0,0 +1,106 @@
+package eip712_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"goutil/web3_util/eip712"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+	"golang.org/x/crypto/sha3"
+)
+
+func keccak(b ...[]byte) (h web3.Hash) {
+	k := sha3.NewLegacyKeccak256()
+	for _, p := range b {
+		k.Write(p)
+	}
+	copy(h[:], k.Sum(nil))
+	return
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// the example of the EIP-712 specification, https://eips.ethereum.org/assets/eip-712/Example.js
+const mailJson = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func TestMailExample(t *testing.T) {
+	td, err := eip712.ParseTypedData([]byte(mailJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := td.Types.EncodeType("Mail"); got != "Mail(Person from,Person to,string contents)Person(string name,address wallet)" {
+		t.Fatalf("EncodeType() = %s", got)
+	}
+	if got := td.Types.TypeHash("Mail"); got != web3.HexToHash("0xa0cedeb2dc280ba39b857546d74f5549c3a1d7bdc2dd96bf881f76108e23dac2") {
+		t.Fatalf("TypeHash() = %s", got)
+	}
+	domainSeparator, structHash, err := td.Hashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domainSeparator != web3.HexToHash("0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f") {
+		t.Fatalf("DomainSeparator() = %s", domainSeparator)
+	}
+	if structHash != web3.HexToHash("0xc52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e") {
+		t.Fatalf("StructHash() = %s", structHash)
+	}
+	if h, _ := td.Hash(); h != web3.HexToHash("0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2") {
+		t.Fatalf("Hash() = %s", h)
+	}
+
+	cow := keccak([]byte("cow"))
+	key, err := wallet.NewWalletFromPrivKey(cow[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := td.SignWithKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mustHex(t, "4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d"+
+		"07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b91562"+"1c")
+	if hex.EncodeToString(sig) != hex.EncodeToString(want) {
+		t.Fatalf("Sign() = %x, want %x", sig, want)
+	}
+	if addr, err := td.Recover(sig); err != nil || addr != web3.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826") {
+		t.Fatalf("Recover() = %s, %v", addr, err)
+	}
+}
@@ -0,0 +1,330 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unsafe"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+)
+
+// ErrBadPassword is returned when the MAC of a keystore does not match the password
+var ErrBadPassword = errors.New("could not decrypt key with given password")
+
+// Scrypt parameters of geth, Light ones are for tests and low memory hosts
+const (
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+	LightScryptN    = 1 << 12
+	LightScryptP    = 6
+
+	scryptR     = 8
+	scryptDKLen = 32
+	pbkdf2C     = 262144
+)
+
+// KdfParams are the scrypt or pbkdf2 parameters of a keystore, only the ones of its kdf are set
+type KdfParams struct {
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+	N     int    `json:"n,omitempty"`
+	R     int    `json:"r,omitempty"`
+	P     int    `json:"p,omitempty"`
+	C     int    `json:"c,omitempty"`
+	Prf   string `json:"prf,omitempty"`
+}
+
+type CryptoJSON struct {
+	Cipher       string `json:"cipher"`
+	CipherText   string `json:"ciphertext"`
+	CipherParams struct {
+		IV string `json:"iv"`
+	} `json:"cipherparams"`
+	KDF       string    `json:"kdf"`
+	KDFParams KdfParams `json:"kdfparams"`
+	MAC       string    `json:"mac"`
+}
+
+// KeyJSON is a version 3 keystore file as written by geth and MetaMask
+type KeyJSON struct {
+	Address string     `json:"address"`
+	Crypto  CryptoJSON `json:"crypto"`
+	ID      string     `json:"id"`
+	Version int        `json:"version"`
+}
+
+// Options choose the kdf of Encrypt, "scrypt" (the default) or "pbkdf2"
+type Options struct {
+	KDF     string
+	ScryptN int
+	ScryptP int
+}
+
+// KeyFromHex reads a hex private key, with or without 0x
+func KeyFromHex(s string) (key *wallet.Key, err error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s) != 64 {
+		err = fmt.Errorf("private key must be 32 bytes, got %d hex chars", len(s))
+		return
+	}
+	bs, err := hex.DecodeString(s)
+	if err != nil {
+		err = fmt.Errorf("hex.DecodeString: %w", err)
+		return
+	}
+	defer zero(bs)
+	key, err = wallet.NewWalletFromPrivKey(bs)
+	if err != nil {
+		err = fmt.Errorf("wallet.NewWalletFromPrivKey: %w", err)
+		return
+	}
+	return
+}
+
+// Encrypt seals key with password into a version 3 keystore
+func Encrypt(key *wallet.Key, password string, opts Options) (data []byte, err error) {
+	priv, err := key.MarshallPrivateKey()
+	if err != nil {
+		return
+	}
+	defer zero(priv)
+
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err = rand.Read(salt); err != nil {
+		return
+	}
+	if _, err = rand.Read(iv); err != nil {
+		return
+	}
+
+	params := KdfParams{DKLen: scryptDKLen, Salt: hex.EncodeToString(salt)}
+	kdf := opts.KDF
+	switch kdf {
+	case "", "scrypt":
+		kdf = "scrypt"
+		params.N, params.R, params.P = opts.ScryptN, scryptR, opts.ScryptP
+		if params.N == 0 {
+			params.N, params.P = StandardScryptN, StandardScryptP
+		}
+	case "pbkdf2":
+		params.C, params.Prf = pbkdf2C, "hmac-sha256"
+	default:
+		err = fmt.Errorf("unsupported kdf %q", kdf)
+		return
+	}
+	derived, err := deriveKey(kdf, params, password)
+	if err != nil {
+		return
+	}
+	defer zero(derived)
+
+	cipherText, err := aesCTR(derived[:16], iv, priv)
+	if err != nil {
+		return
+	}
+	k := KeyJSON{
+		Address: hex.EncodeToString(addressBytes(key.Address())),
+		ID:      newUUID(),
+		Version: 3,
+	}
+	k.Crypto = CryptoJSON{
+		Cipher:     "aes-128-ctr",
+		CipherText: hex.EncodeToString(cipherText),
+		KDF:        kdf,
+		KDFParams:  params,
+		MAC:        hex.EncodeToString(keccak(derived[16:32], cipherText)),
+	}
+	k.Crypto.CipherParams.IV = hex.EncodeToString(iv)
+	return json.MarshalIndent(k, "", "  ")
+}
+
+// Decrypt opens a version 3 keystore, ErrBadPassword when password is wrong
+func Decrypt(data []byte, password string) (key *wallet.Key, err error) {
+	var k KeyJSON
+	if err = json.Unmarshal(data, &k); err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+	if k.Version != 3 {
+		err = fmt.Errorf("unsupported keystore version %d", k.Version)
+		return
+	}
+	if k.Crypto.Cipher != "aes-128-ctr" {
+		err = fmt.Errorf("unsupported cipher %q", k.Crypto.Cipher)
+		return
+	}
+	cipherText, err := hex.DecodeString(k.Crypto.CipherText)
+	if err != nil {
+		err = fmt.Errorf("bad ciphertext: %w", err)
+		return
+	}
+	iv, err := hex.DecodeString(k.Crypto.CipherParams.IV)
+	if err != nil {
+		err = fmt.Errorf("bad iv: %w", err)
+		return
+	}
+	mac, err := hex.DecodeString(k.Crypto.MAC)
+	if err != nil {
+		err = fmt.Errorf("bad mac: %w", err)
+		return
+	}
+
+	derived, err := deriveKey(k.Crypto.KDF, k.Crypto.KDFParams, password)
+	if err != nil {
+		return
+	}
+	defer zero(derived)
+	if !bytes.Equal(keccak(derived[16:32], cipherText), mac) {
+		err = ErrBadPassword
+		return
+	}
+	priv, err := aesCTR(derived[:16], iv, cipherText)
+	if err != nil {
+		return
+	}
+	defer zero(priv)
+	key, err = wallet.NewWalletFromPrivKey(priv)
+	if err != nil {
+		err = fmt.Errorf("wallet.NewWalletFromPrivKey: %w", err)
+		return
+	}
+	if k.Address != "" && !strings.EqualFold(strings.TrimPrefix(k.Address, "0x"), hex.EncodeToString(addressBytes(key.Address()))) {
+		Wipe(key)
+		key = nil
+		err = fmt.Errorf("keystore address %s does not match its key", k.Address)
+	}
+	return
+}
+
+// LoadFile decrypts the keystore at path
+func LoadFile(path, password string) (key *wallet.Key, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("ioutil.ReadFile: %w", err)
+		return
+	}
+	return Decrypt(data, password)
+}
+
+// SaveFile encrypts key into path, readable by the owner only
+func SaveFile(path string, key *wallet.Key, password string, opts Options) (err error) {
+	data, err := Encrypt(key, password, opts)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		err = fmt.Errorf("os.MkdirAll: %w", err)
+		return
+	}
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		err = fmt.Errorf("ioutil.WriteFile: %w", err)
+		return
+	}
+	return
+}
+
+func deriveKey(kdf string, p KdfParams, password string) (derived []byte, err error) {
+	salt, err := hex.DecodeString(p.Salt)
+	if err != nil {
+		err = fmt.Errorf("bad salt: %w", err)
+		return
+	}
+	if p.DKLen < 32 {
+		err = fmt.Errorf("dklen %d is under 32", p.DKLen)
+		return
+	}
+	switch kdf {
+	case "scrypt":
+		derived, err = scrypt.Key([]byte(password), salt, p.N, p.R, p.P, p.DKLen)
+		if err != nil {
+			err = fmt.Errorf("scrypt.Key: %w", err)
+		}
+	case "pbkdf2":
+		if p.Prf != "hmac-sha256" {
+			err = fmt.Errorf("unsupported pbkdf2 prf %q", p.Prf)
+			return
+		}
+		derived = pbkdf2.Key([]byte(password), salt, p.C, p.DKLen, sha256.New)
+	default:
+		err = fmt.Errorf("unsupported kdf %q", kdf)
+	}
+	return
+}
+
+func aesCTR(key, iv, in []byte) (out []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		err = fmt.Errorf("aes.NewCipher: %w", err)
+		return
+	}
+	out = make([]byte, len(in))
+	cipher.NewCTR(block, iv).XORKeyStream(out, in)
+	return
+}
+
+func keccak(parts ...[]byte) []byte {
+	k := sha3.NewLegacyKeccak256()
+	for _, p := range parts {
+		k.Write(p)
+	}
+	return k.Sum(nil)
+}
+
+func addressBytes(addr web3.Address) []byte {
+	return addr[:]
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Wipe zeroes the private scalar of key in place, the key must not be used after.
+// It is best effort: wallet.Key keeps the scalar unexported so it is reached through
+// reflection, and copies made before, such as by MarshallPrivateKey, are not wiped.
+// TestWipe fails when an upgrade of go-web3 changes the layout it relies on.
+func Wipe(key *wallet.Key) {
+	if key == nil {
+		return
+	}
+	field := reflect.ValueOf(key).Elem().FieldByName("priv")
+	if !field.IsValid() || field.IsNil() {
+		return
+	}
+	priv := (*ecdsa.PrivateKey)(unsafe.Pointer(field.Pointer()))
+	if priv.D != nil {
+		words := priv.D.Bits()
+		for i := range words {
+			words[i] = 0
+		}
+		priv.D.SetInt64(0)
+	}
+}
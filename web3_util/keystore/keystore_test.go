@@ -0,0 +1,142 @@
+package keystore_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"goutil/web3_util/keystore"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+// the test vectors of the Web3 Secret Storage Definition, password "testpassword"
+const (
+	vectorPriv    = "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d"
+	vectorAddress = "0x008aeeda4d805471df9b2a5b0f38a0c3bcba786b"
+	vectorPbkdf2  = `{
+  "crypto": {
+    "cipher": "aes-128-ctr",
+    "cipherparams": {"iv": "6087dab2f9fdbbfaddc31a909735c1e6"},
+    "ciphertext": "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+    "kdf": "pbkdf2",
+    "kdfparams": {"c": 262144, "dklen": 32, "prf": "hmac-sha256", "salt": "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"},
+    "mac": "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+  },
+  "id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+  "version": 3
+}`
+	vectorScrypt = `{
+  "crypto": {
+    "cipher": "aes-128-ctr",
+    "cipherparams": {"iv": "83dbcc02d8ccb40e466191a123791e0e"},
+    "ciphertext": "d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c",
+    "kdf": "scrypt",
+    "kdfparams": {"dklen": 32, "n": 262144, "r": 1, "p": 8, "salt": "ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"},
+    "mac": "2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097"
+  },
+  "id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+  "version": 3
+}`
+)
+
+var light = keystore.Options{ScryptN: keystore.LightScryptN, ScryptP: keystore.LightScryptP}
+
+func privHex(t *testing.T, key *wallet.Key) string {
+	priv, err := key.MarshallPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(priv)
+}
+
+func TestDecryptVectors(t *testing.T) {
+	for name, data := range map[string]string{"pbkdf2": vectorPbkdf2, "scrypt": vectorScrypt} {
+		key, err := keystore.Decrypt([]byte(data), "testpassword")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if privHex(t, key) != vectorPriv || key.Address() != web3.HexToAddress(vectorAddress) {
+			t.Fatalf("%s: key %s of %s", name, privHex(t, key), key.Address())
+		}
+		if _, err = keystore.Decrypt([]byte(data), "testpassword2"); !errors.Is(err, keystore.ErrBadPassword) {
+			t.Fatalf("%s: wrong password gave %v, want ErrBadPassword", name, err)
+		}
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key, err := keystore.KeyFromHex("0x" + vectorPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []keystore.Options{light, {KDF: "pbkdf2"}} {
+		data, err := keystore.Encrypt(key, "secret", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var k keystore.KeyJSON
+		if err = json.Unmarshal(data, &k); err != nil {
+			t.Fatal(err)
+		}
+		if k.Version != 3 || "0x"+k.Address != vectorAddress || strings.Contains(string(data), vectorPriv) {
+			t.Fatalf("keystore %s", data)
+		}
+
+		back, err := keystore.Decrypt(data, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if privHex(t, back) != vectorPriv {
+			t.Fatalf("%s: decrypted %s", k.Crypto.KDF, privHex(t, back))
+		}
+		if _, err = keystore.Decrypt(data, "Secret"); !errors.Is(err, keystore.ErrBadPassword) {
+			t.Fatalf("%s: wrong password gave %v, want ErrBadPassword", k.Crypto.KDF, err)
+		}
+	}
+	if _, err = keystore.Encrypt(key, "secret", keystore.Options{KDF: "argon2"}); err == nil {
+		t.Fatal("Encrypt with an unknown kdf gave no error")
+	}
+}
+
+// a keystore whose address is not the one of its key is rejected, not trusted
+func TestDecryptAddressMismatch(t *testing.T) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := keystore.Encrypt(key, "secret", light)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var k map[string]interface{}
+	if err = json.Unmarshal(data, &k); err != nil {
+		t.Fatal(err)
+	}
+	k["address"] = strings.TrimPrefix(vectorAddress, "0x")
+	if data, err = json.Marshal(k); err != nil {
+		t.Fatal(err)
+	}
+
+	back, err := keystore.Decrypt(data, "secret")
+	if err == nil || errors.Is(err, keystore.ErrBadPassword) || back != nil {
+		t.Fatalf("Decrypt() = %v, %v, want an address mismatch", back, err)
+	}
+}
+
+func TestDecryptBadKeystore(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		strings.Replace(vectorPbkdf2, `"version": 3`, `"version": 1`, 1),
+		strings.Replace(vectorPbkdf2, "aes-128-ctr", "aes-128-cbc", 1),
+		strings.Replace(vectorPbkdf2, `"kdf": "pbkdf2"`, `"kdf": "argon2"`, 1),
+		strings.Replace(vectorPbkdf2, "6087dab2", "zz87dab2", 1),
+	} {
+		if _, err := keystore.Decrypt([]byte(data), "testpassword"); err == nil || errors.Is(err, keystore.ErrBadPassword) {
+			t.Errorf("Decrypt(%.40q) = %v, want a format error", data, err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+var (
+	ErrUnknownAccount = errors.New("unknown account")
+	ErrClosed         = errors.New("key manager is closed")
+)
+
+// Account is a named key of a Manager, printing it only shows its name and address
+type Account struct {
+	Name    string
+	Address web3.Address
+	// Path is the derivation path when the key comes from a mnemonic
+	Path string
+	key  *wallet.Key
+}
+
+func (a *Account) String() string {
+	return fmt.Sprintf("%s(%s)", a.Name, a.Address)
+}
+
+func (a *Account) GoString() string {
+	return a.String()
+}
+
+// Manager holds named keys in memory, loaded from keystore files in Dir or derived from mnemonics.
+// Close wipes them.
+type Manager struct {
+	Dir     string
+	Options Options
+
+	lock     sync.RWMutex
+	accounts map[string]*Account
+	closed   bool
+}
+
+func NewManager(dir string) *Manager {
+	return &Manager{Dir: dir, accounts: map[string]*Account{}}
+}
+
+func (m *Manager) SetOptions(opts Options) *Manager {
+	m.Options = opts
+	return m
+}
+
+// Add holds key under name, the manager owns it from then on
+func (m *Manager) Add(name string, key *wallet.Key) (account *Account, err error) {
+	return m.add(&Account{Name: name, Address: key.Address(), key: key})
+}
+
+func (m *Manager) add(account *Account) (*Account, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		Wipe(account.key)
+		return nil, ErrClosed
+	}
+	if _, ok := m.accounts[account.Name]; ok {
+		Wipe(account.key)
+		return nil, fmt.Errorf("account %s already exists", account.Name)
+	}
+	m.accounts[account.Name] = account
+	seelog.Infof("keystore: added account %s", account)
+	return account, nil
+}
+
+// ImportHex adds a hex private key, with or without 0x
+func (m *Manager) ImportHex(name, hexKey string) (account *Account, err error) {
+	key, err := KeyFromHex(hexKey)
+	if err != nil {
+		return
+	}
+	return m.Add(name, key)
+}
+
+// ImportMnemonic adds the key at path of mnemonic, DefaultPath index 0 when path is empty
+func (m *Manager) ImportMnemonic(name, mnemonic, password, path string) (account *Account, err error) {
+	if path == "" {
+		path = fmt.Sprintf(DefaultPath, 0)
+	}
+	key, err := Derive(mnemonic, password, path)
+	if err != nil {
+		return
+	}
+	return m.add(&Account{Name: name, Address: key.Address(), Path: path, key: key})
+}
+
+// Generate adds a new random key
+func (m *Manager) Generate(name string) (account *Account, err error) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		err = fmt.Errorf("wallet.GenerateKey: %w", err)
+		return
+	}
+	return m.Add(name, key)
+}
+
+func (m *Manager) file(name string) string {
+	return filepath.Join(m.Dir, name+".json")
+}
+
+// Load decrypts <Dir>/<name>.json
+func (m *Manager) Load(name, password string) (account *Account, err error) {
+	return m.LoadFile(name, m.file(name), password)
+}
+
+// LoadFile decrypts the keystore at path under name
+func (m *Manager) LoadFile(name, path, password string) (account *Account, err error) {
+	key, err := LoadFile(path, password)
+	if err != nil {
+		err = fmt.Errorf("load %s: %w", name, err)
+		return
+	}
+	return m.Add(name, key)
+}
+
+// LoadAll decrypts every json keystore of Dir, named after their files
+func (m *Manager) LoadAll(password string) (accounts []*Account, err error) {
+	paths, err := filepath.Glob(filepath.Join(m.Dir, "*.json"))
+	if err != nil {
+		err = fmt.Errorf("filepath.Glob: %w", err)
+		return
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		account, loadErr := m.LoadFile(name, path, password)
+		if loadErr != nil {
+			return accounts, loadErr
+		}
+		accounts = append(accounts, account)
+	}
+	return
+}
+
+// Save encrypts the key of name into <Dir>/<name>.json with Options
+func (m *Manager) Save(name, password string) (err error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	account, err := m.get(name)
+	if err != nil {
+		return
+	}
+	if err = SaveFile(m.file(name), account.key, password, m.Options); err != nil {
+		err = fmt.Errorf("save %s: %w", name, err)
+		return
+	}
+	seelog.Infof("keystore: saved account %s", account)
+	return
+}
+
+func (m *Manager) get(name string) (*Account, error) {
+	if m.closed {
+		return nil, ErrClosed
+	}
+	account, ok := m.accounts[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrUnknownAccount)
+	}
+	return account, nil
+}
+
+// Account returns the account named name
+func (m *Manager) Account(name string) (*Account, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.get(name)
+}
+
+// Key returns the key of name, to give to contract.Tx.SetKey. It is wiped by Remove and Close.
+func (m *Manager) Key(name string) (key *wallet.Key, err error) {
+	account, err := m.Account(name)
+	if err != nil {
+		return
+	}
+	return account.key, nil
+}
+
+// ByAddress finds the account of addr
+func (m *Manager) ByAddress(addr web3.Address) (*Account, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	for _, account := range m.accounts {
+		if account.Address == addr {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", addr, ErrUnknownAccount)
+}
+
+// Names returns the account names, sorted
+func (m *Manager) Names() (names []string) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for name := range m.accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Remove wipes and forgets the key of name
+func (m *Manager) Remove(name string) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	account, err := m.get(name)
+	if err != nil {
+		return
+	}
+	Wipe(account.key)
+	delete(m.accounts, name)
+	return
+}
+
+// Close wipes all the keys, the manager can not be used after
+func (m *Manager) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for name, account := range m.accounts {
+		Wipe(account.key)
+		delete(m.accounts, name)
+	}
+	m.closed = true
+	return nil
+}
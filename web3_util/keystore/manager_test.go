@@ -0,0 +1,127 @@
+package keystore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"goutil/web3_util/keystore"
+
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+func isWiped(t *testing.T, key *wallet.Key) bool {
+	for _, c := range privHex(t, key) {
+		if c != '0' {
+			return false
+		}
+	}
+	return true
+}
+
+func generate(t *testing.T) *wallet.Key {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestManager(t *testing.T) {
+	m := keystore.NewManager("")
+	alice, bob := generate(t), generate(t)
+	if _, err := m.Add("alice", alice); err != nil {
+		t.Fatal(err)
+	}
+	account, err := m.Add("bob", bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Address != bob.Address() || account.String() != "bob("+bob.Address().String()+")" {
+		t.Fatalf("account %s", account)
+	}
+	if key, err := m.Key("alice"); err != nil || key != alice {
+		t.Fatalf("Key(alice) = %v, %v", key, err)
+	}
+	if found, err := m.ByAddress(bob.Address()); err != nil || found.Name != "bob" {
+		t.Fatalf("ByAddress(bob) = %v, %v", found, err)
+	}
+
+	// a name taken wipes the key given
+	dup := generate(t)
+	if _, err = m.Add("alice", dup); err == nil || !isWiped(t, dup) {
+		t.Fatalf("Add of a taken name: %v, wiped %v", err, isWiped(t, dup))
+	}
+
+	if err = m.Remove("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if !isWiped(t, alice) {
+		t.Fatal("removed key not wiped")
+	}
+	if _, err = m.Key("alice"); !errors.Is(err, keystore.ErrUnknownAccount) {
+		t.Fatalf("Key of a removed account: %v, want ErrUnknownAccount", err)
+	}
+	if err = m.Remove("alice"); !errors.Is(err, keystore.ErrUnknownAccount) {
+		t.Fatalf("Remove twice: %v, want ErrUnknownAccount", err)
+	}
+	if isWiped(t, bob) {
+		t.Fatal("bob wiped along with alice")
+	}
+
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !isWiped(t, bob) {
+		t.Fatal("key not wiped by Close")
+	}
+	if len(m.Names()) != 0 {
+		t.Fatalf("accounts %v left after Close", m.Names())
+	}
+	if _, err = m.Key("bob"); !errors.Is(err, keystore.ErrClosed) {
+		t.Fatalf("Key after Close: %v, want ErrClosed", err)
+	}
+	if _, err = m.ByAddress(bob.Address()); !errors.Is(err, keystore.ErrClosed) {
+		t.Fatalf("ByAddress after Close: %v, want ErrClosed", err)
+	}
+	late := generate(t)
+	if _, err = m.Add("carol", late); !errors.Is(err, keystore.ErrClosed) || !isWiped(t, late) {
+		t.Fatalf("Add after Close: %v, wiped %v, want ErrClosed and the key wiped", err, isWiped(t, late))
+	}
+}
+
+func TestManagerSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := keystore.NewManager(dir).SetOptions(light)
+	account, err := m.ImportHex("vector", vectorPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Save("vector", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	m = keystore.NewManager(dir)
+	defer m.Close()
+	if _, err = m.Load("vector", "wrong"); !errors.Is(err, keystore.ErrBadPassword) {
+		t.Fatalf("Load with a wrong password: %v, want ErrBadPassword", err)
+	}
+	loaded, err := m.Load("vector", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := m.Key("vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Address != account.Address || privHex(t, key) != vectorPriv {
+		t.Fatalf("loaded %s", loaded)
+	}
+}
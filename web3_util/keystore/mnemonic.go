@@ -0,0 +1,154 @@
+package keystore
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/panyanyany/go-web3/wallet"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const hardened = 0x80000000
+
+// DefaultPath is the BIP-44 path of the first ethereum account, %d is the account index
+const DefaultPath = "m/44'/60'/0'/0/%d"
+
+// NewMnemonic makes a BIP-39 mnemonic of 12 words for 128 bits, 24 for 256
+func NewMnemonic(bits int) (mnemonic string, err error) {
+	entropy, err := bip39.NewEntropy(bits)
+	if err != nil {
+		err = fmt.Errorf("bip39.NewEntropy: %w", err)
+		return
+	}
+	defer zero(entropy)
+	return bip39.NewMnemonic(entropy)
+}
+
+// ParsePath reads a BIP-32 path such as m/44'/60'/0'/0/0
+func ParsePath(path string) (indexes []uint32, err error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if parts[0] != "m" {
+		err = fmt.Errorf("path %q must start with m", path)
+		return
+	}
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		var offset uint32
+		if strings.HasSuffix(p, "'") || strings.HasSuffix(p, "h") {
+			offset, p = hardened, p[:len(p)-1]
+		}
+		n, parseErr := strconv.ParseUint(p, 10, 31)
+		if parseErr != nil {
+			err = fmt.Errorf("bad path %q: %w", path, parseErr)
+			return
+		}
+		indexes = append(indexes, uint32(n)+offset)
+	}
+	return
+}
+
+// Derive returns the key at path of mnemonic, password is the optional BIP-39 passphrase
+func Derive(mnemonic, password, path string) (key *wallet.Key, err error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, password)
+	if err != nil {
+		err = fmt.Errorf("bip39.NewSeedWithErrorChecking: %w", err)
+		return
+	}
+	defer zero(seed)
+	return DeriveSeed(seed, path)
+}
+
+// DeriveSeed returns the key at path of a BIP-32 seed
+func DeriveSeed(seed []byte, path string) (key *wallet.Key, err error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return
+	}
+	priv, err := derivePrivate(seed, indexes)
+	if err != nil {
+		err = fmt.Errorf("derive %s: %w", path, err)
+		return
+	}
+	defer zero(priv)
+	key, err = wallet.NewWalletFromPrivKey(priv)
+	if err != nil {
+		err = fmt.Errorf("wallet.NewWalletFromPrivKey: %w", err)
+		return
+	}
+	return
+}
+
+var errInvalidChild = errors.New("invalid child key, use the next index")
+
+// derivePrivate follows BIP-32 private derivation. Keys are always 32 bytes:
+// hdkeychain of btcutil v1.0.2 drops their leading zeros and derives other hardened keys.
+func derivePrivate(seed []byte, indexes []uint32) (priv []byte, err error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+	defer zero(i)
+	priv, chain := make([]byte, 32), make([]byte, 32)
+	defer zero(chain)
+	copy(priv, i[:32])
+	copy(chain, i[32:])
+	n := btcec.S256().N
+	k := new(big.Int).SetBytes(priv)
+	defer k.SetInt64(0)
+	if k.Sign() == 0 || k.Cmp(n) >= 0 {
+		zero(priv)
+		return nil, errInvalidChild
+	}
+
+	data := make([]byte, 37)
+	defer zero(data)
+	for _, index := range indexes {
+		if index >= hardened {
+			data[0] = 0
+			copy(data[1:33], priv)
+		} else {
+			_, pub := btcec.PrivKeyFromBytes(btcec.S256(), priv)
+			copy(data[:33], pub.SerializeCompressed())
+		}
+		binary.BigEndian.PutUint32(data[33:], index)
+		mac = hmac.New(sha512.New, chain)
+		mac.Write(data)
+		i = mac.Sum(i[:0])
+		il := new(big.Int).SetBytes(i[:32])
+		if il.Cmp(n) >= 0 {
+			zero(priv)
+			return nil, errInvalidChild
+		}
+		k.SetBytes(priv)
+		k.Add(k, il).Mod(k, n)
+		il.SetInt64(0)
+		if k.Sign() == 0 {
+			zero(priv)
+			return nil, errInvalidChild
+		}
+		k.FillBytes(priv)
+		copy(chain, i[32:])
+	}
+	return
+}
+
+// DeriveAccounts returns the keys of DefaultPath from index from, count of them
+func DeriveAccounts(mnemonic, password string, from, count int) (keys []*wallet.Key, err error) {
+	for i := from; i < from+count; i++ {
+		key, deriveErr := Derive(mnemonic, password, fmt.Sprintf(DefaultPath, i))
+		if deriveErr != nil {
+			for _, k := range keys {
+				Wipe(k)
+			}
+			return nil, deriveErr
+		}
+		keys = append(keys, key)
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package keystore_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"goutil/web3_util/keystore"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+func TestDeriveSeed(t *testing.T) {
+	for _, c := range []struct {
+		seed, path, priv string
+	}{
+		// BIP-32 test vector 1
+		{"000102030405060708090a0b0c0d0e0f", "m/0'/1",
+			"3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		// BIP-32 test vector 4, the private key of m/0H has a leading zero
+		{"3ddd5602285899a946114506157c7997e5444528f3003f6134712147db19b678", "m/0'",
+			"00d948e9261e41362a688b916f297121ba6bfb2274a3575ac0e456551dfd7f7e"},
+		{"3ddd5602285899a946114506157c7997e5444528f3003f6134712147db19b678", "m/0'/1'",
+			"3a2086edd7d9df86c3487a5905a1712a9aa664bce8cc268141e07549eaa8661d"},
+	} {
+		seed, _ := hex.DecodeString(c.seed)
+		key, err := keystore.DeriveSeed(seed, c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, _ := hex.DecodeString(c.priv)
+		want, err := wallet.NewWalletFromPrivKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.Address() != want.Address() {
+			t.Errorf("DeriveSeed(%s, %s) = %s, want %s", c.seed, c.path, key.Address(), want.Address())
+		}
+	}
+}
+
+func TestDerive(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	key, err := keystore.Derive(mnemonic, "", "m/44'/60'/0'/0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := web3.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94"); key.Address() != want {
+		t.Fatalf("Derive() = %s, want %s", key.Address(), want)
+	}
+}
+
+func TestWipe(t *testing.T) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keystore.Wipe(key)
+	priv, err := key.MarshallPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range priv {
+		if b != 0 {
+			t.Fatalf("private key %x left after Wipe", priv)
+		}
+	}
+}
@@ -0,0 +1,594 @@
+package rpctest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+	"github.com/umbracle/fastrlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// SentTx is a raw transaction received through eth_sendRawTransaction
+type SentTx struct {
+	Raw     []byte
+	Tx      *web3.Transaction
+	ChainID uint64
+	// Block is the block the transaction was mined in
+	Block uint64
+	// Logs are the logs of its receipt, see SetReceiptLogs
+	Logs []*web3.Log
+	// Reverted gives the receipt status 0, see SetReverts
+	Reverted bool
+}
+
+// SetReceiptLogs makes fn give the logs of the receipt of every transaction sent
+func (s *Server) SetReceiptLogs(fn func(sent *SentTx) []*web3.Log) {
+	s.lock.Lock()
+	s.receiptLogs = fn
+	s.lock.Unlock()
+}
+
+// SetReverts makes the transactions for which fn is true revert, their receipt has status 0 and no logs
+func (s *Server) SetReverts(fn func(sent *SentTx) bool) {
+	s.lock.Lock()
+	s.reverts = fn
+	s.lock.Unlock()
+}
+
+// SetBlockNumber sets the head of the chain
+func (s *Server) SetBlockNumber(n uint64) {
+	s.lock.Lock()
+	s.head = n
+	s.lock.Unlock()
+}
+
+func (s *Server) BlockNumber() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.head
+}
+
+func (s *Server) SetBalance(addr web3.Address, balance *big.Int) {
+	s.lock.Lock()
+	s.balances[addr] = new(big.Int).Set(balance)
+	s.lock.Unlock()
+}
+
+func (s *Server) SetNonce(addr web3.Address, nonce uint64) {
+	s.lock.Lock()
+	s.nonces[addr] = nonce
+	s.lock.Unlock()
+}
+
+// SetStorage sets a storage slot returned by eth_getStorageAt
+func (s *Server) SetStorage(addr web3.Address, slot web3.Hash, value web3.Hash) {
+	s.lock.Lock()
+	if s.storage[addr] == nil {
+		s.storage[addr] = map[web3.Hash]web3.Hash{}
+	}
+	s.storage[addr][slot] = value
+	s.lock.Unlock()
+}
+
+// AddLog adds a log returned by eth_getLogs, a log without BlockHash gets the hash of its block
+func (s *Server) AddLog(log *web3.Log) {
+	s.lock.Lock()
+	if log.BlockHash == (web3.Hash{}) {
+		log.BlockHash = s.blockHash(log.BlockNumber)
+	}
+	s.logs = append(s.logs, log)
+	s.lock.Unlock()
+}
+
+// Reorg replaces the blocks from `from` on with another branch:
+// their hashes change and the logs added for them are dropped
+func (s *Server) Reorg(from uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.forks = append(s.forks, from)
+	logs := s.logs[:0]
+	for _, log := range s.logs {
+		if log.BlockNumber < from {
+			logs = append(logs, log)
+		}
+	}
+	s.logs = logs
+}
+
+// BlockHash is the hash of block n on the current branch
+func (s *Server) BlockHash(n uint64) web3.Hash {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.blockHash(n)
+}
+
+// Sent returns the transactions received, in order
+func (s *Server) Sent() []*SentTx {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*SentTx{}, s.sent...)
+}
+
+func keccak(b []byte) (h web3.Hash) {
+	k := sha3.NewLegacyKeccak256()
+	k.Write(b)
+	copy(h[:], k.Sum(nil))
+	return
+}
+
+// DecodeRawTransaction decodes a signed legacy transaction and recovers its sender
+func DecodeRawTransaction(raw []byte) (tx *web3.Transaction, chainID uint64, err error) {
+	p := &fastrlp.Parser{}
+	v, err := p.Parse(raw)
+	if err != nil {
+		err = fmt.Errorf("fastrlp.Parse: %w", err)
+		return
+	}
+	elems, err := v.GetElems()
+	if err != nil {
+		err = fmt.Errorf("v.GetElems: %w", err)
+		return
+	}
+	if len(elems) != 9 {
+		err = fmt.Errorf("expected 9 fields, got %d", len(elems))
+		return
+	}
+
+	tx = &web3.Transaction{Value: new(big.Int)}
+	if tx.Nonce, err = elems[0].GetUint64(); err != nil {
+		err = fmt.Errorf("nonce: %w", err)
+		return
+	}
+	if tx.GasPrice, err = elems[1].GetUint64(); err != nil {
+		err = fmt.Errorf("gasPrice: %w", err)
+		return
+	}
+	if tx.Gas, err = elems[2].GetUint64(); err != nil {
+		err = fmt.Errorf("gas: %w", err)
+		return
+	}
+	to, err := elems[3].Bytes()
+	if err != nil {
+		err = fmt.Errorf("to: %w", err)
+		return
+	}
+	if len(to) == 20 {
+		addr := web3.BytesToAddress(to)
+		tx.To = &addr
+	}
+	if err = elems[4].GetBigInt(tx.Value); err != nil {
+		err = fmt.Errorf("value: %w", err)
+		return
+	}
+	if tx.Input, err = elems[5].GetBytes(nil); err != nil {
+		err = fmt.Errorf("input: %w", err)
+		return
+	}
+	if tx.V, err = elems[6].GetBytes(nil); err != nil {
+		err = fmt.Errorf("v: %w", err)
+		return
+	}
+	if tx.R, err = elems[7].GetBytes(nil); err != nil {
+		err = fmt.Errorf("r: %w", err)
+		return
+	}
+	if tx.S, err = elems[8].GetBytes(nil); err != nil {
+		err = fmt.Errorf("s: %w", err)
+		return
+	}
+
+	vv := new(big.Int).SetBytes(tx.V).Uint64()
+	if vv < 35 {
+		err = fmt.Errorf("not an EIP-155 transaction, v=%d", vv)
+		return
+	}
+	chainID = (vv - 35) / 2
+	tx.From, err = wallet.NewEIP155Signer(chainID).RecoverSender(tx)
+	if err != nil {
+		err = fmt.Errorf("RecoverSender: %w", err)
+		return
+	}
+	tx.Hash = keccak(raw)
+	return
+}
+
+func (s *Server) builtin(method string) (Handler, bool) {
+	h, ok := map[string]Handler{
+		"eth_chainId":               s.chainID,
+		"net_version":               s.netVersion,
+		"eth_blockNumber":           s.blockNumber,
+		"eth_gasPrice":              s.gasPrice,
+		"eth_estimateGas":           s.estimateGas,
+		"eth_getBalance":            s.getBalance,
+		"eth_getTransactionCount":   s.getTransactionCount,
+		"eth_getCode":               s.getCode,
+		"eth_getStorageAt":          s.getStorageAt,
+		"eth_call":                  s.call,
+		"eth_sendRawTransaction":    s.sendRawTransaction,
+		"eth_getTransactionReceipt": s.getTransactionReceipt,
+		"eth_getTransactionByHash":  s.getTransactionByHash,
+		"eth_getBlockByNumber":      s.getBlockByNumber,
+		"eth_getLogs":               s.getLogs,
+	}[method]
+	return h, ok
+}
+
+func hexUint(n uint64) string {
+	return fmt.Sprintf("0x%x", n)
+}
+
+func parseHexUint(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+func param(params []json.RawMessage, i int, out interface{}) error {
+	if i >= len(params) {
+		return fmt.Errorf("missing param %d", i)
+	}
+	if err := json.Unmarshal(params[i], out); err != nil {
+		return fmt.Errorf("param %d: %w", i, err)
+	}
+	return nil
+}
+
+func (s *Server) chainID(params []json.RawMessage) (interface{}, error) {
+	return hexUint(s.ChainID), nil
+}
+
+func (s *Server) netVersion(params []json.RawMessage) (interface{}, error) {
+	return strconv.FormatUint(s.ChainID, 10), nil
+}
+
+func (s *Server) blockNumber(params []json.RawMessage) (interface{}, error) {
+	return hexUint(s.BlockNumber()), nil
+}
+
+func (s *Server) gasPrice(params []json.RawMessage) (interface{}, error) {
+	return hexUint(s.GasPrice), nil
+}
+
+func (s *Server) estimateGas(params []json.RawMessage) (interface{}, error) {
+	// a reverting call cannot be estimated
+	if _, err := s.call(params); err != nil {
+		return nil, err
+	}
+	return hexUint(s.GasLimit), nil
+}
+
+func (s *Server) getBalance(params []json.RawMessage) (interface{}, error) {
+	var addr web3.Address
+	if err := param(params, 0, &addr); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	balance := s.balances[addr]
+	if balance == nil {
+		balance = new(big.Int)
+	}
+	return fmt.Sprintf("0x%x", balance), nil
+}
+
+func (s *Server) getTransactionCount(params []json.RawMessage) (interface{}, error) {
+	var addr web3.Address
+	if err := param(params, 0, &addr); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return hexUint(s.nonces[addr]), nil
+}
+
+func (s *Server) getCode(params []json.RawMessage) (interface{}, error) {
+	var addr web3.Address
+	if err := param(params, 0, &addr); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if mock, ok := s.mocks[addr]; ok {
+		return "0x" + hex.EncodeToString(mock.Code), nil
+	}
+	return "0x", nil
+}
+
+func (s *Server) getStorageAt(params []json.RawMessage) (interface{}, error) {
+	var addr web3.Address
+	if err := param(params, 0, &addr); err != nil {
+		return nil, err
+	}
+	var slot string
+	if err := param(params, 1, &slot); err != nil {
+		return nil, err
+	}
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(slot, "0x"), 16)
+	if !ok || n.BitLen() > 256 {
+		return nil, fmt.Errorf("bad slot %s", slot)
+	}
+	var key web3.Hash
+	n.FillBytes(key[:])
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.storage[addr][key].String(), nil
+}
+
+func (s *Server) sendRawTransaction(params []json.RawMessage) (interface{}, error) {
+	var data string
+	if err := param(params, 0, &data); err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("hex.DecodeString: %w", err)
+	}
+	tx, chainID, err := DecodeRawTransaction(raw)
+	if err != nil {
+		return nil, err
+	}
+	if chainID != s.ChainID {
+		return nil, fmt.Errorf("invalid chain id %d, expected %d", chainID, s.ChainID)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if tx.Nonce < s.nonces[tx.From] {
+		return nil, fmt.Errorf("nonce too low")
+	}
+	// every transaction is mined at once in a block of its own
+	s.nonces[tx.From] = tx.Nonce + 1
+	s.head++
+	tx.BlockNumber = s.head
+	tx.BlockHash = s.blockHash(s.head)
+	sent := &SentTx{Raw: raw, Tx: tx, ChainID: chainID, Block: s.head}
+	sent.Reverted = s.reverts != nil && s.reverts(sent)
+	if s.receiptLogs != nil && !sent.Reverted {
+		for i, log := range s.receiptLogs(sent) {
+			log.LogIndex = uint64(i)
+			log.TransactionHash = tx.Hash
+			log.BlockNumber = tx.BlockNumber
+			log.BlockHash = tx.BlockHash
+			sent.Logs = append(sent.Logs, log)
+		}
+	}
+	s.sent = append(s.sent, sent)
+	s.receipts[tx.Hash] = sent
+	return tx.Hash, nil
+}
+
+func (s *Server) getTransactionReceipt(params []json.RawMessage) (interface{}, error) {
+	var hash web3.Hash
+	if err := param(params, 0, &hash); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	sent, ok := s.receipts[hash]
+	s.lock.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	status := "0x1"
+	if sent.Reverted {
+		status = "0x0"
+	}
+	receipt := map[string]interface{}{
+		"transactionHash":   sent.Tx.Hash,
+		"transactionIndex":  "0x0",
+		"blockHash":         sent.Tx.BlockHash,
+		"blockNumber":       hexUint(sent.Block),
+		"from":              sent.Tx.From,
+		"to":                sent.Tx.To,
+		"gasUsed":           hexUint(sent.Tx.Gas),
+		"cumulativeGasUsed": hexUint(sent.Tx.Gas),
+		"contractAddress":   nil,
+		"logsBloom":         "0x" + strings.Repeat("00", 256),
+		"logs":              append([]*web3.Log{}, sent.Logs...),
+		"status":            status,
+	}
+	return receipt, nil
+}
+
+func (s *Server) getTransactionByHash(params []json.RawMessage) (interface{}, error) {
+	var hash web3.Hash
+	if err := param(params, 0, &hash); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	sent, ok := s.receipts[hash]
+	s.lock.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	// not web3.Transaction's MarshalJSON, it drops an empty input and sends r as s
+	tx := map[string]interface{}{
+		"hash":             sent.Tx.Hash,
+		"from":             sent.Tx.From,
+		"to":               sent.Tx.To,
+		"nonce":            hexUint(sent.Tx.Nonce),
+		"gas":              hexUint(sent.Tx.Gas),
+		"gasPrice":         hexUint(sent.Tx.GasPrice),
+		"value":            fmt.Sprintf("0x%x", sent.Tx.Value),
+		"input":            "0x" + hex.EncodeToString(sent.Tx.Input),
+		"v":                "0x" + hex.EncodeToString(sent.Tx.V),
+		"r":                "0x" + hex.EncodeToString(sent.Tx.R),
+		"s":                "0x" + hex.EncodeToString(sent.Tx.S),
+		"blockHash":        sent.Tx.BlockHash,
+		"blockNumber":      hexUint(sent.Block),
+		"transactionIndex": "0x0",
+	}
+	return tx, nil
+}
+
+func (s *Server) blockHash(n uint64) web3.Hash {
+	fork := 0
+	for _, from := range s.forks {
+		if n >= from {
+			fork++
+		}
+	}
+	if fork == 0 {
+		return keccak([]byte(fmt.Sprintf("block-%d", n)))
+	}
+	return keccak([]byte(fmt.Sprintf("block-%d-%d", n, fork)))
+}
+
+func (s *Server) getBlockByNumber(params []json.RawMessage) (interface{}, error) {
+	var tag string
+	if err := param(params, 0, &tag); err != nil {
+		return nil, err
+	}
+	head := s.BlockNumber()
+	n := head
+	switch tag {
+	case "latest", "pending", "":
+	case "earliest":
+		n = 0
+	default:
+		var err error
+		if n, err = parseHexUint(tag); err != nil {
+			return nil, err
+		}
+	}
+	if n > head {
+		return nil, nil
+	}
+
+	var txs []*web3.Transaction
+	s.lock.Lock()
+	hash, parentHash := s.blockHash(n), s.blockHash(n-1)
+	for _, sent := range s.sent {
+		if sent.Block == n {
+			txs = append(txs, sent.Tx)
+		}
+	}
+	s.lock.Unlock()
+
+	block := &web3.Block{
+		Number:     n,
+		Hash:       hash,
+		ParentHash: parentHash,
+		GasLimit:   30000000,
+		Timestamp:  1600000000 + n*3,
+		Difficulty: big.NewInt(2),
+	}
+	var full bool
+	param(params, 1, &full)
+	for _, tx := range txs {
+		if full {
+			block.Transactions = append(block.Transactions, tx)
+		} else {
+			block.TransactionsHashes = append(block.TransactionsHashes, tx.Hash)
+		}
+	}
+	return block, nil
+}
+
+type logQuery struct {
+	FromBlock string            `json:"fromBlock"`
+	ToBlock   string            `json:"toBlock"`
+	BlockHash *web3.Hash        `json:"blockHash"`
+	Address   json.RawMessage   `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+}
+
+// oneOrMany decodes a json value holding one item or a list of them
+func oneOrMany(raw json.RawMessage, out interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if raw[0] != '[' {
+		raw = append(append([]byte{'['}, raw...), ']')
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func (s *Server) getLogs(params []json.RawMessage) (interface{}, error) {
+	var q logQuery
+	if err := param(params, 0, &q); err != nil {
+		return nil, err
+	}
+	head := s.BlockNumber()
+	blockOf := func(tag string, def uint64) (uint64, error) {
+		switch tag {
+		case "", "latest", "pending":
+			return def, nil
+		case "earliest":
+			return 0, nil
+		}
+		return parseHexUint(tag)
+	}
+	from, err := blockOf(q.FromBlock, head)
+	if err != nil {
+		return nil, err
+	}
+	to, err := blockOf(q.ToBlock, head)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []web3.Address
+	if err = oneOrMany(q.Address, &addrs); err != nil {
+		return nil, fmt.Errorf("address: %w", err)
+	}
+	topics := make([][]web3.Hash, len(q.Topics))
+	for i, raw := range q.Topics {
+		if err = oneOrMany(raw, &topics[i]); err != nil {
+			return nil, fmt.Errorf("topics[%d]: %w", i, err)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	logs := []*web3.Log{}
+	for _, log := range s.logs {
+		if q.BlockHash != nil {
+			if log.BlockHash != *q.BlockHash {
+				continue
+			}
+		} else if log.BlockNumber < from || log.BlockNumber > to {
+			continue
+		}
+		if len(addrs) > 0 && !containsAddress(addrs, log.Address) {
+			continue
+		}
+		if matchTopics(topics, log.Topics) {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func containsAddress(addrs []web3.Address, addr web3.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTopics(filter [][]web3.Hash, topics []web3.Hash) bool {
+	for i, set := range filter {
+		if len(set) == 0 {
+			continue
+		}
+		if i >= len(topics) {
+			return false
+		}
+		found := false
+		for _, h := range set {
+			if h == topics[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package rpctest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/abi"
+	"github.com/panyanyany/go-web3/jsonrpc/codec"
+)
+
+// Call is an eth_call to a mocked contract, with its arguments decoded
+type Call struct {
+	From   web3.Address
+	To     web3.Address
+	Value  *big.Int
+	Block  string
+	Method *abi.Method
+	Args   map[string]interface{}
+}
+
+// MethodFunc answers a call with the method outputs in order, or with an error,
+// use Revert for a revert with a reason
+type MethodFunc func(call *Call) ([]interface{}, error)
+
+// RevertError makes a mocked method revert with Reason
+type RevertError struct {
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	return "execution reverted: " + e.Reason
+}
+
+func Revert(reason string) error {
+	return &RevertError{Reason: reason}
+}
+
+// ContractMock answers eth_call to one address through its ABI
+type ContractMock struct {
+	Address web3.Address
+	Abi     *abi.ABI
+	// Code is returned by eth_getCode
+	Code []byte
+
+	lock    sync.Mutex
+	methods map[string]MethodFunc
+}
+
+// Mock registers a contract answering eth_call to addr,
+// the mock already registered for addr is returned with its ABI replaced
+func (s *Server) Mock(addr web3.Address, a *abi.ABI) *ContractMock {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if m, ok := s.mocks[addr]; ok {
+		m.lock.Lock()
+		m.Abi = a
+		m.lock.Unlock()
+		return m
+	}
+	m := &ContractMock{Address: addr, Abi: a, Code: []byte{0x60, 0x80}, methods: map[string]MethodFunc{}}
+	s.mocks[addr] = m
+	return m
+}
+
+// On answers method with fn
+func (m *ContractMock) On(method string, fn MethodFunc) *ContractMock {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.Abi.Methods[method]; !ok {
+		panic(fmt.Errorf("method %s not found in abi", method))
+	}
+	m.methods[method] = fn
+	return m
+}
+
+// Return answers method with fixed outputs
+func (m *ContractMock) Return(method string, outs ...interface{}) *ContractMock {
+	return m.On(method, func(call *Call) ([]interface{}, error) {
+		return outs, nil
+	})
+}
+
+// Revert makes method revert with reason
+func (m *ContractMock) Revert(method string, reason string) *ContractMock {
+	return m.On(method, func(call *Call) ([]interface{}, error) {
+		return nil, Revert(reason)
+	})
+}
+
+type callMsg struct {
+	From  web3.Address  `json:"from"`
+	To    *web3.Address `json:"to"`
+	Data  string        `json:"data"`
+	Input string        `json:"input"`
+	Value string        `json:"value"`
+}
+
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// revertData encodes reason as Error(string)
+func revertData(reason string) string {
+	data, err := abi.Encode([]interface{}{reason}, abi.MustNewType("tuple(string reason)"))
+	if err != nil {
+		panic(err)
+	}
+	return "0x" + hex.EncodeToString(append(append([]byte{}, revertSelector...), data...))
+}
+
+func (s *Server) call(params []json.RawMessage) (interface{}, error) {
+	var msg callMsg
+	if err := param(params, 0, &msg); err != nil {
+		return nil, err
+	}
+	if msg.To == nil {
+		return "0x", nil
+	}
+	var block string
+	param(params, 1, &block)
+
+	s.lock.Lock()
+	mock, ok := s.mocks[*msg.To]
+	s.lock.Unlock()
+	if !ok {
+		// like a node, a call to an address without code returns nothing
+		return "0x", nil
+	}
+
+	data := msg.Data
+	if data == "" {
+		data = msg.Input
+	}
+	input, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("hex.DecodeString: %w", err)
+	}
+	return mock.call(&msg, block, input)
+}
+
+func (m *ContractMock) call(msg *callMsg, block string, input []byte) (interface{}, error) {
+	if len(input) < 4 {
+		return nil, &codec.ErrorObject{Code: 3, Message: "execution reverted"}
+	}
+	m.lock.Lock()
+	methods := m.Abi.Methods
+	m.lock.Unlock()
+	var method *abi.Method
+	for _, candidate := range methods {
+		if bytes.Equal(candidate.ID(), input[:4]) {
+			method = candidate
+			break
+		}
+	}
+	if method == nil {
+		return nil, &codec.ErrorObject{Code: 3, Message: "execution reverted"}
+	}
+	m.lock.Lock()
+	fn, ok := m.methods[method.Name]
+	m.lock.Unlock()
+	if !ok {
+		return nil, &codec.ErrorObject{Code: 3, Message: fmt.Sprintf("execution reverted: %s not mocked", method.Name)}
+	}
+
+	call := &Call{From: msg.From, To: m.Address, Block: block, Method: method, Args: map[string]interface{}{}, Value: new(big.Int)}
+	if msg.Value != "" {
+		call.Value.SetString(strings.TrimPrefix(msg.Value, "0x"), 16)
+	}
+	if len(method.Inputs.TupleElems()) > 0 {
+		args, err := abi.Decode(method.Inputs, input[4:])
+		if err != nil {
+			return nil, &codec.ErrorObject{Code: 3, Message: fmt.Sprintf("execution reverted: bad input: %v", err)}
+		}
+		call.Args = args.(map[string]interface{})
+	}
+
+	outs, err := fn(call)
+	if err != nil {
+		if revert, ok := err.(*RevertError); ok {
+			return nil, &codec.ErrorObject{Code: 3, Message: revert.Error(), Data: revertData(revert.Reason)}
+		}
+		return nil, err
+	}
+	if len(method.Outputs.TupleElems()) == 0 {
+		return "0x", nil
+	}
+	out, err := abi.Encode(outs, method.Outputs)
+	if err != nil {
+		return nil, fmt.Errorf("abi.Encode(%s outputs): %w", method.Name, err)
+	}
+	return "0x" + hex.EncodeToString(out), nil
+}
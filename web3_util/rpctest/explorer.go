@@ -0,0 +1,69 @@
+package rpctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/panyanyany/go-web3"
+)
+
+// Explorer is an in-process stand-in for the Etherscan/BscScan api,
+// it answers module=contract&action=getabi from the ABIs set with SetAbi
+type Explorer struct {
+	*httptest.Server
+
+	// ApiKey, when set, must be sent as apikey
+	ApiKey string
+
+	lock     sync.Mutex
+	abis     map[web3.Address]string
+	requests int
+}
+
+type explorerResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Result  string `json:"result"`
+}
+
+func NewExplorer() *Explorer {
+	e := &Explorer{abis: map[web3.Address]string{}}
+	e.Server = httptest.NewServer(http.HandlerFunc(e.serveHTTP))
+	return e
+}
+
+// SetAbi makes addr a verified contract with the json abi
+func (e *Explorer) SetAbi(addr web3.Address, abi string) {
+	e.lock.Lock()
+	e.abis[addr] = abi
+	e.lock.Unlock()
+}
+
+// Count returns how many requests were received
+func (e *Explorer) Count() int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.requests
+}
+
+func (e *Explorer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	e.lock.Lock()
+	e.requests++
+	abi, ok := e.abis[web3.HexToAddress(q.Get("address"))]
+	e.lock.Unlock()
+
+	res := &explorerResponse{Status: "1", Message: "OK", Result: abi}
+	switch {
+	case q.Get("module") != "contract" || q.Get("action") != "getabi":
+		res = &explorerResponse{Status: "0", Message: "NOTOK", Result: "Error! Missing Or invalid Module name"}
+	case e.ApiKey != "" && q.Get("apikey") != e.ApiKey:
+		res = &explorerResponse{Status: "0", Message: "NOTOK", Result: "Invalid API Key"}
+	case !ok:
+		res = &explorerResponse{Status: "0", Message: "NOTOK", Result: "Contract source code not verified"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,344 @@
+package rpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"goutil/web3_util/cclient"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/jsonrpc/codec"
+)
+
+// Server is an in-process json-rpc node for tests, its URL goes to cclient.New or jsonrpc.NewClient.
+// Requests are answered by, in order: injected faults, canned responses, handlers
+// registered with Handle and the built-in methods of a minimal chain.
+type Server struct {
+	*httptest.Server
+
+	ChainID  uint64
+	GasPrice uint64
+	GasLimit uint64
+
+	lock     sync.Mutex
+	head     uint64
+	posts    int
+	requests []*Request
+	canned   []*canned
+	handlers map[string]Handler
+	faults   []*Fault
+	latency  map[string]time.Duration
+	mocks    map[web3.Address]*ContractMock
+	balances map[web3.Address]*big.Int
+	nonces   map[web3.Address]uint64
+	storage  map[web3.Address]map[web3.Hash]web3.Hash
+	sent     []*SentTx
+	receipts map[web3.Hash]*SentTx
+	logs     []*web3.Log
+	forks    []uint64
+
+	receiptLogs func(sent *SentTx) []*web3.Log
+	reverts     func(sent *SentTx) bool
+}
+
+// Request is a request the server received
+type Request struct {
+	Method string
+	Params []json.RawMessage
+}
+
+// Handler answers a method, an error that is not a *codec.ErrorObject is sent with code -32000
+type Handler func(params []json.RawMessage) (interface{}, error)
+
+type canned struct {
+	method string
+	params []byte
+	result interface{}
+	err    *codec.ErrorObject
+}
+
+// Fault is an injected failure, Times is how many requests it applies to, 0 meaning forever
+type Fault struct {
+	Method string
+	Times  int
+	// Err is sent as json-rpc error, or Status as http status when set
+	Err    *codec.ErrorObject
+	Status int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		ChainID:  56,
+		GasPrice: 5000000000,
+		GasLimit: 200000,
+		head:     1,
+		handlers: map[string]Handler{},
+		latency:  map[string]time.Duration{},
+		mocks:    map[web3.Address]*ContractMock{},
+		balances: map[web3.Address]*big.Int{},
+		nonces:   map[web3.Address]uint64{},
+		storage:  map[web3.Address]map[web3.Hash]web3.Hash{},
+		receipts: map[web3.Hash]*SentTx{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// CClient returns a CClient using the server without rate limit
+func (s *Server) CClient() *cclient.CClient {
+	r, err := cclient.NewWithOptions(&cclient.Options{
+		Read: []*cclient.EndpointConfig{{Url: s.URL}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Handle answers method with h
+func (s *Server) Handle(method string, h Handler) {
+	s.lock.Lock()
+	s.handlers[method] = h
+	s.lock.Unlock()
+}
+
+// Respond answers method with result, only when the request params equal params if any are given.
+// A later registration wins over an earlier one.
+func (s *Server) Respond(method string, result interface{}, params ...interface{}) {
+	s.addCanned(&canned{method: method, params: s.marshalParams(params), result: result})
+}
+
+// RespondError answers method with a json-rpc error, see Respond for params
+func (s *Server) RespondError(method string, code int, message string, params ...interface{}) {
+	s.addCanned(&canned{method: method, params: s.marshalParams(params), err: &codec.ErrorObject{Code: code, Message: message}})
+}
+
+func (s *Server) marshalParams(params []interface{}) []byte {
+	if len(params) == 0 {
+		return nil
+	}
+	bs, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	return normalize(bs)
+}
+
+func (s *Server) addCanned(c *canned) {
+	s.lock.Lock()
+	s.canned = append(s.canned, c)
+	s.lock.Unlock()
+}
+
+// Fail makes the next times requests of method fail with a json-rpc error,
+// an empty method matches all of them
+func (s *Server) Fail(method string, times int, code int, message string) {
+	s.AddFault(&Fault{Method: method, Times: times, Err: &codec.ErrorObject{Code: code, Message: message}})
+}
+
+// FailHTTP makes the next times requests of method answer with an http status
+func (s *Server) FailHTTP(method string, times int, status int) {
+	s.AddFault(&Fault{Method: method, Times: times, Status: status})
+}
+
+func (s *Server) AddFault(f *Fault) {
+	s.lock.Lock()
+	s.faults = append(s.faults, f)
+	s.lock.Unlock()
+}
+
+// SetLatency delays the answers to method, an empty method delays every request
+func (s *Server) SetLatency(method string, d time.Duration) {
+	s.lock.Lock()
+	s.latency[method] = d
+	s.lock.Unlock()
+}
+
+// Reset forgets canned responses, faults, latencies and recorded requests
+func (s *Server) Reset() {
+	s.lock.Lock()
+	s.canned = nil
+	s.faults = nil
+	s.latency = map[string]time.Duration{}
+	s.requests = nil
+	s.posts = 0
+	s.lock.Unlock()
+}
+
+// Requests returns the received requests of method, all of them when method is empty
+func (s *Server) Requests(method string) (reqs []*Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, req := range s.requests {
+		if method == "" || req.Method == method {
+			reqs = append(reqs, req)
+		}
+	}
+	return
+}
+
+// Count returns how many requests of method were received
+func (s *Server) Count(method string) int {
+	return len(s.Requests(method))
+}
+
+// Posts returns how many http requests were received, a batch counting once
+func (s *Server) Posts() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.posts
+}
+
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JsonRPC string             `json:"jsonrpc"`
+	ID      json.RawMessage    `json:"id"`
+	Result  interface{}        `json:"result,omitempty"`
+	Error   *codec.ErrorObject `json:"error,omitempty"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var reqs []*rpcRequest
+	batch := len(bytes.TrimSpace(body)) > 0 && bytes.TrimSpace(body)[0] == '['
+	if batch {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		req := new(rpcRequest)
+		err = json.Unmarshal(body, req)
+		reqs = []*rpcRequest{req}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var delay time.Duration
+	status := 0
+	s.lock.Lock()
+	s.posts++
+	for _, req := range reqs {
+		s.requests = append(s.requests, &Request{Method: req.Method, Params: req.Params})
+		if d := s.latency[req.Method] + s.latency[""]; d > delay {
+			delay = d
+		}
+		if f := s.takeFault(req.Method, true); f != nil {
+			status = f.Status
+		}
+	}
+	s.lock.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	responses := make([]*rpcResponse, len(reqs))
+	for i, req := range reqs {
+		res := &rpcResponse{JsonRPC: "2.0", ID: req.ID}
+		res.Result, res.Error = s.dispatch(req)
+		if res.Error == nil && res.Result == nil {
+			res.Result = json.RawMessage("null")
+		}
+		responses[i] = res
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+	} else {
+		json.NewEncoder(w).Encode(responses[0])
+	}
+}
+
+// takeFault returns the first fault matching method, httpOnly selects http status faults.
+// s.lock must be held.
+func (s *Server) takeFault(method string, httpOnly bool) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		if (f.Status != 0) != httpOnly {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) dispatch(req *rpcRequest) (result interface{}, rpcErr *codec.ErrorObject) {
+	s.lock.Lock()
+	if f := s.takeFault(req.Method, false); f != nil {
+		s.lock.Unlock()
+		return nil, f.Err
+	}
+	var params []byte
+	if len(req.Params) > 0 {
+		bs, _ := json.Marshal(req.Params)
+		params = normalize(bs)
+	}
+	for i := len(s.canned) - 1; i >= 0; i-- {
+		c := s.canned[i]
+		if c.method == req.Method && (c.params == nil || bytes.Equal(c.params, params)) {
+			s.lock.Unlock()
+			return c.result, c.err
+		}
+	}
+	h, ok := s.handlers[req.Method]
+	s.lock.Unlock()
+
+	if !ok {
+		h, ok = s.builtin(req.Method)
+	}
+	if !ok {
+		return nil, &codec.ErrorObject{Code: -32601, Message: fmt.Sprintf("the method %s does not exist/is not available", req.Method)}
+	}
+	result, err := h(req.Params)
+	if err != nil {
+		if e, ok := err.(*codec.ErrorObject); ok {
+			return nil, e
+		}
+		return nil, &codec.ErrorObject{Code: -32000, Message: err.Error()}
+	}
+	return result, nil
+}
+
+// normalize re-encodes json so that equal values compare equal
+func normalize(bs []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return bs
+	}
+	out, _ := json.Marshal(v)
+	return bytes.ToLower(out)
+}
@@ -0,0 +1,161 @@
+package signer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3"
+)
+
+// ErrPolicy is wrapped by the errors of a PolicySigner refusing to sign
+var ErrPolicy = errors.New("denied by policy")
+
+// Policy limits what a PolicySigner signs, empty lists and nil limits allow anything
+type Policy struct {
+	AllowedTo        []web3.Address
+	AllowedSelectors [][]byte
+	// MaxValue is the most value of one transaction
+	MaxValue *big.Int
+	// MaxDailyValue is the most value of all the transactions signed in a UTC day
+	MaxDailyValue *big.Int
+	AllowDeploy   bool
+	// AllowMessages lets SignMessage and SignTypedData through
+	AllowMessages bool
+}
+
+func (p *Policy) AllowTo(addrs ...web3.Address) *Policy {
+	p.AllowedTo = append(p.AllowedTo, addrs...)
+	return p
+}
+
+// AllowSelectors allows 4 byte method ids, such as abi.Method.ID()
+func (p *Policy) AllowSelectors(ids ...[]byte) *Policy {
+	p.AllowedSelectors = append(p.AllowedSelectors, ids...)
+	return p
+}
+
+func (p *Policy) SetMaxValue(v *big.Int) *Policy {
+	p.MaxValue = v
+	return p
+}
+
+func (p *Policy) SetMaxDailyValue(v *big.Int) *Policy {
+	p.MaxDailyValue = v
+	return p
+}
+
+// check returns why tx is denied, without the daily limit
+func (p *Policy) check(tx *web3.Transaction) error {
+	if tx.To == nil {
+		if !p.AllowDeploy {
+			return fmt.Errorf("contract creation: %w", ErrPolicy)
+		}
+	} else if len(p.AllowedTo) > 0 {
+		allowed := false
+		for _, to := range p.AllowedTo {
+			allowed = allowed || to == *tx.To
+		}
+		if !allowed {
+			return fmt.Errorf("to %s: %w", tx.To, ErrPolicy)
+		}
+	}
+	if len(p.AllowedSelectors) > 0 && len(tx.Input) > 0 {
+		if len(tx.Input) < 4 {
+			return fmt.Errorf("input shorter than a selector: %w", ErrPolicy)
+		}
+		allowed := false
+		for _, id := range p.AllowedSelectors {
+			allowed = allowed || bytes.Equal(id, tx.Input[:4])
+		}
+		if !allowed {
+			return fmt.Errorf("selector 0x%x: %w", tx.Input[:4], ErrPolicy)
+		}
+	}
+	if p.MaxValue != nil && tx.Value != nil && tx.Value.Cmp(p.MaxValue) > 0 {
+		return fmt.Errorf("value %s over %s: %w", tx.Value, p.MaxValue, ErrPolicy)
+	}
+	return nil
+}
+
+// PolicySigner signs with Signer what Policy allows
+type PolicySigner struct {
+	Signer Signer
+	Policy *Policy
+	// Now tells the day of the daily limit, time.Now by default
+	Now func() time.Time
+
+	lock  sync.Mutex
+	day   string
+	spent *big.Int
+}
+
+func NewPolicySigner(s Signer, p *Policy) *PolicySigner {
+	return &PolicySigner{Signer: s, Policy: p, Now: time.Now, spent: new(big.Int)}
+}
+
+func (p *PolicySigner) Address() web3.Address {
+	return p.Signer.Address()
+}
+
+// Spent is the value signed today
+func (p *PolicySigner) Spent() *big.Int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.rollDay()
+	return new(big.Int).Set(p.spent)
+}
+
+func (p *PolicySigner) rollDay() {
+	day := p.Now().UTC().Format("2006-01-02")
+	if day != p.day {
+		p.day = day
+		p.spent = new(big.Int)
+	}
+}
+
+// SignTx signs tx when the policy allows it, its value counts toward the daily limit once signed
+func (p *PolicySigner) SignTx(tx *web3.Transaction, chainID uint64) (signed *web3.Transaction, err error) {
+	if err = p.Policy.check(tx); err != nil {
+		seelog.Warnf("signer: refused tx of %s: %v", p.Address(), err)
+		return
+	}
+	value := new(big.Int)
+	if tx.Value != nil {
+		value.Set(tx.Value)
+	}
+
+	// the lock is held while signing so concurrent transactions can not pass the daily limit together
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.rollDay()
+	total := new(big.Int).Add(p.spent, value)
+	if p.Policy.MaxDailyValue != nil && total.Cmp(p.Policy.MaxDailyValue) > 0 {
+		err = fmt.Errorf("daily value %s over %s: %w", total, p.Policy.MaxDailyValue, ErrPolicy)
+		seelog.Warnf("signer: refused tx of %s: %v", p.Address(), err)
+		return
+	}
+	if signed, err = p.Signer.SignTx(tx, chainID); err != nil {
+		return
+	}
+	p.spent = total
+	return
+}
+
+func (p *PolicySigner) SignMessage(msg []byte) ([]byte, error) {
+	if !p.Policy.AllowMessages {
+		return nil, fmt.Errorf("message: %w", ErrPolicy)
+	}
+	return p.Signer.SignMessage(msg)
+}
+
+func (p *PolicySigner) SignTypedData(domainSeparator, structHash web3.Hash) ([]byte, error) {
+	if !p.Policy.AllowMessages {
+		return nil, fmt.Errorf("typed data: %w", ErrPolicy)
+	}
+	return p.Signer.SignTypedData(domainSeparator, structHash)
+}
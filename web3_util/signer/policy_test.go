@@ -0,0 +1,145 @@
+package signer_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+var (
+	router    = web3.HexToAddress("0x00000000000000000000000000000000000000f1")
+	stranger  = web3.HexToAddress("0x00000000000000000000000000000000000000f2")
+	swapID    = []byte{0x38, 0xed, 0x17, 0x39}
+	approveID = []byte{0x09, 0x5e, 0xa7, 0xb3}
+)
+
+// flaky fails SignTx while Fail is set
+type flaky struct {
+	signer.Signer
+	Fail bool
+}
+
+func (f *flaky) SignTx(tx *web3.Transaction, chainID uint64) (*web3.Transaction, error) {
+	if f.Fail {
+		return nil, errors.New("hsm unavailable")
+	}
+	return f.Signer.SignTx(tx, chainID)
+}
+
+func newPolicySigner(t *testing.T) (*signer.PolicySigner, *flaky, *time.Time) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &flaky{Signer: signer.NewLocal(key)}
+	policy := (&signer.Policy{}).
+		AllowTo(router).
+		AllowSelectors(swapID).
+		SetMaxValue(big.NewInt(100)).
+		SetMaxDailyValue(big.NewInt(250))
+	p := signer.NewPolicySigner(inner, policy)
+	now := time.Date(2021, 11, 14, 23, 0, 0, 0, time.UTC)
+	p.Now = func() time.Time { return now }
+	return p, inner, &now
+}
+
+func policyTx(to *web3.Address, input []byte, value int64) *web3.Transaction {
+	return &web3.Transaction{To: to, Input: input, Value: big.NewInt(value), Gas: 21000, GasPrice: 5e9}
+}
+
+func TestPolicyDenials(t *testing.T) {
+	p, _, _ := newPolicySigner(t)
+	for _, c := range []struct {
+		name string
+		tx   *web3.Transaction
+	}{
+		{"to not allowed", policyTx(&stranger, swapID, 1)},
+		{"contract creation", policyTx(nil, []byte{0x60, 0x80}, 0)},
+		{"selector not allowed", policyTx(&router, append(approveID, 0), 0)},
+		{"input shorter than a selector", policyTx(&router, []byte{0x38}, 0)},
+		{"value over the max of a tx", policyTx(&router, swapID, 101)},
+	} {
+		if signed, err := p.SignTx(c.tx, 56); !errors.Is(err, signer.ErrPolicy) || signed != nil {
+			t.Errorf("%s: SignTx() = %v, want ErrPolicy", c.name, err)
+		}
+	}
+	if p.Spent().Sign() != 0 {
+		t.Fatalf("spent %s on refused transactions", p.Spent())
+	}
+
+	// plain transfers have no selector to check
+	for _, tx := range []*web3.Transaction{policyTx(&router, swapID, 100), policyTx(&router, nil, 0)} {
+		if _, err := p.SignTx(tx, 56); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := p.SignMessage([]byte("hello")); !errors.Is(err, signer.ErrPolicy) {
+		t.Fatalf("SignMessage() = %v, want ErrPolicy", err)
+	}
+	if _, err := p.SignTypedData(web3.Hash{}, web3.Hash{}); !errors.Is(err, signer.ErrPolicy) {
+		t.Fatalf("SignTypedData() = %v, want ErrPolicy", err)
+	}
+	p.Policy.AllowMessages = true
+	if _, err := p.SignMessage([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicyDailyLimit(t *testing.T) {
+	p, inner, now := newPolicySigner(t)
+	sign := func(value int64) error {
+		_, err := p.SignTx(policyTx(&router, swapID, value), 56)
+		return err
+	}
+
+	for _, v := range []int64{100, 100} {
+		if err := sign(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sign(51); !errors.Is(err, signer.ErrPolicy) {
+		t.Fatalf("over the daily limit: %v, want ErrPolicy", err)
+	}
+	if p.Spent().Int64() != 200 {
+		t.Fatalf("spent %s, want 200", p.Spent())
+	}
+
+	// a transaction that was not signed does not count
+	inner.Fail = true
+	if err := sign(50); err == nil || errors.Is(err, signer.ErrPolicy) {
+		t.Fatalf("failed inner sign: %v", err)
+	}
+	inner.Fail = false
+	if p.Spent().Int64() != 200 {
+		t.Fatalf("spent %s after a failed sign, want 200", p.Spent())
+	}
+	if err := sign(50); err != nil {
+		t.Fatal(err)
+	}
+	if err := sign(1); !errors.Is(err, signer.ErrPolicy) {
+		t.Fatalf("at the daily limit: %v, want ErrPolicy", err)
+	}
+
+	// the limit is per UTC day
+	*now = now.Add(59 * time.Minute)
+	if err := sign(1); !errors.Is(err, signer.ErrPolicy) {
+		t.Fatalf("same day: %v, want ErrPolicy", err)
+	}
+	*now = now.Add(time.Minute)
+	if p.Spent().Sign() != 0 {
+		t.Fatalf("spent %s on a new day, want 0", p.Spent())
+	}
+	if err := sign(100); err != nil {
+		t.Fatal(err)
+	}
+	if p.Spent().Int64() != 100 {
+		t.Fatalf("spent %s, want 100", p.Spent())
+	}
+}
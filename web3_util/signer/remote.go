@@ -0,0 +1,337 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+// The remote protocol is JSON over HTTP, each request a POST to <url>/<method>:
+//
+//	address        {}                                                  -> {"address": "0x.."}
+//	signTx         {"chainId", "to", "nonce", "gas", "gasPrice", "value", "input"} -> {"v", "r", "s"}
+//	signMessage    {"message": "0x.."}                                 -> {"signature": "0x.."}
+//	signTypedData  {"domainSeparator": "0x..", "structHash": "0x.."}   -> {"signature": "0x.."}
+//
+// Failures answer a non 200 status with {"error": "..."}. A token, when set, is sent as a bearer.
+
+// TxRequest is the body of signTx, numbers are decimal strings and bytes 0x hex
+type TxRequest struct {
+	ChainID  uint64 `json:"chainId"`
+	To       string `json:"to,omitempty"`
+	Nonce    uint64 `json:"nonce"`
+	Gas      uint64 `json:"gas"`
+	GasPrice uint64 `json:"gasPrice"`
+	Value    string `json:"value"`
+	Input    string `json:"input"`
+}
+
+type txResponse struct {
+	V string `json:"v"`
+	R string `json:"r"`
+	S string `json:"s"`
+}
+
+type messageRequest struct {
+	Message string `json:"message"`
+}
+
+type typedDataRequest struct {
+	DomainSeparator string `json:"domainSeparator"`
+	StructHash      string `json:"structHash"`
+}
+
+type signatureResponse struct {
+	Signature string `json:"signature"`
+}
+
+type addressResponse struct {
+	Address string `json:"address"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func encodeHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+func decodeHash(s string) (h web3.Hash, err error) {
+	b, err := decodeHex(s)
+	if err != nil {
+		return
+	}
+	if len(b) != 32 {
+		err = fmt.Errorf("hash must be 32 bytes, got %d", len(b))
+		return
+	}
+	copy(h[:], b)
+	return
+}
+
+// NewTxRequest is the signTx body of tx
+func NewTxRequest(tx *web3.Transaction, chainID uint64) *TxRequest {
+	req := &TxRequest{ChainID: chainID, Nonce: tx.Nonce, Gas: tx.Gas, GasPrice: tx.GasPrice, Value: "0", Input: encodeHex(tx.Input)}
+	if tx.To != nil {
+		req.To = tx.To.String()
+	}
+	if tx.Value != nil {
+		req.Value = tx.Value.String()
+	}
+	return req
+}
+
+// Transaction is the unsigned transaction of the request
+func (r *TxRequest) Transaction() (tx *web3.Transaction, err error) {
+	tx = &web3.Transaction{Nonce: r.Nonce, Gas: r.Gas, GasPrice: r.GasPrice}
+	if r.To != "" {
+		to := web3.HexToAddress(r.To)
+		tx.To = &to
+	}
+	var ok bool
+	if tx.Value, ok = new(big.Int).SetString(r.Value, 10); !ok {
+		err = fmt.Errorf("bad value %q", r.Value)
+		return
+	}
+	if tx.Input, err = decodeHex(r.Input); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+	return
+}
+
+// Remote signs through a signing service speaking the protocol above, see Server
+type Remote struct {
+	Url    string
+	Token  string
+	Client *http.Client
+
+	address web3.Address
+}
+
+// NewRemote connects to the service at url and asks its address
+func NewRemote(url, token string) (r *Remote, err error) {
+	r = &Remote{Url: strings.TrimRight(url, "/"), Token: token, Client: &http.Client{Timeout: 30 * time.Second}}
+	var resp addressResponse
+	if err = r.post("address", struct{}{}, &resp); err != nil {
+		return nil, err
+	}
+	r.address = web3.HexToAddress(resp.Address)
+	return
+}
+
+func (r *Remote) post(method string, body, out interface{}) (err error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, r.Url+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("remote signer %s: %w", method, err)
+		return
+	}
+	defer resp.Body.Close()
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.Unmarshal(data, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(data))
+		}
+		if resp.StatusCode == http.StatusForbidden {
+			err = fmt.Errorf("remote signer %s: %s: %w", method, strings.TrimSuffix(e.Error, ": "+ErrPolicy.Error()), ErrPolicy)
+			return
+		}
+		err = fmt.Errorf("remote signer %s: %s: %s", method, resp.Status, e.Error)
+		return
+	}
+	if err = json.Unmarshal(data, out); err != nil {
+		err = fmt.Errorf("remote signer %s: json.Unmarshal: %w", method, err)
+		return
+	}
+	return
+}
+
+func (r *Remote) Address() web3.Address {
+	return r.address
+}
+
+// SignTx has the transaction signed remotely and checks the signature recovers to Address,
+// the signed transaction is a copy and tx is left unsigned
+func (r *Remote) SignTx(tx *web3.Transaction, chainID uint64) (*web3.Transaction, error) {
+	var resp txResponse
+	if err := r.post("signTx", NewTxRequest(tx, chainID), &resp); err != nil {
+		return nil, err
+	}
+	v, errV := decodeHex(resp.V)
+	rr, errR := decodeHex(resp.R)
+	s, errS := decodeHex(resp.S)
+	if errV != nil || errR != nil || errS != nil {
+		return nil, fmt.Errorf("remote signer signTx: bad signature %+v", resp)
+	}
+	signed := *tx
+	signed.V, signed.R, signed.S = v, rr, s
+	sender, err := wallet.NewEIP155Signer(chainID).RecoverSender(&signed)
+	if err != nil {
+		return nil, fmt.Errorf("RecoverSender: %w", err)
+	}
+	if sender != r.address {
+		return nil, fmt.Errorf("remote signer signed as %s, expected %s", sender, r.address)
+	}
+	return &signed, nil
+}
+
+func (r *Remote) signature(method string, body interface{}, hash web3.Hash) (sig []byte, err error) {
+	var resp signatureResponse
+	if err = r.post(method, body, &resp); err != nil {
+		return
+	}
+	if sig, err = decodeHex(resp.Signature); err != nil {
+		err = fmt.Errorf("remote signer %s: bad signature: %w", method, err)
+		return
+	}
+	signer, err := Recover(hash, sig)
+	if err != nil {
+		err = fmt.Errorf("Recover: %w", err)
+		return
+	}
+	if signer != r.address {
+		err = fmt.Errorf("remote signer signed as %s, expected %s", signer, r.address)
+		return
+	}
+	return
+}
+
+func (r *Remote) SignMessage(msg []byte) ([]byte, error) {
+	return r.signature("signMessage", &messageRequest{Message: encodeHex(msg)}, TextHash(msg))
+}
+
+func (r *Remote) SignTypedData(domainSeparator, structHash web3.Hash) ([]byte, error) {
+	req := &typedDataRequest{DomainSeparator: encodeHex(domainSeparator[:]), StructHash: encodeHex(structHash[:])}
+	return r.signature("signTypedData", req, TypedDataHash(domainSeparator, structHash))
+}
+
+// Server serves a Signer with the remote protocol, wrap it in a PolicySigner to limit what it signs.
+// Without a Token anyone reaching it can sign, a warning is logged on the first request.
+type Server struct {
+	Signer Signer
+	Token  string
+
+	warnOnce sync.Once
+}
+
+func NewServer(s Signer, token string) *Server {
+	return &Server{Signer: s, Token: token}
+}
+
+var errUnauthorized = errors.New("unauthorized")
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	out, err := s.serve(req)
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case errors.Is(err, errUnauthorized):
+		w.WriteHeader(http.StatusUnauthorized)
+		out = &errorResponse{Error: err.Error()}
+	case errors.Is(err, ErrPolicy):
+		w.WriteHeader(http.StatusForbidden)
+		out = &errorResponse{Error: err.Error()}
+	case err != nil:
+		w.WriteHeader(http.StatusBadRequest)
+		out = &errorResponse{Error: err.Error()}
+	}
+	if err != nil {
+		seelog.Warnf("signer: %s: %v", req.URL.Path, err)
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) serve(req *http.Request) (out interface{}, err error) {
+	if req.Method != http.MethodPost {
+		return nil, fmt.Errorf("method %s not allowed", req.Method)
+	}
+	if s.Token == "" {
+		s.warnOnce.Do(func() {
+			seelog.Warnf("signer: serving without a token, anyone reaching %s can sign", req.Host)
+		})
+	} else if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+s.Token)) != 1 {
+		return nil, errUnauthorized
+	}
+	dec := json.NewDecoder(req.Body)
+	switch strings.TrimPrefix(req.URL.Path[strings.LastIndex(req.URL.Path, "/"):], "/") {
+	case "address":
+		return &addressResponse{Address: s.Signer.Address().String()}, nil
+	case "signTx":
+		var body TxRequest
+		if err = dec.Decode(&body); err != nil {
+			return
+		}
+		var tx *web3.Transaction
+		if tx, err = body.Transaction(); err != nil {
+			return
+		}
+		if tx, err = s.Signer.SignTx(tx, body.ChainID); err != nil {
+			return
+		}
+		return &txResponse{V: encodeHex(tx.V), R: encodeHex(tx.R), S: encodeHex(tx.S)}, nil
+	case "signMessage":
+		var body messageRequest
+		if err = dec.Decode(&body); err != nil {
+			return
+		}
+		var msg, sig []byte
+		if msg, err = decodeHex(body.Message); err != nil {
+			return
+		}
+		if sig, err = s.Signer.SignMessage(msg); err != nil {
+			return
+		}
+		return &signatureResponse{Signature: encodeHex(sig)}, nil
+	case "signTypedData":
+		var body typedDataRequest
+		if err = dec.Decode(&body); err != nil {
+			return
+		}
+		var domain, structHash web3.Hash
+		if domain, err = decodeHash(body.DomainSeparator); err != nil {
+			return
+		}
+		if structHash, err = decodeHash(body.StructHash); err != nil {
+			return
+		}
+		var sig []byte
+		if sig, err = s.Signer.SignTypedData(domain, structHash); err != nil {
+			return
+		}
+		return &signatureResponse{Signature: encodeHex(sig)}, nil
+	}
+	return nil, fmt.Errorf("unknown method %s", req.URL.Path)
+}
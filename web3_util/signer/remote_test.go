@@ -0,0 +1,59 @@
+package signer_test
+
+import (
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"goutil/web3_util/signer"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+)
+
+func newRemote(t *testing.T, token string) (*signer.Remote, *wallet.Key, func()) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(signer.NewServer(signer.NewLocal(key), "secret"))
+	r, err := signer.NewRemote(srv.URL, token)
+	if err != nil {
+		srv.Close()
+		return nil, key, nil
+	}
+	return r, key, srv.Close
+}
+
+func TestRemoteSignTx(t *testing.T) {
+	r, key, done := newRemote(t, "secret")
+	if r == nil {
+		t.Fatal("NewRemote failed with the right token")
+	}
+	defer done()
+	to := web3.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tx := &web3.Transaction{To: &to, Nonce: 3, Gas: 21000, GasPrice: 5e9, Value: big.NewInt(1)}
+
+	signed, err := r.SignTx(tx, 56)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.V != nil || tx.R != nil || tx.S != nil {
+		t.Fatal("SignTx signed the transaction given")
+	}
+	sender, err := wallet.NewEIP155Signer(56).RecoverSender(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender != key.Address() {
+		t.Fatalf("signed by %s, want %s", sender, key.Address())
+	}
+}
+
+func TestRemoteToken(t *testing.T) {
+	for _, token := range []string{"", "secreT", "secret2"} {
+		if r, _, _ := newRemote(t, token); r != nil {
+			t.Errorf("NewRemote with token %q succeeded", token)
+		}
+	}
+}
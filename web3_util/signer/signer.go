@@ -0,0 +1,88 @@
+package signer
+
+import (
+	"fmt"
+
+	"github.com/panyanyany/go-web3"
+	"github.com/panyanyany/go-web3/wallet"
+	"golang.org/x/crypto/sha3"
+)
+
+// Signer signs for one address, the key may live in this process or elsewhere.
+// Signatures of messages are 65 bytes r, s, v with v 27 or 28.
+type Signer interface {
+	Address() web3.Address
+	// SignTx sets V, R and S of tx for chainID (EIP-155) and returns it
+	SignTx(tx *web3.Transaction, chainID uint64) (*web3.Transaction, error)
+	// SignMessage signs TextHash(msg), as personal_sign does
+	SignMessage(msg []byte) ([]byte, error)
+	// SignTypedData signs TypedDataHash(domainSeparator, structHash), as eth_signTypedData_v4 does
+	SignTypedData(domainSeparator, structHash web3.Hash) ([]byte, error)
+}
+
+func keccak(parts ...[]byte) (h web3.Hash) {
+	k := sha3.NewLegacyKeccak256()
+	for _, p := range parts {
+		k.Write(p)
+	}
+	copy(h[:], k.Sum(nil))
+	return
+}
+
+// TextHash is the EIP-191 hash of a personal message
+func TextHash(msg []byte) web3.Hash {
+	return keccak([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(msg))), msg)
+}
+
+// TypedDataHash is the EIP-712 hash of a struct in a domain
+func TypedDataHash(domainSeparator, structHash web3.Hash) web3.Hash {
+	return keccak([]byte{0x19, 0x01}, domainSeparator[:], structHash[:])
+}
+
+// Recover returns the address that made sig, a 65 bytes signature of hash with v 27/28 or 0/1
+func Recover(hash web3.Hash, sig []byte) (addr web3.Address, err error) {
+	if len(sig) != 65 {
+		err = fmt.Errorf("signature must be 65 bytes, got %d", len(sig))
+		return
+	}
+	s := append([]byte{}, sig...)
+	if s[64] >= 27 {
+		s[64] -= 27
+	}
+	return wallet.Ecrecover(hash[:], s)
+}
+
+// Local signs with a key held in memory
+type Local struct {
+	Key *wallet.Key
+}
+
+func NewLocal(key *wallet.Key) *Local {
+	return &Local{Key: key}
+}
+
+func (l *Local) Address() web3.Address {
+	return l.Key.Address()
+}
+
+func (l *Local) SignTx(tx *web3.Transaction, chainID uint64) (*web3.Transaction, error) {
+	return wallet.NewEIP155Signer(chainID).SignTx(tx, l.Key)
+}
+
+func (l *Local) signHash(hash web3.Hash) (sig []byte, err error) {
+	sig, err = l.Key.Sign(hash[:])
+	if err != nil {
+		err = fmt.Errorf("Key.Sign: %w", err)
+		return
+	}
+	sig[64] += 27
+	return
+}
+
+func (l *Local) SignMessage(msg []byte) ([]byte, error) {
+	return l.signHash(TextHash(msg))
+}
+
+func (l *Local) SignTypedData(domainSeparator, structHash web3.Hash) ([]byte, error) {
+	return l.signHash(TypedDataHash(domainSeparator, structHash))
+}
@@ -1,10 +1,10 @@
 package web3_util
 
 import (
-	"encoding/hex"
-	"fmt"
 	"math/big"
 
+	"goutil/web3_util/keystore"
+
 	"github.com/panyanyany/go-web3/wallet"
 )
 
@@ -18,18 +18,7 @@ func FromWei(balance *big.Int, decimals int) *big.Float {
 	return bal.Quo(bal, op2)
 }
 
+// NewWalletFromPrivateKeyString reads a hex private key, with or without 0x
 func NewWalletFromPrivateKeyString(pk string) (key *wallet.Key, err error) {
-	pk = pk[2:]
-	bs, err := hex.DecodeString(pk)
-	if err != nil {
-		err = fmt.Errorf("decode: %w", err)
-		return
-	}
-
-	key, err = wallet.NewWalletFromPrivKey(bs)
-	if err != nil {
-		err = fmt.Errorf("wallet.NewWalletFromPrivKey: %w", err)
-		return
-	}
-	return
+	return keystore.KeyFromHex(pk)
 }